@@ -0,0 +1,116 @@
+package egobee
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// CodeAuthorizer authorizes an application using the OAuth authorization code
+// grant. The user is sent to the URL from AuthorizeURL, and ecobee redirects
+// them back to the application's redirect URI with a code, which is exchanged
+// for tokens.
+// See https://www.ecobee.com/home/developer/api/documentation/v1/auth/authz-code-authorization.shtml
+type CodeAuthorizer struct {
+	appID       string
+	redirectURI string
+	scope       Scope
+	api         apiBaseURL
+	client      *http.Client
+}
+
+// NewCodeAuthorizer for the application with appID, requesting scope. The
+// redirectURI must match the one registered for the application with ecobee.
+func NewCodeAuthorizer(appID, redirectURI string, scope Scope, opts ...*Options) *CodeAuthorizer {
+	var opt *Options
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	return &CodeAuthorizer{
+		appID:       appID,
+		redirectURI: redirectURI,
+		scope:       scope,
+		api:         opt.apiHost(),
+		client:      opt.httpClient(),
+	}
+}
+
+// AuthorizeURL returns the URL to which the user should be sent to authorize
+// the application. The state is returned unchanged to the redirect URI, and
+// ties the callback to the user's session. It must be unguessable, such as a
+// random value kept in the session, or the callback is open to cross-site
+// request forgery.
+func (a *CodeAuthorizer) AuthorizeURL(state string) string {
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", a.appID)
+	q.Set("redirect_uri", a.redirectURI)
+	q.Set("scope", string(a.scope))
+	q.Set("state", state)
+	return a.api.URL(authorizeURL) + "?" + q.Encode()
+}
+
+// Exchange the authorization code from the redirect for tokens. The result can
+// be used to seed any TokenStorer.
+func (a *CodeAuthorizer) Exchange(ctx context.Context, code string) (*TokenRefreshResponse, error) {
+	q := url.Values{}
+	q.Set("grant_type", "authorization_code")
+	q.Set("code", code)
+	q.Set("redirect_uri", a.redirectURI)
+	q.Set("client_id", a.appID)
+	return requestToken(ctx, a.client, a.api, q)
+}
+
+// CallbackHandler returns an http.Handler for the redirect URI. It rejects
+// requests without a state, or whose state is not accepted by validState, then
+// exchanges the code for tokens, and updates ts with them. validState should
+// accept only the state passed to AuthorizeURL for the request's session, and
+// only once. CallbackHandler panics if validState is nil.
+func (a *CodeAuthorizer) CallbackHandler(ts TokenStorer, validState func(state string) bool) http.Handler {
+	if validState == nil {
+		panic("egobee: CallbackHandler requires validState")
+	}
+	return &callbackHandler{
+		a:          a,
+		ts:         ts,
+		validState: validState,
+	}
+}
+
+type callbackHandler struct {
+	a          *CodeAuthorizer
+	ts         TokenStorer
+	validState func(string) bool
+}
+
+func (h *callbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if state := q.Get("state"); state == "" || !h.validState(state) {
+		http.Error(w, "invalid state", http.StatusBadRequest)
+		return
+	}
+	if e := q.Get("error"); e != "" {
+		msg := "authorization failed: " + e
+		if d := q.Get("error_description"); d != "" {
+			msg += ": " + d
+		}
+		http.Error(w, msg, http.StatusForbidden)
+		return
+	}
+	code := q.Get("code")
+	if code == "" {
+		http.Error(w, "missing code", http.StatusBadRequest)
+		return
+	}
+	trr, err := h.a.Exchange(r.Context(), code)
+	if err != nil {
+		http.Error(w, "failed to exchange code: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	if err := h.ts.Update(trr); err != nil {
+		http.Error(w, "failed to store tokens: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("Authorization complete.\n"))
+}
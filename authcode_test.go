@@ -0,0 +1,122 @@
+package egobee
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCodeAuthorizerAuthorizeURL(t *testing.T) {
+	a := NewCodeAuthorizer("appid", "https://example.com/callback", ScopeSmartWrite)
+	got, err := url.Parse(a.AuthorizeURL("xyzzy"))
+	if err != nil {
+		t.Fatalf("failed to parse URL: %v", err)
+	}
+	if got.Scheme != "https" || got.Host != "api.ecobee.com" || got.Path != authorizeURL {
+		t.Errorf("got URL %v, want https://api.ecobee.com%v", got, authorizeURL)
+	}
+	want := url.Values{
+		"response_type": {"code"},
+		"client_id":     {"appid"},
+		"redirect_uri":  {"https://example.com/callback"},
+		"scope":         {"smartWrite"},
+		"state":         {"xyzzy"},
+	}
+	if !reflect.DeepEqual(got.Query(), want) {
+		t.Errorf("got query %v, want %v", got.Query(), want)
+	}
+}
+
+func codeTokenTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != tokenURL || r.Method != http.MethodPost {
+			t.Errorf("unexpected request: %v %v", r.Method, r.URL.Path)
+		}
+		if got := q.Get("grant_type"); got != "authorization_code" {
+			t.Errorf(`invalid grant_type; got: %q, want: "authorization_code"`, got)
+		}
+		if got := q.Get("redirect_uri"); got != "https://example.com/callback" {
+			t.Errorf("invalid redirect_uri; got: %q", got)
+		}
+		if q.Get("code") != "goodcode" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant","error_description":"The authorization grant is invalid."}`))
+			return
+		}
+		w.Write([]byte(`{"access_token":"access","token_type":"Bearer","expires_in":3599,"refresh_token":"refresh","scope":"smartWrite"}`))
+	}))
+}
+
+func TestCodeAuthorizerExchange(t *testing.T) {
+	s := codeTokenTestServer(t)
+	defer s.Close()
+	a := NewCodeAuthorizer("appid", "https://example.com/callback", ScopeSmartWrite, &Options{APIHost: s.URL})
+
+	got, err := a.Exchange(context.Background(), "goodcode")
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	want := &TokenRefreshResponse{
+		AccessToken:  "access",
+		TokenType:    "Bearer",
+		ExpiresIn:    TokenDuration{Duration: 3599 * time.Second},
+		RefreshToken: "refresh",
+		Scope:        ScopeSmartWrite,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %+v, want: %+v", got, want)
+	}
+
+	if _, err := a.Exchange(context.Background(), "badcode"); !IsAuthorizationError(err, AuthorizationErrorInvalidGrant) {
+		t.Errorf("got error %v, want invalid_grant AuthError", err)
+	}
+}
+
+func TestCodeAuthorizerCallbackHandler(t *testing.T) {
+	s := codeTokenTestServer(t)
+	defer s.Close()
+	a := NewCodeAuthorizer("appid", "https://example.com/callback", ScopeSmartWrite, &Options{APIHost: s.URL})
+
+	for _, tt := range []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantToken  string
+	}{
+		{"success", "code=goodcode&state=xyzzy", http.StatusOK, "access"},
+		{"bad state", "code=goodcode&state=plugh", http.StatusBadRequest, ""},
+		{"missing state", "code=goodcode", http.StatusBadRequest, ""},
+		{"empty state", "code=goodcode&state=", http.StatusBadRequest, ""},
+		{"missing code", "state=xyzzy", http.StatusBadRequest, ""},
+		{"denied", "error=access_denied&state=xyzzy", http.StatusForbidden, ""},
+		{"bad code", "code=badcode&state=xyzzy", http.StatusBadGateway, ""},
+	} {
+		ts := NewMemoryTokenStore(&TokenRefreshResponse{})
+		// Accepts an empty state, which the handler must reject regardless.
+		h := a.CallbackHandler(ts, func(state string) bool { return state == "xyzzy" || state == "" })
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/callback?"+tt.query, nil))
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%v: got status %v, want %v", tt.name, rec.Code, tt.wantStatus)
+		}
+		if got := ts.AccessToken(); got != tt.wantToken {
+			t.Errorf("%v: got access token %q, want %q", tt.name, got, tt.wantToken)
+		}
+	}
+}
+
+func TestCodeAuthorizerCallbackHandlerRequiresValidState(t *testing.T) {
+	a := NewCodeAuthorizer("appid", "https://example.com/callback", ScopeSmartWrite)
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic without validState")
+		}
+	}()
+	a.CallbackHandler(NewMemoryTokenStore(&TokenRefreshResponse{}), nil)
+}
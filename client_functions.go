@@ -1,6 +1,8 @@
 package egobee
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -19,8 +21,6 @@ var (
 	httpNewRequest = http.NewRequest
 	jsonMarshal    = json.Marshal
 
-	errPagingUnimplemented = errors.New("multi-page responses unimplemented")
-
 	// jsonDecode wraps the usual JSON decode workflow to make testing easier.
 	jsonDecode = func(from io.Reader, to interface{}) error {
 		if err := json.NewDecoder(from).Decode(to); err != nil {
@@ -30,24 +30,36 @@ var (
 	}
 )
 
-// page is used for paging in some APIs.
+// page is used for paging in some APIs. When included in a request, only Page
+// is meaningful.
 type page struct {
-	Page       int `json:"page"`
-	TotalPages int `json:"totalPages"`
-	PageSize   int `json:"pageSize"`
-	Total      int `json:"total"`
+	Page       int `json:"page,omitempty"`
+	TotalPages int `json:"totalPages,omitempty"`
+	PageSize   int `json:"pageSize,omitempty"`
+	Total      int `json:"total,omitempty"`
 }
 
 // summarySelection wraps a Selection, and serializes to the format expected by
 // the thermostatSummary API.
 type summarySelection struct {
 	Selection Selection `json:"selection,omitempty"`
+	Page      *page     `json:"page,omitempty"`
 }
 
 func assembleSelectionURL(apiURL string, selection *Selection) (string, error) {
+	return assemblePagedSelectionURL(apiURL, selection, 0)
+}
+
+// assemblePagedSelectionURL behaves like assembleSelectionURL, but requests a
+// specific page of results. Page numbers start at 1; a pageNumber of 0 omits
+// the page from the request entirely, which the API treats as the first page.
+func assemblePagedSelectionURL(apiURL string, selection *Selection, pageNumber int) (string, error) {
 	ss := &summarySelection{
 		Selection: *selection,
 	}
+	if pageNumber > 0 {
+		ss.Page = &page{Page: pageNumber}
+	}
 	qb, err := jsonMarshal(ss)
 	if err != nil {
 		return "", err
@@ -56,7 +68,11 @@ func assembleSelectionURL(apiURL string, selection *Selection) (string, error) {
 }
 
 func assembleSelectionRequest(url string, s *Selection) (*http.Request, error) {
-	u, err := assembleSelectionURL(url, s)
+	return assemblePagedSelectionRequest(url, s, 0)
+}
+
+func assemblePagedSelectionRequest(url string, s *Selection, pageNumber int) (*http.Request, error) {
+	u, err := assemblePagedSelectionURL(url, s, pageNumber)
 	if err != nil {
 		return nil, err
 	}
@@ -69,32 +85,64 @@ func assembleSelectionRequest(url string, s *Selection) (*http.Request, error) {
 }
 
 // validateSelectionResponse validates that a http.Response resulting from a
-// selection request is actually usable.
+// selection request is actually usable. If it is not, an *APIError is returned
+// carrying the status from the response body, when there is one.
 func validateSelectionResponse(res *http.Response) error {
-	if (res.StatusCode / 100) != 2 {
-		return fmt.Errorf("non-ok status response from API: %v %v", res.StatusCode, res.Status)
+	if (res.StatusCode / 100) == 2 {
+		return nil
+	}
+	apiErr := &APIError{
+		HTTPStatusCode: res.StatusCode,
+		Message:        http.StatusText(res.StatusCode),
+	}
+	if res.Body == nil {
+		return apiErr
 	}
-	return nil
+	sr := &statusResponse{}
+	if err := json.NewDecoder(res.Body).Decode(sr); err == nil && sr.Status.Code != StatusCodeSuccess {
+		apiErr.Code = sr.Status.Code
+		apiErr.Message = sr.Status.Message
+	}
+	return apiErr
 }
 
 // ThermostatSummary retrieves a list of thermostat configuration and state
 // revisions. This API request is a light-weight polling method which will only
 // return the revision numbers for the significant portions of the thermostat
-// data.
+// data. Use a Watcher to poll it and retrieve only changed thermostats.
 // See https://www.ecobee.com/home/developer/api/documentation/v1/operations/get-thermostat-summary.shtml
 func (c *Client) ThermostatSummary() (*ThermostatSummary, error) {
-	req, err := assembleSelectionRequest(c.api.URL(thermostatSummaryURL), &Selection{
-		SelectionType: SelectionTypeRegistered,
+	return c.ThermostatSummaryContext(context.Background())
+}
+
+// ThermostatSummaryContext behaves like ThermostatSummary, but the request is
+// bound to ctx.
+func (c *Client) ThermostatSummaryContext(ctx context.Context) (*ThermostatSummary, error) {
+	return c.ThermostatSummaryWithSelectionContext(ctx, &Selection{
+		SelectionType:          SelectionTypeRegistered,
 		IncludeEquipmentStatus: true,
-		IncludeAlerts: true,
+		IncludeAlerts:          true,
 	})
+}
+
+// ThermostatSummaryWithSelection behaves like ThermostatSummary, but summarizes
+// only the thermostats which match selection. Of the Include fields, only
+// IncludeEquipmentStatus is meaningful.
+func (c *Client) ThermostatSummaryWithSelection(selection *Selection) (*ThermostatSummary, error) {
+	return c.ThermostatSummaryWithSelectionContext(context.Background(), selection)
+}
+
+// ThermostatSummaryWithSelectionContext behaves like
+// ThermostatSummaryWithSelection, but the request is bound to ctx.
+func (c *Client) ThermostatSummaryWithSelectionContext(ctx context.Context, selection *Selection) (*ThermostatSummary, error) {
+	req, err := assembleSelectionRequest(c.api.URL(thermostatSummaryURL), selection)
 	if err != nil {
 		return nil, err
 	}
 
-	res, err := c.Do(req)
+	res, err := c.Do(req.WithContext(ctx))
 	if err != nil {
-		return nil, fmt.Errorf("failed to Do(): %v", err)
+		return nil, err
 	}
 	defer res.Body.Close()
 
@@ -106,6 +154,9 @@ func (c *Client) ThermostatSummary() (*ThermostatSummary, error) {
 	if err := jsonDecode(res.Body, ts); err != nil {
 		return nil, err
 	}
+	if err := ts.Status.err(res.StatusCode); err != nil {
+		return nil, err
+	}
 	return ts, nil
 }
 
@@ -113,20 +164,127 @@ func (c *Client) ThermostatSummary() (*ThermostatSummary, error) {
 type pagedThermostatResponse struct {
 	Page        page          `json:"page,omitempty"`
 	Thermostats []*Thermostat `json:"thermostatList,omitempty"`
-	Status      struct {
-		Code    int    `json:"code,omitempty"`
-		Message string `json:"message,omitempty"`
-	} `json:"status,omitempty"`
+	Status      Status        `json:"status,omitempty"`
 }
 
-// Thermostats returns all Thermostat objects which match selection.
+// Thermostats returns all Thermostat objects which match selection. If the
+// response spans multiple pages, each page is requested in turn and the results
+// are merged. Use ThermostatPages to avoid holding every page in memory.
 func (c *Client) Thermostats(selection *Selection) ([]*Thermostat, error) {
-	req, err := assembleSelectionRequest(c.api.URL(thermostatURL), selection)
+	return c.ThermostatsContext(context.Background(), selection)
+}
+
+// ThermostatsContext behaves like Thermostats, but every request is bound to
+// ctx.
+func (c *Client) ThermostatsContext(ctx context.Context, selection *Selection) ([]*Thermostat, error) {
+	var thermostats []*Thermostat
+	it := c.ThermostatPagesContext(ctx, selection)
+	for first := true; it.Next(); first = false {
+		if first {
+			thermostats = it.Thermostats()
+			continue
+		}
+		thermostats = append(thermostats, it.Thermostats()...)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return thermostats, nil
+}
+
+// ThermostatIterator steps through the pages of Thermostats matching a
+// Selection, requesting each page from the API only as it is needed.
+//
+//	it := client.ThermostatPages(selection)
+//	for it.Next() {
+//		for _, t := range it.Thermostats() {
+//			...
+//		}
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type ThermostatIterator struct {
+	ctx       context.Context
+	c         *Client
+	selection *Selection
+
+	page        page
+	thermostats []*Thermostat
+	done        bool
+	err         error
+}
+
+// ThermostatPages returns a ThermostatIterator over all Thermostat objects
+// which match selection. No requests are made until Next is called.
+func (c *Client) ThermostatPages(selection *Selection) *ThermostatIterator {
+	return c.ThermostatPagesContext(context.Background(), selection)
+}
+
+// ThermostatPagesContext behaves like ThermostatPages, but every request made
+// by the returned ThermostatIterator is bound to ctx.
+func (c *Client) ThermostatPagesContext(ctx context.Context, selection *Selection) *ThermostatIterator {
+	return &ThermostatIterator{
+		ctx:       ctx,
+		c:         c,
+		selection: selection,
+	}
+}
+
+// Next fetches the next page of Thermostats. It returns false when there are no
+// more pages, or when an error occurs; check Err to distinguish the two.
+func (i *ThermostatIterator) Next() bool {
+	if i.done {
+		return false
+	}
+	want := 0
+	if i.page.Page > 0 {
+		want = i.page.Page + 1
+	}
+	ptr, err := i.c.thermostatPage(i.ctx, i.selection, want)
+	if err != nil {
+		i.err = err
+		i.done = true
+		i.thermostats = nil
+		return false
+	}
+	if want > 0 && ptr.Page.Page != want {
+		i.err = fmt.Errorf("requested page %v of thermostats, got page %v", want, ptr.Page.Page)
+		i.done = true
+		i.thermostats = nil
+		return false
+	}
+	i.page = ptr.Page
+	i.thermostats = ptr.Thermostats
+	i.done = ptr.Page.Page >= ptr.Page.TotalPages
+	return true
+}
+
+// Thermostats on the current page.
+func (i *ThermostatIterator) Thermostats() []*Thermostat {
+	return i.thermostats
+}
+
+// Page reports the number of the current page, and the total number of pages
+// in the response. Responses which are not paged report 0 for both.
+func (i *ThermostatIterator) Page() (current, total int) {
+	return i.page.Page, i.page.TotalPages
+}
+
+// Err returns the first error encountered while iterating, if any.
+func (i *ThermostatIterator) Err() error {
+	return i.err
+}
+
+// thermostatPage retrieves a single page of the response to a Thermostats
+// request. A pageNumber of 0 requests the first page.
+func (c *Client) thermostatPage(ctx context.Context, selection *Selection, pageNumber int) (*pagedThermostatResponse, error) {
+	req, err := assemblePagedSelectionRequest(c.api.URL(thermostatURL), selection, pageNumber)
 	if err != nil {
 		return nil, err
 	}
 
-	res, err := c.Do(req)
+	res, err := c.Do(req.WithContext(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -137,14 +295,115 @@ func (c *Client) Thermostats(selection *Selection) ([]*Thermostat, error) {
 	}
 
 	ptr := &pagedThermostatResponse{}
-
 	if err := jsonDecode(res.Body, ptr); err != nil {
 		return nil, err
 	}
+	if err := ptr.Status.err(res.StatusCode); err != nil {
+		return nil, err
+	}
+	return ptr, nil
+}
+
+// functionsRequest is the body of a request to the thermostat functions API.
+type functionsRequest struct {
+	Selection Selection  `json:"selection"`
+	Functions []Function `json:"functions"`
+}
+
+// statusResponse is returned by API requests which do not return any other
+// data.
+type statusResponse struct {
+	Status Status `json:"status"`
+}
+
+func assembleFunctionsRequest(url string, s *Selection, functions []Function) (*http.Request, error) {
+	return assembleUpdateRequest(url, &functionsRequest{
+		Selection: *s,
+		Functions: functions,
+	})
+}
+
+// assembleUpdateRequest creates a POST request to the thermostat update API,
+// with body serialized as JSON.
+func assembleUpdateRequest(url string, body interface{}) (*http.Request, error) {
+	b, err := jsonMarshal(body)
+	if err != nil {
+		return nil, err
+	}
+	r, err := httpNewRequest(http.MethodPost, url+"?format=json", bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	r.Header.Add("Content-Type", requestContentType)
+	return r, nil
+}
 
-	if ptr.Page.Page != ptr.Page.TotalPages {
-		// TODO(cfunkhouser): Handle paged responses.
-		return nil, errPagingUnimplemented
+// doUpdate performs an update request, and returns any error it reports.
+func (c *Client) doUpdate(ctx context.Context, req *http.Request) error {
+	res, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if err := validateSelectionResponse(res); err != nil {
+		return err
+	}
+
+	sr := &statusResponse{}
+	if err := jsonDecode(res.Body, sr); err != nil {
+		return err
+	}
+	return sr.Status.err(res.StatusCode)
+}
+
+// UpdateThermostats performs functions, in order, on all thermostats which
+// match selection. Functions are created with the constructors in this
+// package, such as SetHold and ResumeProgram.
+// See https://www.ecobee.com/home/developer/api/documentation/v1/operations/post-thermostats.shtml
+func (c *Client) UpdateThermostats(selection *Selection, functions ...Function) error {
+	return c.UpdateThermostatsContext(context.Background(), selection, functions...)
+}
+
+// UpdateThermostatsContext behaves like UpdateThermostats, but the request is
+// bound to ctx.
+func (c *Client) UpdateThermostatsContext(ctx context.Context, selection *Selection, functions ...Function) error {
+	if len(functions) == 0 {
+		return errors.New("no functions to perform")
+	}
+	req, err := assembleFunctionsRequest(c.api.URL(thermostatURL), selection, functions)
+	if err != nil {
+		return err
+	}
+	return c.doUpdate(ctx, req)
+}
+
+// thermostatUpdateRequest is the body of a request to update thermostat
+// properties.
+type thermostatUpdateRequest struct {
+	Selection  Selection        `json:"selection"`
+	Thermostat *ThermostatPatch `json:"thermostat"`
+}
+
+// UpdateThermostat changes the properties set in patch on all thermostats which
+// match selection. Properties not set in patch are left unchanged.
+// See https://www.ecobee.com/home/developer/api/documentation/v1/operations/post-thermostats.shtml
+func (c *Client) UpdateThermostat(selection *Selection, patch *ThermostatPatch) error {
+	return c.UpdateThermostatContext(context.Background(), selection, patch)
+}
+
+// UpdateThermostatContext behaves like UpdateThermostat, but the request is
+// bound to ctx.
+func (c *Client) UpdateThermostatContext(ctx context.Context, selection *Selection, patch *ThermostatPatch) error {
+	if patch.Empty() {
+		return errors.New("no thermostat properties to update")
+	}
+	req, err := assembleUpdateRequest(c.api.URL(thermostatURL), &thermostatUpdateRequest{
+		Selection:  *selection,
+		Thermostat: patch,
+	})
+	if err != nil {
+		return err
 	}
-	return ptr.Thermostats, nil
+	return c.doUpdate(ctx, req)
 }
@@ -1,13 +1,17 @@
 package egobee
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/imdario/mergo"
 )
@@ -97,14 +101,34 @@ func TestValidateSelectionResponse(t *testing.T) {
 				Status:     "Found",
 				StatusCode: http.StatusFound,
 			},
-			want: errors.New("non-ok status response from API: 302 Found"),
+			want: &APIError{HTTPStatusCode: 302, Message: "Found"},
 		},
 		{
 			res: &http.Response{
 				Status:     "WTF Is This?",
 				StatusCode: 600,
 			},
-			want: errors.New("non-ok status response from API: 600 WTF Is This?"),
+			want: &APIError{HTTPStatusCode: 600},
+		},
+		{
+			res: &http.Response{
+				Status:     "Internal Server Error",
+				StatusCode: 500,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"status":{"code":14,"message":"Authentication token has expired. Refresh your tokens. "}}`)),
+			},
+			want: &APIError{
+				HTTPStatusCode: 500,
+				Code:           StatusCodeAuthenticationExpired,
+				Message:        "Authentication token has expired. Refresh your tokens. ",
+			},
+		},
+		{
+			res: &http.Response{
+				Status:     "Internal Server Error",
+				StatusCode: 500,
+				Body:       ioutil.NopCloser(strings.NewReader(`not json`)),
+			},
+			want: &APIError{HTTPStatusCode: 500, Message: "Internal Server Error"},
 		},
 		{
 			res: &http.Response{
@@ -120,7 +144,7 @@ func TestValidateSelectionResponse(t *testing.T) {
 		},
 	} {
 		if got := validateSelectionResponse(tt.res); !reflect.DeepEqual(got, tt.want) {
-			t.Errorf("invalid error response; got: %q, want: %q", got, tt.want)
+			t.Errorf("invalid error response; got: %#v, want: %#v", got, tt.want)
 		}
 	}
 }
@@ -181,7 +205,7 @@ func TestClientThermostatSummary(t *testing.T) {
 		"revisionList": ["revision1","revision2"],
 		"thermostatCount": 2,
 		"statusList": ["status1","status2"],
-		"status": {"code": 200, "message": "Ok"}
+		"status": {"code": 0, "message": "Ok"}
 	}`,
 			},
 			want: &ThermostatSummary{
@@ -191,7 +215,7 @@ func TestClientThermostatSummary(t *testing.T) {
 				Status: struct {
 					Code    int    `json:"code,omitempty"`
 					Message string `json:"message,omitempty"`
-				}{200, "Ok"},
+				}{0, "Ok"},
 			},
 		},
 		{
@@ -201,6 +225,14 @@ func TestClientThermostatSummary(t *testing.T) {
 			},
 			wantErr: "non-ok status response from API: 503 Internal Server Error",
 		},
+		{
+			name: "Not-ok (500) response with expired token status",
+			opts: testServerOpts{
+				StatusCode: 500,
+				Payload:    `{"status": {"code": 14, "message": "Authentication token has expired. Refresh your tokens."}}`,
+			},
+			wantErr: "non-ok status from API: 14 Authentication token has expired. Refresh your tokens.",
+		},
 	} {
 		opts := baseOpts
 		if err := mergo.Merge(&opts, tt.opts, mergo.WithOverride); err != nil {
@@ -266,7 +298,7 @@ func TestClientThermostats(t *testing.T) {
 			{ "name": "thermostat1" },
 			{ "name": "thermostat2" }
 		],
-		"status": { "code": 200, "message": "OK" }
+		"status": { "code": 0, "message": "OK" }
 	}`,
 			},
 			want: []*Thermostat{
@@ -282,7 +314,7 @@ func TestClientThermostats(t *testing.T) {
 			{ "name": "thermostat1" },
 			{ "name": "thermostat2" }
 		],
-		"status": { "code": 200, "message": "OK" }
+		"status": { "code": 0, "message": "OK" }
 	}`,
 			},
 			want: []*Thermostat{
@@ -301,7 +333,7 @@ func TestClientThermostats(t *testing.T) {
 			"total": 2
 		},
 		"thermostatList": [],
-		"status": { "code": 200, "message": "OK" }
+		"status": { "code": 0, "message": "OK" }
 	}`,
 			},
 			want: []*Thermostat{},
@@ -316,7 +348,7 @@ func TestClientThermostats(t *testing.T) {
 			"pageSize": 2,
 			"total": 2
 		},
-		"status": { "code": 200, "message": "OK" }
+		"status": { "code": 0, "message": "OK" }
 	}`,
 			},
 		},
@@ -327,6 +359,13 @@ func TestClientThermostats(t *testing.T) {
 			},
 			wantErr: "non-ok status response from API: 503 Internal Server Error",
 		},
+		{
+			name: "OK response with not-ok status",
+			opts: testServerOpts{
+				Payload: `{"status": { "code": 9, "message": "Invalid selection." }}`,
+			},
+			wantErr: "non-ok status from API: 9 Invalid selection.",
+		},
 	} {
 		opts := baseOpts
 		if err := mergo.Merge(&opts, tt.opts, mergo.WithOverride); err != nil {
@@ -365,3 +404,240 @@ func TestClientThermostatsJSONDecodeError(t *testing.T) {
 		t.Errorf(`got unexpected error value; got: %v, want: "test error"`, err)
 	}
 }
+
+func TestAssemblePagedSelectionURL(t *testing.T) {
+	testAPIURL := "http://heylookathing"
+	testSelection := &Selection{
+		SelectionType:  SelectionTypeRegistered,
+		SelectionMatch: "awwyiss",
+	}
+
+	want := "http://heylookathing?json=%7B%22selection%22%3A%7B%22selectionType%22%3A%22registered%22%2C%22selectionMatch%22%3A%22awwyiss%22%7D%2C%22page%22%3A%7B%22page%22%3A3%7D%7D"
+	got, err := assemblePagedSelectionURL(testAPIURL, testSelection, 3)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if got != want {
+		t.Fatalf("got: %+v, want: %v", got, want)
+	}
+}
+
+// pagedThermostatsTestHandler serves pages of thermostats, one page per entry
+// in pages, honoring the page requested in the selection JSON.
+func pagedThermostatsTestHandler(t *testing.T, pages [][]string, requested *[]int) http.HandlerFunc {
+	t.Helper()
+	return func(w http.ResponseWriter, r *http.Request) {
+		ss := &summarySelection{}
+		if err := json.Unmarshal([]byte(r.URL.Query().Get("json")), ss); err != nil {
+			t.Errorf("failed to decode selection: %v", err)
+		}
+		n := 1
+		if ss.Page != nil {
+			n = ss.Page.Page
+		}
+		*requested = append(*requested, n)
+		ptr := &pagedThermostatResponse{
+			Page: page{
+				Page:       n,
+				TotalPages: len(pages),
+			},
+		}
+		for _, name := range pages[n-1] {
+			ptr.Thermostats = append(ptr.Thermostats, &Thermostat{Name: name})
+		}
+		w.Header().Set("Content-Type", requestContentType)
+		json.NewEncoder(w).Encode(ptr)
+	}
+}
+
+func TestClientThermostatsMultiplePages(t *testing.T) {
+	var requested []int
+	s := httptest.NewServer(pagedThermostatsTestHandler(t, [][]string{
+		{"thermostat1", "thermostat2"},
+		{"thermostat3", "thermostat4"},
+		{"thermostat5"},
+	}, &requested))
+	defer s.Close()
+	client := &Client{api: apiBaseURL(s.URL)}
+
+	got, err := client.Thermostats(&Selection{})
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	want := []*Thermostat{
+		&Thermostat{Name: "thermostat1"},
+		&Thermostat{Name: "thermostat2"},
+		&Thermostat{Name: "thermostat3"},
+		&Thermostat{Name: "thermostat4"},
+		&Thermostat{Name: "thermostat5"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("return value check failed;\ngot: %#v\nwant: %#v", got, want)
+	}
+	if wantRequested := []int{1, 2, 3}; !reflect.DeepEqual(requested, wantRequested) {
+		t.Errorf("requested wrong pages; got: %v, want: %v", requested, wantRequested)
+	}
+}
+
+func TestClientThermostatPages(t *testing.T) {
+	var requested []int
+	s := httptest.NewServer(pagedThermostatsTestHandler(t, [][]string{
+		{"thermostat1", "thermostat2"},
+		{"thermostat3"},
+	}, &requested))
+	defer s.Close()
+	client := &Client{api: apiBaseURL(s.URL)}
+
+	it := client.ThermostatPages(&Selection{})
+	if len(requested) != 0 {
+		t.Errorf("requests made before Next; got: %v", requested)
+	}
+	var got [][]string
+	for it.Next() {
+		var names []string
+		for _, th := range it.Thermostats() {
+			names = append(names, th.Name)
+		}
+		got = append(got, names)
+		if current, total := it.Page(); current != len(got) || total != 2 {
+			t.Errorf("wrong page info; got: %v of %v, want: %v of 2", current, total, len(got))
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Errorf("got unexpected error: %v", err)
+	}
+	want := [][]string{{"thermostat1", "thermostat2"}, {"thermostat3"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("return value check failed;\ngot: %v\nwant: %v", got, want)
+	}
+	if it.Next() {
+		t.Error("Next returned true after the last page")
+	}
+}
+
+func TestClientThermostatPagesWrongPage(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", requestContentType)
+		w.Write([]byte(`{"page":{"page":1,"totalPages":2},"thermostatList":[{"name":"thermostat1"}]}`))
+	}))
+	defer s.Close()
+	client := &Client{api: apiBaseURL(s.URL)}
+
+	got, err := client.Thermostats(&Selection{})
+	if got != nil {
+		t.Errorf("got unexpected return value; got: %+v, want: nil", got)
+	}
+	if want := "requested page 2 of thermostats, got page 1"; err == nil || err.Error() != want {
+		t.Errorf("got unexpected error value; got: %v, want: %q", err, want)
+	}
+}
+
+func TestClientUpdateThermostats(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		statusCode int
+		payload    string
+		wantErr    string
+	}{
+		{
+			name:    "OK response",
+			payload: `{"status":{"code":0,"message":""}}`,
+		},
+		{
+			name:    "not-ok status in response",
+			payload: `{"status":{"code":8,"message":"Invalid function."}}`,
+			wantErr: "non-ok status from API: 8 Invalid function.",
+		},
+		{
+			name:       "not-ok (503) response",
+			statusCode: 503,
+			wantErr:    "non-ok status response from API: 503 Service Unavailable",
+		},
+	} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				t.Errorf("case %q: invalid method; got: %q, want: %q", tt.name, r.Method, http.MethodPost)
+			}
+			if got := r.URL.Query().Get("format"); got != "json" {
+				t.Errorf(`case %q: invalid format; got: %q, want: "json"`, tt.name, got)
+			}
+			if got := r.Header.Get("Content-Type"); got != requestContentType {
+				t.Errorf("case %q: invalid Content-Type header; got: %q, want: %q", tt.name, got, requestContentType)
+			}
+			b, _ := ioutil.ReadAll(r.Body)
+			want := `{"selection":{"selectionType":"thermostats","selectionMatch":"123"},"functions":[{"type":"resumeProgram","params":{"resumeAll":true}},{"type":"sendMessage","params":{"text":"hi"}}]}`
+			if string(b) != want {
+				t.Errorf("case %q: invalid body;\ngot: %s\nwant: %s", tt.name, b, want)
+			}
+			if tt.statusCode != 0 {
+				w.WriteHeader(tt.statusCode)
+			}
+			w.Write([]byte(tt.payload))
+		}))
+		client := &Client{api: apiBaseURL(s.URL)}
+		err := client.UpdateThermostats(&Selection{
+			SelectionType:  SelectionTypeThermostats,
+			SelectionMatch: "123",
+		}, ResumeProgram(true), SendMessage("hi"))
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("case %q: got unexpected error: %v", tt.name, err)
+		}
+		if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+			t.Errorf("case %q: got unexpected error value; got: %v, want: %q", tt.name, err, tt.wantErr)
+		}
+		s.Close()
+	}
+}
+
+func TestClientUpdateThermostatsWithoutFunctions(t *testing.T) {
+	client := &Client{}
+	if err := client.UpdateThermostats(&Selection{}); err == nil {
+		t.Error("expected error when no functions are given, got nil")
+	}
+}
+
+func TestClientContextCancellation(t *testing.T) {
+	unblock := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-unblock:
+		}
+	}))
+	defer s.Close()
+	defer close(unblock)
+	client := &Client{api: apiBaseURL(s.URL)}
+
+	for _, tt := range []struct {
+		name string
+		call func(context.Context) error
+	}{
+		{
+			name: "ThermostatSummaryContext",
+			call: func(ctx context.Context) error {
+				_, err := client.ThermostatSummaryContext(ctx)
+				return err
+			},
+		},
+		{
+			name: "ThermostatsContext",
+			call: func(ctx context.Context) error {
+				_, err := client.ThermostatsContext(ctx, &Selection{})
+				return err
+			},
+		},
+		{
+			name: "UpdateThermostatsContext",
+			call: func(ctx context.Context) error {
+				return client.UpdateThermostatsContext(ctx, &Selection{}, ResumeProgram(false))
+			},
+		},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		err := tt.call(ctx)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("case %q: got error %v, want %v", tt.name, err, context.DeadlineExceeded)
+		}
+	}
+}
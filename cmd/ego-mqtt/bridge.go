@@ -0,0 +1,533 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cfunkhouser/egobee"
+)
+
+// bridgeSelection is the data retrieved for each thermostat.
+var bridgeSelection = egobee.Selection{
+	SelectionType:          egobee.SelectionTypeRegistered,
+	IncludeRuntime:         true,
+	IncludeSettings:        true,
+	IncludeSensors:         true,
+	IncludeEquipmentStatus: true,
+}
+
+// Modes as named by Home Assistant, and their ecobee equivalents.
+var (
+	haModes = map[string]string{
+		"auto":        "heat_cool",
+		"auxHeatOnly": "heat",
+		"cool":        "cool",
+		"heat":        "heat",
+		"off":         "off",
+	}
+	ecobeeModes = map[string]string{
+		"heat_cool": "auto",
+		"cool":      "cool",
+		"heat":      "heat",
+		"off":       "off",
+	}
+)
+
+// mqttConn is the part of an MQTT connection used by the bridge.
+type mqttConn interface {
+	Publish(topic string, payload []byte, retain bool) error
+	Subscribe(filter string, handler mqttHandler) error
+}
+
+// reconnector is implemented by mqttConns which reconnect when the connection
+// is lost, such as mqttSession.
+type reconnector interface {
+	Reconnected() <-chan struct{}
+}
+
+// bridgeConfig configures a bridge.
+type bridgeConfig struct {
+	// TopicPrefix under which state is published and commands are received.
+	TopicPrefix string
+	// DiscoveryPrefix of Home Assistant discovery topics.
+	DiscoveryPrefix string
+	// Celsius publishes and accepts temperatures in degrees Celsius rather than
+	// Fahrenheit.
+	Celsius bool
+	// HoldType of holds created by setpoint and fan commands.
+	HoldType egobee.HoldType
+	// HoldHours is the duration of holds of type egobee.HoldTypeHoldHours.
+	HoldHours int
+	// Watcher configures polling of the ecobee API.
+	Watcher egobee.WatcherOptions
+}
+
+// validate the configuration of holds. Holds of type egobee.HoldTypeDateTime
+// need start and end times, which commands do not carry.
+func (cfg *bridgeConfig) validate() error {
+	switch cfg.HoldType {
+	case "", egobee.HoldTypeNextTransition, egobee.HoldTypeIndefinite:
+	case egobee.HoldTypeHoldHours:
+		if cfg.HoldHours < 1 {
+			return fmt.Errorf("holds of type %v require a positive number of hours", cfg.HoldType)
+		}
+	default:
+		return fmt.Errorf("unsupported hold type %q", cfg.HoldType)
+	}
+	return nil
+}
+
+// command received on an MQTT command topic.
+type command struct {
+	thermostatID string
+	name         string
+	payload      string
+}
+
+// bridge publishes the state of thermostats to MQTT, and performs commands
+// received from MQTT on them.
+type bridge struct {
+	cfg  bridgeConfig
+	c    *egobee.Client
+	mqtt mqttConn
+
+	commands    chan command
+	thermostats map[string]*egobee.Thermostat
+	announced   map[string]bool // discovery topics already published
+}
+
+func newBridge(c *egobee.Client, mqtt mqttConn, cfg bridgeConfig) *bridge {
+	if cfg.HoldType == "" {
+		cfg.HoldType = egobee.HoldTypeNextTransition
+	}
+	return &bridge{
+		cfg:         cfg,
+		c:           c,
+		mqtt:        mqtt,
+		commands:    make(chan command, 16),
+		thermostats: make(map[string]*egobee.Thermostat),
+		announced:   make(map[string]bool),
+	}
+}
+
+// availabilityTopic is "online" while the bridge is running, and "offline"
+// otherwise. It should be used as the connection's will.
+func availabilityTopic(prefix string) string {
+	return prefix + "/status"
+}
+
+func (b *bridge) stateTopic(id string) string {
+	return fmt.Sprintf("%v/%v/state", b.cfg.TopicPrefix, id)
+}
+
+func (b *bridge) sensorStateTopic(id, sensorID string) string {
+	return fmt.Sprintf("%v/%v/sensor/%v/state", b.cfg.TopicPrefix, id, objectID(sensorID))
+}
+
+func (b *bridge) commandTopic(id, name string) string {
+	return fmt.Sprintf("%v/%v/%v/set", b.cfg.TopicPrefix, id, name)
+}
+
+var invalidObjectIDChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// objectID makes s suitable for use in a topic and Home Assistant object ID.
+func objectID(s string) string {
+	return invalidObjectIDChars.ReplaceAllString(s, "_")
+}
+
+// run the bridge until ctx is done.
+func (b *bridge) run(ctx context.Context) error {
+	if err := b.mqtt.Subscribe(b.cfg.TopicPrefix+"/+/+/set", b.receive); err != nil {
+		return fmt.Errorf("failed to subscribe to commands: %v", err)
+	}
+	if err := b.mqtt.Publish(availabilityTopic(b.cfg.TopicPrefix), []byte("online"), true); err != nil {
+		return err
+	}
+
+	opts := b.cfg.Watcher
+	sel := bridgeSelection
+	opts.Selection = &sel
+	if opts.OnError == nil {
+		opts.OnError = func(err error) { log.Printf("Failed to poll thermostats: %v", err) }
+	}
+	w := egobee.NewWatcher(b.c, &opts)
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+
+	var reconnected <-chan struct{}
+	if r, ok := b.mqtt.(reconnector); ok {
+		reconnected = r.Reconnected()
+	}
+	events := w.Events()
+	for {
+		select {
+		case <-reconnected:
+			b.republish()
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if ev.Changes.Has(egobee.ChangeRemoved) {
+				// Commands for it can no longer be performed.
+				delete(b.thermostats, ev.Revision.Identifier)
+				continue
+			}
+			if err := b.publish(ev.Thermostat); err != nil {
+				log.Printf("Failed to publish thermostat %v: %v", ev.Thermostat.Identifier, err)
+			}
+		case cmd := <-b.commands:
+			if err := b.perform(ctx, cmd); err != nil {
+				log.Printf("Failed to perform %v command on thermostat %v: %v", cmd.name, cmd.thermostatID, err)
+			}
+		case err := <-done:
+			b.mqtt.Publish(availabilityTopic(b.cfg.TopicPrefix), []byte("offline"), true)
+			return err
+		}
+	}
+}
+
+// republish availability, which the broker replaced with the will when the
+// connection was lost, and the state of every thermostat, which may have
+// changed since.
+func (b *bridge) republish() {
+	if err := b.mqtt.Publish(availabilityTopic(b.cfg.TopicPrefix), []byte("online"), true); err != nil {
+		log.Printf("Failed to publish availability: %v", err)
+	}
+	for _, t := range b.thermostats {
+		if err := b.publish(t); err != nil {
+			log.Printf("Failed to publish thermostat %v: %v", t.Identifier, err)
+		}
+	}
+}
+
+// receive a message on a command topic. It is called on the MQTT reading
+// goroutine, so only queues the command.
+func (b *bridge) receive(topic string, payload []byte) {
+	parts := strings.Split(strings.TrimPrefix(topic, b.cfg.TopicPrefix+"/"), "/")
+	if len(parts) != 3 {
+		return
+	}
+	select {
+	case b.commands <- command{thermostatID: parts[0], name: parts[1], payload: string(payload)}:
+	default:
+		log.Printf("Dropped %v command for thermostat %v; too many pending", parts[1], parts[0])
+	}
+}
+
+// temperature converts t to the configured unit, rounded to a tenth.
+func (b *bridge) temperature(t egobee.Temperature) float64 {
+	v := t.Fahrenheit()
+	if b.cfg.Celsius {
+		v = t.Celsius()
+	}
+	return math.Round(v*10) / 10
+}
+
+// parseTemperature parses a setpoint in the configured unit.
+func (b *bridge) parseTemperature(s string) (egobee.Temperature, error) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid temperature %q", s)
+	}
+	if b.cfg.Celsius {
+		return egobee.FromCelsius(v), nil
+	}
+	return egobee.FromFahrenheit(v), nil
+}
+
+func (b *bridge) unit() string {
+	if b.cfg.Celsius {
+		return "C"
+	}
+	return "F"
+}
+
+// thermostatState is published to a thermostat's state topic.
+type thermostatState struct {
+	Mode               string  `json:"mode"`
+	Action             string  `json:"action"`
+	Fan                string  `json:"fan"`
+	CurrentTemperature float64 `json:"current_temperature"`
+	TargetLow          float64 `json:"target_temperature_low"`
+	TargetHigh         float64 `json:"target_temperature_high"`
+	CurrentHumidity    int     `json:"current_humidity"`
+	Connected          bool    `json:"connected"`
+}
+
+// action describes what the equipment is doing, as Home Assistant expects.
+func action(t *egobee.Thermostat) string {
+	running := egobee.ParseEquipment(t.EquipmentStatus)
+	switch {
+	case t.Settings.HVACMode == "off":
+		return "off"
+	case running[egobee.EquipmentHeatPump] || running[egobee.EquipmentHeatPump2] || running[egobee.EquipmentHeatPump3] ||
+		running[egobee.EquipmentAuxHeat1] || running[egobee.EquipmentAuxHeat2] || running[egobee.EquipmentAuxHeat3]:
+		if t.Settings.HVACMode == "cool" {
+			// Heat pumps run to cool, too.
+			return "cooling"
+		}
+		return "heating"
+	case running[egobee.EquipmentCompCool1] || running[egobee.EquipmentCompCool2]:
+		return "cooling"
+	case running[egobee.EquipmentFan]:
+		return "fan"
+	}
+	return "idle"
+}
+
+// sensorState is published to a sensor's state topic.
+type sensorState struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	Humidity    *int     `json:"humidity,omitempty"`
+	Occupancy   *bool    `json:"occupancy,omitempty"`
+}
+
+// publish discovery, if necessary, and the state of t.
+func (b *bridge) publish(t *egobee.Thermostat) error {
+	b.thermostats[t.Identifier] = t
+	if err := b.announce(t); err != nil {
+		return err
+	}
+
+	state, err := json.Marshal(&thermostatState{
+		Mode:               haModes[t.Settings.HVACMode],
+		Action:             action(t),
+		Fan:                t.Runtime.DesiredFanMode,
+		CurrentTemperature: b.temperature(t.Runtime.ActualTemperature),
+		TargetLow:          b.temperature(t.Runtime.DesiredHeat),
+		TargetHigh:         b.temperature(t.Runtime.DesiredCool),
+		CurrentHumidity:    t.Runtime.ActualHumidity,
+		Connected:          t.Runtime.Connected,
+	})
+	if err != nil {
+		return err
+	}
+	if err := b.mqtt.Publish(b.stateTopic(t.Identifier), state, true); err != nil {
+		return err
+	}
+
+	for i := range t.RemoteSensors {
+		s := &t.RemoteSensors[i]
+		var ss sensorState
+		if v, err := s.Temperature(); err == nil {
+			temp := b.temperature(v)
+			ss.Temperature = &temp
+		}
+		if v, err := s.Humidity(); err == nil {
+			ss.Humidity = &v
+		}
+		if v, err := s.Occupancy(); err == nil {
+			ss.Occupancy = &v
+		}
+		state, err := json.Marshal(&ss)
+		if err != nil {
+			return err
+		}
+		if err := b.mqtt.Publish(b.sensorStateTopic(t.Identifier, s.ID), state, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discoveryDevice identifies the thermostat in Home Assistant.
+type discoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model,omitempty"`
+}
+
+// announce publishes Home Assistant discovery payloads for t and its sensors,
+// unless they have already been published.
+func (b *bridge) announce(t *egobee.Thermostat) error {
+	id := t.Identifier
+	device := &discoveryDevice{
+		Identifiers:  []string{"ecobee_" + id},
+		Name:         t.Name,
+		Manufacturer: "ecobee",
+		Model:        t.ModelNumber,
+	}
+	availability := availabilityTopic(b.cfg.TopicPrefix)
+	state := b.stateTopic(id)
+	configs := map[string]interface{}{
+		fmt.Sprintf("%v/climate/ecobee_%v/config", b.cfg.DiscoveryPrefix, id): map[string]interface{}{
+			"name":                            t.Name,
+			"unique_id":                       "ecobee_" + id,
+			"device":                          device,
+			"availability_topic":              availability,
+			"modes":                           []string{"off", "heat", "cool", "heat_cool"},
+			"fan_modes":                       []string{"auto", "on"},
+			"temperature_unit":                b.unit(),
+			"precision":                       0.1,
+			"mode_state_topic":                state,
+			"mode_state_template":             "{{ value_json.mode }}",
+			"mode_command_topic":              b.commandTopic(id, "mode"),
+			"action_topic":                    state,
+			"action_template":                 "{{ value_json.action }}",
+			"fan_mode_state_topic":            state,
+			"fan_mode_state_template":         "{{ value_json.fan }}",
+			"fan_mode_command_topic":          b.commandTopic(id, "fan"),
+			"current_temperature_topic":       state,
+			"current_temperature_template":    "{{ value_json.current_temperature }}",
+			"current_humidity_topic":          state,
+			"current_humidity_template":       "{{ value_json.current_humidity }}",
+			"temperature_low_state_topic":     state,
+			"temperature_low_state_template":  "{{ value_json.target_temperature_low }}",
+			"temperature_low_command_topic":   b.commandTopic(id, "temperature_low"),
+			"temperature_high_state_topic":    state,
+			"temperature_high_state_template": "{{ value_json.target_temperature_high }}",
+			"temperature_high_command_topic":  b.commandTopic(id, "temperature_high"),
+		},
+		fmt.Sprintf("%v/button/ecobee_%v_resume/config", b.cfg.DiscoveryPrefix, id): map[string]interface{}{
+			"name":               t.Name + " Resume Program",
+			"unique_id":          "ecobee_" + id + "_resume",
+			"device":             device,
+			"availability_topic": availability,
+			"command_topic":      b.commandTopic(id, "resume"),
+			"payload_press":      "resume",
+		},
+	}
+	for i := range t.RemoteSensors {
+		s := &t.RemoteSensors[i]
+		sensorTopic := b.sensorStateTopic(id, s.ID)
+		oid := fmt.Sprintf("ecobee_%v_%v", id, objectID(s.ID))
+		if _, err := s.Temperature(); err == nil {
+			configs[fmt.Sprintf("%v/sensor/%v_temperature/config", b.cfg.DiscoveryPrefix, oid)] = map[string]interface{}{
+				"name":                s.Name + " Temperature",
+				"unique_id":           oid + "_temperature",
+				"device":              device,
+				"availability_topic":  availability,
+				"state_topic":         sensorTopic,
+				"value_template":      "{{ value_json.temperature }}",
+				"device_class":        "temperature",
+				"state_class":         "measurement",
+				"unit_of_measurement": "°" + b.unit(),
+			}
+		}
+		if _, err := s.Humidity(); err == nil {
+			configs[fmt.Sprintf("%v/sensor/%v_humidity/config", b.cfg.DiscoveryPrefix, oid)] = map[string]interface{}{
+				"name":                s.Name + " Humidity",
+				"unique_id":           oid + "_humidity",
+				"device":              device,
+				"availability_topic":  availability,
+				"state_topic":         sensorTopic,
+				"value_template":      "{{ value_json.humidity }}",
+				"device_class":        "humidity",
+				"state_class":         "measurement",
+				"unit_of_measurement": "%",
+			}
+		}
+		if _, err := s.Occupancy(); err == nil {
+			configs[fmt.Sprintf("%v/binary_sensor/%v_occupancy/config", b.cfg.DiscoveryPrefix, oid)] = map[string]interface{}{
+				"name":               s.Name + " Occupancy",
+				"unique_id":          oid + "_occupancy",
+				"device":             device,
+				"availability_topic": availability,
+				"state_topic":        sensorTopic,
+				"value_template":     "{{ 'ON' if value_json.occupancy else 'OFF' }}",
+				"device_class":       "occupancy",
+			}
+		}
+	}
+
+	for topic, config := range configs {
+		if b.announced[topic] {
+			continue
+		}
+		payload, err := json.Marshal(config)
+		if err != nil {
+			return err
+		}
+		if err := b.mqtt.Publish(topic, payload, true); err != nil {
+			return err
+		}
+		b.announced[topic] = true
+	}
+	return nil
+}
+
+// hold returns the parameters for a hold on t, which maintains its current
+// setpoints until they are changed.
+func (b *bridge) hold(t *egobee.Thermostat) egobee.SetHoldParams {
+	p := egobee.SetHoldParams{
+		HeatHoldTemp: t.Runtime.DesiredHeat,
+		CoolHoldTemp: t.Runtime.DesiredCool,
+		HoldType:     b.cfg.HoldType,
+	}
+	if p.HoldType == egobee.HoldTypeHoldHours {
+		p.HoldHours = b.cfg.HoldHours
+	}
+	return p
+}
+
+// perform cmd on its thermostat, and publish the resulting state.
+func (b *bridge) perform(ctx context.Context, cmd command) error {
+	t, ok := b.thermostats[cmd.thermostatID]
+	if !ok {
+		return fmt.Errorf("unknown thermostat")
+	}
+	sel := &egobee.Selection{
+		SelectionType:  egobee.SelectionTypeThermostats,
+		SelectionMatch: cmd.thermostatID,
+	}
+	hold := b.hold(t)
+
+	var err error
+	switch cmd.name {
+	case "mode":
+		mode, ok := ecobeeModes[cmd.payload]
+		if !ok {
+			return fmt.Errorf("invalid mode %q", cmd.payload)
+		}
+		p := egobee.NewThermostatPatch()
+		if err := p.Set("settings.hvacMode", mode); err != nil {
+			return err
+		}
+		err = b.c.UpdateThermostatContext(ctx, sel, p)
+	case "temperature_low":
+		if hold.HeatHoldTemp, err = b.parseTemperature(cmd.payload); err != nil {
+			return err
+		}
+		err = b.c.UpdateThermostatsContext(ctx, sel, egobee.SetHold(hold))
+	case "temperature_high":
+		if hold.CoolHoldTemp, err = b.parseTemperature(cmd.payload); err != nil {
+			return err
+		}
+		err = b.c.UpdateThermostatsContext(ctx, sel, egobee.SetHold(hold))
+	case "fan":
+		if cmd.payload != "auto" && cmd.payload != "on" {
+			return fmt.Errorf("invalid fan mode %q", cmd.payload)
+		}
+		hold.Fan = cmd.payload
+		err = b.c.UpdateThermostatsContext(ctx, sel, egobee.SetHold(hold))
+	case "resume":
+		err = b.c.UpdateThermostatsContext(ctx, sel, egobee.ResumeProgram(true))
+	default:
+		return fmt.Errorf("unknown command")
+	}
+	if err != nil {
+		return err
+	}
+
+	// Publish the result immediately, rather than waiting for the next poll.
+	refresh := bridgeSelection
+	refresh.SelectionType, refresh.SelectionMatch = sel.SelectionType, sel.SelectionMatch
+	thermostats, err := b.c.ThermostatsContext(ctx, &refresh)
+	if err != nil {
+		return err
+	}
+	for _, t := range thermostats {
+		if err := b.publish(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
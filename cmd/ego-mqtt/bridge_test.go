@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cfunkhouser/egobee"
+	"github.com/cfunkhouser/egobee/egobeetest"
+)
+
+func TestAction(t *testing.T) {
+	for _, tt := range []struct {
+		mode, equipment string
+		want            string
+	}{
+		{"off", "", "off"},
+		{"heat", "", "idle"},
+		{"heat", "auxHeat1,fan", "heating"},
+		{"heat", "heatPump", "heating"},
+		{"cool", "heatPump", "cooling"},
+		{"auto", "compCool1,fan", "cooling"},
+		{"auto", "fan", "fan"},
+	} {
+		th := &egobee.Thermostat{EquipmentStatus: tt.equipment, Settings: egobee.Settings{HVACMode: tt.mode}}
+		if got := action(th); got != tt.want {
+			t.Errorf("action(%q, %q): got %q, want %q", tt.mode, tt.equipment, got, tt.want)
+		}
+	}
+}
+
+func TestBridgeTemperatures(t *testing.T) {
+	f := newBridge(nil, nil, bridgeConfig{})
+	c := newBridge(nil, nil, bridgeConfig{Celsius: true})
+	if got := f.temperature(705); got != 70.5 {
+		t.Errorf("got %v°F, want 70.5", got)
+	}
+	if got := c.temperature(705); got != 21.4 {
+		t.Errorf("got %v°C, want 21.4", got)
+	}
+	if got, err := c.parseTemperature("21.5"); err != nil || got != 707 {
+		t.Errorf("got %v, %v; want 707", got, err)
+	}
+	if _, err := f.parseTemperature("warm"); err == nil {
+		t.Error("expected error for invalid temperature, got nil")
+	}
+}
+
+func TestBridgeConfigValidate(t *testing.T) {
+	for _, tt := range []struct {
+		cfg     bridgeConfig
+		wantErr bool
+	}{
+		{bridgeConfig{}, false},
+		{bridgeConfig{HoldType: egobee.HoldTypeIndefinite}, false},
+		{bridgeConfig{HoldType: egobee.HoldTypeHoldHours, HoldHours: 2}, false},
+		{bridgeConfig{HoldType: egobee.HoldTypeHoldHours}, true},
+		{bridgeConfig{HoldType: egobee.HoldTypeDateTime}, true},
+		{bridgeConfig{HoldType: "forever"}, true},
+	} {
+		if err := tt.cfg.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%v for %v hours: got error %v, want error: %v", tt.cfg.HoldType, tt.cfg.HoldHours, err, tt.wantErr)
+		}
+	}
+}
+
+func TestBridgeHold(t *testing.T) {
+	th := &egobee.Thermostat{Runtime: egobee.Runtime{DesiredHeat: 680, DesiredCool: 760}}
+	for _, tt := range []struct {
+		cfg  bridgeConfig
+		want egobee.SetHoldParams
+	}{
+		{
+			bridgeConfig{},
+			egobee.SetHoldParams{HeatHoldTemp: 680, CoolHoldTemp: 760, HoldType: egobee.HoldTypeNextTransition},
+		},
+		{
+			bridgeConfig{HoldType: egobee.HoldTypeHoldHours, HoldHours: 3},
+			egobee.SetHoldParams{HeatHoldTemp: 680, CoolHoldTemp: 760, HoldType: egobee.HoldTypeHoldHours, HoldHours: 3},
+		},
+		{
+			bridgeConfig{HoldType: egobee.HoldTypeIndefinite, HoldHours: 3},
+			egobee.SetHoldParams{HeatHoldTemp: 680, CoolHoldTemp: 760, HoldType: egobee.HoldTypeIndefinite},
+		},
+	} {
+		if got := newBridge(nil, nil, tt.cfg).hold(th); got != tt.want {
+			t.Errorf("got %+v, want %+v", got, tt.want)
+		}
+	}
+}
+
+// waitFor waits until cond is true.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %v", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForRetained waits until the message retained on topic satisfies ok.
+func waitForRetained(t *testing.T, b *testBroker, topic string, v interface{}, ok func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if p, found := b.Retained(topic); found {
+			if err := json.Unmarshal(p, v); err == nil && ok() {
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			p, _ := b.Retained(topic)
+			t.Fatalf("timed out waiting for %v; last retained %q", topic, p)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBridge(t *testing.T) {
+	defer fastReconnect()()
+	s := egobeetest.NewServer(&egobee.Thermostat{
+		Identifier:      "123",
+		Name:            "Main Floor",
+		ModelNumber:     "athenaSmart",
+		EquipmentStatus: "auxHeat1",
+		Runtime: egobee.Runtime{
+			Connected:         true,
+			ActualTemperature: 695,
+			ActualHumidity:    40,
+			DesiredHeat:       700,
+			DesiredCool:       780,
+			DesiredFanMode:    "auto",
+		},
+		Settings: egobee.Settings{HVACMode: "heat"},
+		RemoteSensors: []egobee.RemoteSensor{{
+			ID:   "rs:100",
+			Name: "Bedroom",
+			Type: "ecobee3_remote_sensor",
+			Capability: []egobee.RemoteSensorCapability{
+				{Type: egobee.CapabilityTypeTemperature, Value: "662"},
+				{Type: egobee.CapabilityTypeOccupancy, Value: "true"},
+			},
+		}},
+	})
+	defer s.Close()
+	b := newTestBroker(t)
+	defer b.Close()
+
+	mqtt, err := dialMQTTSession(b.Addr(), &mqttOptions{
+		ClientID:    "ego-mqtt",
+		WillTopic:   availabilityTopic("ecobee"),
+		WillPayload: []byte("offline"),
+	})
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer mqtt.Close()
+	br := newBridge(s.Client(), mqtt, bridgeConfig{TopicPrefix: "ecobee", DiscoveryPrefix: "homeassistant"})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- br.run(ctx) }()
+
+	var state thermostatState
+	waitForRetained(t, b, "ecobee/123/state", &state, func() bool { return state.Connected })
+	want := thermostatState{
+		Mode:               "heat",
+		Action:             "heating",
+		Fan:                "auto",
+		CurrentTemperature: 69.5,
+		TargetLow:          70,
+		TargetHigh:         78,
+		CurrentHumidity:    40,
+		Connected:          true,
+	}
+	if state != want {
+		t.Errorf("got state %+v, want %+v", state, want)
+	}
+	var sensor sensorState
+	waitForRetained(t, b, "ecobee/123/sensor/rs_100/state", &sensor, func() bool { return true })
+	if sensor.Temperature == nil || *sensor.Temperature != 66.2 || sensor.Occupancy == nil || !*sensor.Occupancy || sensor.Humidity != nil {
+		t.Errorf("got unexpected sensor state %+v", sensor)
+	}
+	if p, _ := b.Retained("ecobee/status"); string(p) != "online" {
+		t.Errorf("got availability %q, want online", p)
+	}
+
+	// Discovery for the climate entity, resume button, and sensor entities
+	// which the sensor supports.
+	var climate map[string]interface{}
+	waitForRetained(t, b, "homeassistant/climate/ecobee_123/config", &climate, func() bool { return true })
+	for k, v := range map[string]interface{}{
+		"unique_id":                     "ecobee_123",
+		"mode_command_topic":            "ecobee/123/mode/set",
+		"temperature_low_command_topic": "ecobee/123/temperature_low/set",
+		"availability_topic":            "ecobee/status",
+		"temperature_unit":              "F",
+	} {
+		if climate[k] != v {
+			t.Errorf("got climate %v %v, want %v", k, climate[k], v)
+		}
+	}
+	for _, topic := range []string{
+		"homeassistant/button/ecobee_123_resume/config",
+		"homeassistant/sensor/ecobee_123_rs_100_temperature/config",
+		"homeassistant/binary_sensor/ecobee_123_rs_100_occupancy/config",
+	} {
+		if _, ok := b.Retained(topic); !ok {
+			t.Errorf("no discovery payload on %v", topic)
+		}
+	}
+	if _, ok := b.Retained("homeassistant/sensor/ecobee_123_rs_100_humidity/config"); ok {
+		t.Error("got discovery payload for unsupported humidity sensor")
+	}
+
+	// Losing the connection marks the bridge offline until it reconnects, and
+	// then republishes its state.
+	b.Drop()
+	waitFor(t, "reconnection", func() bool { return len(b.Clients()) == 2 })
+	waitFor(t, "online availability", func() bool {
+		p, _ := b.Retained("ecobee/status")
+		return string(p) == "online"
+	})
+
+	// Commands, which are received over the restored subscription.
+	o, _ := subscribe(t, b, "unused")
+	defer o.Close()
+	o.Publish("ecobee/123/temperature_low/set", []byte("68"), false)
+	waitForRetained(t, b, "ecobee/123/state", &state, func() bool { return state.TargetLow == 68 })
+	if got := s.Thermostat("123").Runtime.DesiredHeat; got != 680 {
+		t.Errorf("got DesiredHeat %v, want 680", got)
+	}
+	if state.TargetHigh != 78 {
+		t.Errorf("got TargetHigh %v, want 78", state.TargetHigh)
+	}
+
+	o.Publish("ecobee/123/mode/set", []byte("heat_cool"), false)
+	waitForRetained(t, b, "ecobee/123/state", &state, func() bool { return state.Mode == "heat_cool" })
+	if got := s.Thermostat("123").Settings.HVACMode; got != "auto" {
+		t.Errorf("got HVACMode %q, want auto", got)
+	}
+
+	o.Publish("ecobee/123/fan/set", []byte("on"), false)
+	waitFor(t, "fan hold", func() bool {
+		th := s.Thermostat("123")
+		return len(th.Events) > 0 && th.Events[0].Fan == "on"
+	})
+
+	o.Publish("ecobee/123/resume/set", []byte("resume"), false)
+	waitFor(t, "program to resume", func() bool { return len(s.Thermostat("123").Events) == 0 })
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	waitFor(t, "offline availability", func() bool {
+		p, _ := b.Retained("ecobee/status")
+		return string(p) == "offline"
+	})
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"testing"
+)
+
+// testBroker is a minimal in-process MQTT broker for tests. It supports QoS 0
+// publishing, subscriptions with retained messages, keepalive and wills.
+type testBroker struct {
+	t  *testing.T
+	ln net.Listener
+
+	mu       sync.Mutex
+	conns    map[*brokerConn]bool
+	retained map[string][]byte
+	clients  []string // IDs of clients which have connected, in order
+}
+
+type brokerConn struct {
+	conn        net.Conn
+	wmu         sync.Mutex
+	mu          sync.Mutex
+	filters     []string
+	willTopic   string
+	willPayload []byte
+}
+
+func (c *brokerConn) write(p *packet) {
+	b, _ := p.encode()
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.conn.Write(b)
+}
+
+func (c *brokerConn) subscribed(topic string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range c.filters {
+		if topicMatches(f, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+func newTestBroker(t *testing.T) *testBroker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	b := &testBroker{
+		t:        t,
+		ln:       ln,
+		conns:    make(map[*brokerConn]bool),
+		retained: make(map[string][]byte),
+	}
+	go b.serve()
+	return b
+}
+
+func (b *testBroker) Addr() string {
+	return b.ln.Addr().String()
+}
+
+// Close the broker, dropping every connection without publishing wills.
+func (b *testBroker) Close() {
+	b.ln.Close()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.conns {
+		c.willTopic = ""
+		c.conn.Close()
+	}
+}
+
+// Drop every connection, as if the network failed, so that wills are
+// published.
+func (b *testBroker) Drop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.conns {
+		c.conn.Close()
+	}
+}
+
+// Clients returns the IDs of the clients which have connected, in order.
+func (b *testBroker) Clients() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.clients...)
+}
+
+// Retained returns the message retained on topic, if any.
+func (b *testBroker) Retained(topic string) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p, ok := b.retained[topic]
+	return p, ok
+}
+
+func (b *testBroker) serve() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+func (b *testBroker) handle(conn net.Conn) {
+	c := &brokerConn{conn: conn}
+	r := bufio.NewReader(conn)
+	p, err := readPacket(r)
+	if err != nil || p.typ != packetConnect || !b.connect(c, p) {
+		conn.Close()
+		return
+	}
+	b.mu.Lock()
+	b.conns[c] = true
+	b.mu.Unlock()
+	c.write(&packet{typ: packetConnack, body: []byte{0, 0}})
+
+	clean := false
+	defer func() {
+		conn.Close()
+		b.mu.Lock()
+		delete(b.conns, c)
+		willTopic := c.willTopic
+		b.mu.Unlock()
+		if !clean && willTopic != "" {
+			b.publish(willTopic, c.willPayload, true)
+		}
+	}()
+	for {
+		p, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		switch p.typ {
+		case packetPublish:
+			topic, payload, err := parsePublish(p)
+			if err != nil {
+				b.t.Errorf("broker received bad PUBLISH: %v", err)
+				return
+			}
+			b.publish(topic, payload, p.flags&0x01 != 0)
+		case packetSubscribe:
+			if len(p.body) < 2 {
+				b.t.Errorf("broker received bad SUBSCRIBE")
+				return
+			}
+			ack := []byte{p.body[0], p.body[1]}
+			rest := p.body[2:]
+			var filters []string
+			for len(rest) > 0 {
+				var filter string
+				if filter, rest, err = readString(rest); err != nil || len(rest) < 1 {
+					b.t.Errorf("broker received bad SUBSCRIBE")
+					return
+				}
+				rest = rest[1:]
+				filters = append(filters, filter)
+				ack = append(ack, 0) // granted QoS 0
+			}
+			c.mu.Lock()
+			c.filters = append(c.filters, filters...)
+			c.mu.Unlock()
+			c.write(&packet{typ: packetSuback, body: ack})
+			b.mu.Lock()
+			var retained []*packet
+			for topic, payload := range b.retained {
+				for _, f := range filters {
+					if topicMatches(f, topic) {
+						retained = append(retained, publishPacket(topic, payload, true))
+						break
+					}
+				}
+			}
+			b.mu.Unlock()
+			for _, p := range retained {
+				c.write(p)
+			}
+		case packetPingreq:
+			c.write(&packet{typ: packetPingresp})
+		case packetDisconnect:
+			clean = true
+			return
+		default:
+			b.t.Errorf("broker received unexpected packet type %v", p.typ)
+			return
+		}
+	}
+}
+
+// connect parses a CONNECT packet into c.
+func (b *testBroker) connect(c *brokerConn, p *packet) bool {
+	proto, rest, err := readString(p.body)
+	if err != nil || proto != "MQTT" || len(rest) < 4 {
+		return false
+	}
+	flags := rest[1]
+	rest = rest[4:]
+	var id string
+	if id, rest, err = readString(rest); err != nil {
+		return false
+	}
+	if flags&0x04 != 0 {
+		var payload string
+		if c.willTopic, rest, err = readString(rest); err != nil {
+			return false
+		}
+		if payload, rest, err = readString(rest); err != nil {
+			return false
+		}
+		c.willPayload = []byte(payload)
+	}
+	b.mu.Lock()
+	b.clients = append(b.clients, id)
+	b.mu.Unlock()
+	return true
+}
+
+func (b *testBroker) publish(topic string, payload []byte, retain bool) {
+	b.mu.Lock()
+	if retain {
+		if len(payload) == 0 {
+			delete(b.retained, topic)
+		} else {
+			b.retained[topic] = payload
+		}
+	}
+	var subscribers []*brokerConn
+	for c := range b.conns {
+		if c.subscribed(topic) {
+			subscribers = append(subscribers, c)
+		}
+	}
+	b.mu.Unlock()
+	for _, c := range subscribers {
+		c.write(publishPacket(topic, payload, false))
+	}
+}
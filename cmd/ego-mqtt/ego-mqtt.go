@@ -0,0 +1,103 @@
+// ego-mqtt publishes the state of all registered thermostats and their sensors
+// to an MQTT broker, along with Home Assistant discovery payloads, and performs
+// commands received on MQTT topics:
+//
+//	<prefix>/<thermostat>/mode/set              off, heat, cool or heat_cool
+//	<prefix>/<thermostat>/temperature_low/set   heat setpoint
+//	<prefix>/<thermostat>/temperature_high/set  cool setpoint
+//	<prefix>/<thermostat>/fan/set               auto or on
+//	<prefix>/<thermostat>/resume/set            any payload
+//
+// Setpoint and fan commands create holds of the type given by --hold, which is
+// nextTransition, indefinite or holdHours. Holds of type holdHours last for
+// --hold_hours.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/cfunkhouser/egobee"
+)
+
+var (
+	appID     = flag.String("app", "", "Ecobee Registered App ID")
+	storePath = flag.String("store", "/tmp/ego-mqtt", "Persistent egobee credential store path")
+	broker    = flag.String("broker", "localhost:1883", "Address of the MQTT broker")
+	username  = flag.String("username", "", "MQTT username")
+	password  = flag.String("password", os.Getenv("EGO_MQTT_PASSWORD"), "MQTT password; defaults to $EGO_MQTT_PASSWORD")
+	clientID  = flag.String("client_id", "ego-mqtt", "MQTT client ID")
+	prefix    = flag.String("prefix", "ecobee", "Topic prefix for state and commands")
+	discovery = flag.String("discovery_prefix", "homeassistant", "Home Assistant discovery topic prefix")
+	celsius   = flag.Bool("celsius", false, "Publish and accept temperatures in Celsius")
+	hold      = flag.String("hold", string(egobee.HoldTypeNextTransition), "Type of hold created by commands: nextTransition, indefinite or holdHours")
+	holdHours = flag.Int("hold_hours", 2, "Duration in hours of holds when --hold is holdHours")
+	interval  = flag.Duration("interval", egobee.MinWatchInterval, "Interval at which to poll the thermostat summary")
+)
+
+func main() {
+	flag.Parse()
+	if *appID == "" {
+		log.Fatal("--app is required.")
+	}
+	if *storePath == "" {
+		log.Fatal("--store is required")
+	}
+	cfg := bridgeConfig{
+		TopicPrefix:     *prefix,
+		DiscoveryPrefix: *discovery,
+		Celsius:         *celsius,
+		HoldType:        egobee.HoldType(*hold),
+		HoldHours:       *holdHours,
+		Watcher:         egobee.WatcherOptions{Interval: *interval},
+	}
+	if err := cfg.validate(); err != nil {
+		log.Fatalf("Invalid --hold: %v", err)
+	}
+	if *password != "" && *username == "" {
+		log.Fatal("--password, or $EGO_MQTT_PASSWORD, requires --username")
+	}
+
+	ts, err := egobee.NewPersistentTokenFromDisk(*storePath)
+	if err != nil {
+		log.Fatalf("Failed to initialize store %q: %v", *storePath, err)
+	}
+	c := egobee.New(*appID, ts)
+
+	mqtt, err := dialMQTTSession(*broker, &mqttOptions{
+		ClientID:    *clientID,
+		Username:    *username,
+		Password:    *password,
+		KeepAlive:   time.Minute,
+		WillTopic:   availabilityTopic(*prefix),
+		WillPayload: []byte("offline"),
+	})
+	if err != nil {
+		log.Fatalf("Failed to connect to %v: %v", *broker, err)
+	}
+
+	// Stop on a signal, so that the bridge publishes that it is offline and
+	// disconnects cleanly.
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	b := newBridge(c, mqtt, cfg)
+	log.Printf("Bridging thermostats to %v under %v/", *broker, *prefix)
+	err = b.run(ctx)
+	// log.Fatal would skip this, and so the DISCONNECT.
+	mqtt.Close()
+	if err != nil && err != context.Canceled {
+		log.Printf("Bridge failed: %v", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,555 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// This file implements the small subset of MQTT 3.1.1 needed by the bridge:
+// connecting with a will, publishing and subscribing at QoS 0, keepalive, and
+// reconnecting when the connection is lost.
+// See http://docs.oasis-open.org/mqtt/mqtt/v3.1.1/os/mqtt-v3.1.1-os.html
+
+// MQTT control packet types.
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetSubscribe  = 8
+	packetSuback     = 9
+	packetPingreq    = 12
+	packetPingresp   = 13
+	packetDisconnect = 14
+)
+
+// maxRemainingLength is the largest packet body MQTT can encode.
+const maxRemainingLength = 268435455
+
+// packet is an MQTT control packet.
+type packet struct {
+	typ   byte
+	flags byte
+	body  []byte
+}
+
+// readPacket reads one packet from r.
+func readPacket(r *bufio.Reader) (*packet, error) {
+	h, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	var length, shift uint
+	for i := 0; ; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		length |= uint(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return nil, errors.New("malformed remaining length")
+		}
+		shift += 7
+	}
+	p := &packet{typ: h >> 4, flags: h & 0x0f, body: make([]byte, length)}
+	if _, err := io.ReadFull(r, p.body); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// encode p for the wire.
+func (p *packet) encode() ([]byte, error) {
+	n := len(p.body)
+	if n > maxRemainingLength {
+		return nil, fmt.Errorf("packet of %v bytes is too large", n)
+	}
+	b := []byte{p.typ<<4 | p.flags}
+	for {
+		d := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			d |= 0x80
+		}
+		b = append(b, d)
+		if n == 0 {
+			break
+		}
+	}
+	return append(b, p.body...), nil
+}
+
+// appendString appends s with its length prefix.
+func appendString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
+
+// readString reads a length-prefixed string from the front of b.
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errors.New("malformed string")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, errors.New("malformed string")
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
+
+// publishPacket returns a QoS 0 PUBLISH packet.
+func publishPacket(topic string, payload []byte, retain bool) *packet {
+	p := &packet{typ: packetPublish, body: append(appendString(nil, topic), payload...)}
+	if retain {
+		p.flags = 0x01
+	}
+	return p
+}
+
+// parsePublish returns the topic and payload of a PUBLISH packet. Packets with
+// QoS above 0 are rejected, as they are never requested.
+func parsePublish(p *packet) (topic string, payload []byte, err error) {
+	if qos := (p.flags >> 1) & 0x03; qos != 0 {
+		return "", nil, fmt.Errorf("unsupported QoS %v", qos)
+	}
+	topic, payload, err = readString(p.body)
+	return
+}
+
+// topicMatches reports whether topic matches the subscription filter, which
+// may contain the + and # wildcards.
+func topicMatches(filter, topic string) bool {
+	f, t := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, level := range f {
+		if level == "#" {
+			return true
+		}
+		if i >= len(t) || (level != "+" && level != t[i]) {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
+
+// mqttOptions configure an MQTT connection.
+type mqttOptions struct {
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration
+	// WillTopic, if set, receives WillPayload, retained, if the connection is
+	// lost without disconnecting.
+	WillTopic   string
+	WillPayload []byte
+}
+
+// mqttHandler is called with messages received on a subscription.
+type mqttHandler func(topic string, payload []byte)
+
+type subscription struct {
+	filter  string
+	handler mqttHandler
+}
+
+// mqttClient is a connection to an MQTT broker.
+type mqttClient struct {
+	conn      net.Conn
+	keepAlive time.Duration
+
+	wmu sync.Mutex // serializes writes to conn
+
+	mu       sync.Mutex // protects the following members
+	subs     []subscription
+	packetID uint16
+	acks     map[uint16]chan []byte
+	err      error // why the connection closed
+
+	done chan struct{}
+}
+
+// dialMQTT connects to the broker at addr.
+func dialMQTT(addr string, opts *mqttOptions) (*mqttClient, error) {
+	// MQTT 3.1.1 forbids a password without a user name, and brokers may drop
+	// the connection.
+	if opts.Password != "" && opts.Username == "" {
+		return nil, errors.New("an MQTT password requires a username")
+	}
+	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := byte(0x02) // clean session
+	body := appendString(nil, "MQTT")
+	var payload []byte
+	payload = appendString(payload, opts.ClientID)
+	if opts.WillTopic != "" {
+		flags |= 0x04 | 0x20 // will, retained
+		payload = appendString(payload, opts.WillTopic)
+		payload = appendString(payload, string(opts.WillPayload))
+	}
+	if opts.Username != "" {
+		flags |= 0x80
+		payload = appendString(payload, opts.Username)
+	}
+	if opts.Password != "" {
+		flags |= 0x40
+		payload = appendString(payload, opts.Password)
+	}
+	keepAlive := int(opts.KeepAlive / time.Second)
+	body = append(body, 4, flags, byte(keepAlive>>8), byte(keepAlive))
+	body = append(body, payload...)
+
+	c := &mqttClient{
+		conn:      conn,
+		keepAlive: opts.KeepAlive,
+		acks:      make(map[uint16]chan []byte),
+		done:      make(chan struct{}),
+	}
+	if err := c.write(&packet{typ: packetConnect, body: body}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	p, err := readPacket(r)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read CONNACK: %v", err)
+	}
+	conn.SetReadDeadline(time.Time{})
+	if p.typ != packetConnack || len(p.body) != 2 {
+		conn.Close()
+		return nil, errors.New("broker did not acknowledge connection")
+	}
+	if rc := p.body[1]; rc != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("broker refused connection with return code %v", rc)
+	}
+
+	go c.read(r)
+	if opts.KeepAlive > 0 {
+		go c.ping(opts.KeepAlive)
+	}
+	return c, nil
+}
+
+func (c *mqttClient) write(p *packet) error {
+	b, err := p.encode()
+	if err != nil {
+		return err
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err = c.conn.Write(b)
+	return err
+}
+
+// read packets until the connection closes, dispatching messages to handlers.
+func (c *mqttClient) read(r *bufio.Reader) {
+	var err error
+	defer func() {
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+		close(c.done)
+		c.conn.Close()
+	}()
+	for {
+		if c.keepAlive > 0 {
+			// Pings are sent every half interval, so a broker which has not
+			// answered within one and a half has gone away.
+			c.conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2))
+		}
+		var p *packet
+		if p, err = readPacket(r); err != nil {
+			return
+		}
+		switch p.typ {
+		case packetPublish:
+			topic, payload, perr := parsePublish(p)
+			if perr != nil {
+				err = perr
+				return
+			}
+			c.mu.Lock()
+			var handlers []mqttHandler
+			for _, s := range c.subs {
+				if topicMatches(s.filter, topic) {
+					handlers = append(handlers, s.handler)
+				}
+			}
+			c.mu.Unlock()
+			for _, h := range handlers {
+				h(topic, payload)
+			}
+		case packetSuback:
+			if len(p.body) < 2 {
+				err = errors.New("malformed SUBACK")
+				return
+			}
+			id := binary.BigEndian.Uint16(p.body)
+			c.mu.Lock()
+			if ch, ok := c.acks[id]; ok {
+				ch <- p.body[2:]
+				delete(c.acks, id)
+			}
+			c.mu.Unlock()
+		case packetPingresp:
+		default:
+			err = fmt.Errorf("unexpected packet type %v", p.typ)
+			return
+		}
+	}
+}
+
+func (c *mqttClient) ping(interval time.Duration) {
+	t := time.NewTicker(interval / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-t.C:
+			if err := c.write(&packet{typ: packetPingreq}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Publish payload to topic at QoS 0.
+func (c *mqttClient) Publish(topic string, payload []byte, retain bool) error {
+	return c.write(publishPacket(topic, payload, retain))
+}
+
+// Subscribe to filter at QoS 0, calling handler with each message received.
+// Handlers are called on the connection's reading goroutine, so must not
+// block for long.
+func (c *mqttClient) Subscribe(filter string, handler mqttHandler) error {
+	c.mu.Lock()
+	c.packetID++
+	if c.packetID == 0 {
+		c.packetID++
+	}
+	id := c.packetID
+	ack := make(chan []byte, 1)
+	c.acks[id] = ack
+	c.subs = append(c.subs, subscription{filter, handler})
+	c.mu.Unlock()
+
+	body := []byte{byte(id >> 8), byte(id)}
+	body = appendString(body, filter)
+	body = append(body, 0) // QoS 0
+	if err := c.write(&packet{typ: packetSubscribe, flags: 0x02, body: body}); err != nil {
+		return err
+	}
+	select {
+	case codes := <-ack:
+		if len(codes) != 1 || codes[0] == 0x80 {
+			return fmt.Errorf("broker refused subscription to %q", filter)
+		}
+		return nil
+	case <-c.done:
+		return c.Err()
+	case <-time.After(10 * time.Second):
+		return fmt.Errorf("timed out subscribing to %q", filter)
+	}
+}
+
+// Done is closed when the connection is lost.
+func (c *mqttClient) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the reason the connection was lost, once Done is closed.
+func (c *mqttClient) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		return errors.New("connection closed")
+	}
+	return c.err
+}
+
+// Close disconnects cleanly, so that the will is not published.
+func (c *mqttClient) Close() error {
+	c.write(&packet{typ: packetDisconnect})
+	return c.conn.Close()
+}
+
+// Delays between attempts to reconnect, overrideable for testing.
+var (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 2 * time.Minute
+)
+
+// errNotConnected is returned by mqttSession.Publish while reconnecting.
+var errNotConnected = errors.New("not connected to broker")
+
+// mqttSession maintains a connection to a broker. When the connection is lost,
+// it reconnects with exponential backoff and restores its subscriptions.
+type mqttSession struct {
+	addr string
+	opts *mqttOptions
+
+	smu sync.Mutex // serializes subscribing with reconnecting
+
+	mu     sync.Mutex  // protects the following members
+	conn   *mqttClient // nil while reconnecting
+	subs   []subscription
+	closed bool
+
+	reconnected chan struct{}
+	done        chan struct{} // closed by Close
+}
+
+// dialMQTTSession connects to the broker at addr. The first connection must
+// succeed, so that misconfiguration is reported immediately.
+func dialMQTTSession(addr string, opts *mqttOptions) (*mqttSession, error) {
+	c, err := dialMQTT(addr, opts)
+	if err != nil {
+		return nil, err
+	}
+	s := &mqttSession{
+		addr:        addr,
+		opts:        opts,
+		conn:        c,
+		reconnected: make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+	go s.maintain(c)
+	return s, nil
+}
+
+// maintain the connection, starting with c, until the session is closed.
+func (s *mqttSession) maintain(c *mqttClient) {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-c.Done():
+		}
+		log.Printf("Lost connection to %v: %v", s.addr, c.Err())
+		s.mu.Lock()
+		s.conn = nil
+		s.mu.Unlock()
+		if c = s.reconnect(); c == nil {
+			return
+		}
+		log.Printf("Reconnected to %v", s.addr)
+		select {
+		case s.reconnected <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// reconnect until it succeeds, returning the new connection, or nil if the
+// session is closed first.
+func (s *mqttSession) reconnect() *mqttClient {
+	delay := minReconnectDelay
+	for {
+		select {
+		case <-s.done:
+			return nil
+		case <-time.After(delay):
+		}
+		c, err := s.connect()
+		if err == nil {
+			return c
+		}
+		log.Printf("Failed to reconnect to %v: %v", s.addr, err)
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// connect to the broker and restore the session's subscriptions.
+func (s *mqttSession) connect() (*mqttClient, error) {
+	s.smu.Lock()
+	defer s.smu.Unlock()
+	c, err := dialMQTT(s.addr, s.opts)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	subs := s.subs
+	s.mu.Unlock()
+	for _, sub := range subs {
+		if err := c.Subscribe(sub.filter, sub.handler); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		c.Close()
+		return nil, errors.New("session closed")
+	}
+	s.conn = c
+	return c, nil
+}
+
+// Publish payload to topic at QoS 0. It fails while the session is
+// reconnecting.
+func (s *mqttSession) Publish(topic string, payload []byte, retain bool) error {
+	s.mu.Lock()
+	c := s.conn
+	s.mu.Unlock()
+	if c == nil {
+		return errNotConnected
+	}
+	return c.Publish(topic, payload, retain)
+}
+
+// Subscribe to filter at QoS 0, now and after every reconnection. While the
+// session is reconnecting, the subscription is only recorded.
+func (s *mqttSession) Subscribe(filter string, handler mqttHandler) error {
+	s.smu.Lock()
+	defer s.smu.Unlock()
+	s.mu.Lock()
+	s.subs = append(s.subs, subscription{filter, handler})
+	c := s.conn
+	s.mu.Unlock()
+	if c == nil {
+		return nil
+	}
+	return c.Subscribe(filter, handler)
+}
+
+// Reconnected receives a value after the session reconnects and restores its
+// subscriptions. Messages published while it was disconnected were lost.
+func (s *mqttSession) Reconnected() <-chan struct{} {
+	return s.reconnected
+}
+
+// Close disconnects cleanly, so that the will is not published, and stops
+// reconnecting.
+func (s *mqttSession) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	c := s.conn
+	s.conn = nil
+	if c == nil {
+		return nil
+	}
+	return c.Close()
+}
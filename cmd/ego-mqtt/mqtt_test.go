@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestPacketEncoding(t *testing.T) {
+	for _, tt := range []struct {
+		length     int
+		headerSize int
+	}{
+		{0, 2},
+		{127, 2},
+		{128, 3},
+		{16383, 3},
+		{16384, 4},
+		{2097152, 5},
+	} {
+		p := &packet{typ: packetPublish, flags: 0x01, body: bytes.Repeat([]byte{'x'}, tt.length)}
+		b, err := p.encode()
+		if err != nil {
+			t.Fatalf("%v: got unexpected error: %v", tt.length, err)
+		}
+		if len(b) != tt.length+tt.headerSize {
+			t.Errorf("%v: got %v encoded bytes, want %v", tt.length, len(b), tt.length+tt.headerSize)
+		}
+		got, err := readPacket(bufio.NewReader(bytes.NewReader(b)))
+		if err != nil {
+			t.Fatalf("%v: got unexpected error: %v", tt.length, err)
+		}
+		if got.typ != p.typ || got.flags != p.flags || !bytes.Equal(got.body, p.body) {
+			t.Errorf("%v: packet changed in round trip", tt.length)
+		}
+	}
+	if _, err := readPacket(bufio.NewReader(bytes.NewReader([]byte{0x30, 0xff, 0xff, 0xff, 0xff}))); err == nil {
+		t.Error("expected error for malformed remaining length, got nil")
+	}
+}
+
+func TestTopicMatches(t *testing.T) {
+	for _, tt := range []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"ecobee/status", "ecobee/status", true},
+		{"ecobee/status", "ecobee/state", false},
+		{"ecobee/+/+/set", "ecobee/123/mode/set", true},
+		{"ecobee/+/+/set", "ecobee/123/state", false},
+		{"ecobee/+/+/set", "ecobee/123/sensor/rs_100/set", false},
+		{"ecobee/#", "ecobee/123/sensor/rs_100/state", true},
+		{"ecobee/#", "ecobee", true},
+		{"#", "anything/at/all", true},
+	} {
+		if got := topicMatches(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("topicMatches(%q, %q): got %v, want %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
+
+type message struct {
+	topic   string
+	payload string
+}
+
+// subscribe to filter on a new connection to b, returning the messages
+// received.
+func subscribe(t *testing.T, b *testBroker, filter string) (*mqttClient, <-chan message) {
+	c, err := dialMQTT(b.Addr(), &mqttOptions{ClientID: "observer"})
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	msgs := make(chan message, 100)
+	if err := c.Subscribe(filter, func(topic string, payload []byte) {
+		msgs <- message{topic, string(payload)}
+	}); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	return c, msgs
+}
+
+func receive(t *testing.T, msgs <-chan message) message {
+	select {
+	case m := <-msgs:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+	return message{}
+}
+
+func TestMQTTClient(t *testing.T) {
+	b := newTestBroker(t)
+	defer b.Close()
+
+	c, err := dialMQTT(b.Addr(), &mqttOptions{
+		ClientID:    "publisher",
+		KeepAlive:   100 * time.Millisecond,
+		WillTopic:   "test/status",
+		WillPayload: []byte("offline"),
+	})
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	if err := c.Publish("test/retained", []byte("kept"), true); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	o, msgs := subscribe(t, b, "test/#")
+	defer o.Close()
+	if got, want := receive(t, msgs), (message{"test/retained", "kept"}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if err := c.Publish("test/a", []byte("hello"), false); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if got, want := receive(t, msgs), (message{"test/a", "hello"}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Outlive a few keepalive intervals.
+	time.Sleep(300 * time.Millisecond)
+	select {
+	case <-c.Done():
+		t.Fatalf("connection lost: %v", c.Err())
+	default:
+	}
+
+	// Losing the connection publishes the will.
+	c.conn.Close()
+	<-c.Done()
+	if got, want := receive(t, msgs), (message{"test/status", "offline"}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestDialMQTTPasswordWithoutUsername(t *testing.T) {
+	b := newTestBroker(t)
+	defer b.Close()
+	if _, err := dialMQTT(b.Addr(), &mqttOptions{ClientID: "test", Password: "secret"}); err == nil {
+		t.Error("expected error for password without username, got nil")
+	}
+}
+
+// fastReconnect makes sessions reconnect quickly for the duration of a test.
+func fastReconnect() func() {
+	min, max := minReconnectDelay, maxReconnectDelay
+	minReconnectDelay, maxReconnectDelay = 10*time.Millisecond, 40*time.Millisecond
+	return func() { minReconnectDelay, maxReconnectDelay = min, max }
+}
+
+func TestMQTTSessionReconnects(t *testing.T) {
+	defer fastReconnect()()
+	b := newTestBroker(t)
+	defer b.Close()
+
+	s, err := dialMQTTSession(b.Addr(), &mqttOptions{
+		ClientID:    "session",
+		WillTopic:   "test/status",
+		WillPayload: []byte("offline"),
+	})
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer s.Close()
+	msgs := make(chan message, 100)
+	if err := s.Subscribe("test/commands", func(topic string, payload []byte) {
+		msgs <- message{topic, string(payload)}
+	}); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	b.Drop()
+	select {
+	case <-s.Reconnected():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting to reconnect")
+	}
+	if p, _ := b.Retained("test/status"); string(p) != "offline" {
+		t.Errorf("got status %q after losing the connection, want offline", p)
+	}
+	if got := b.Clients(); len(got) != 2 || got[1] != "session" {
+		t.Errorf("got clients %v, want session twice", got)
+	}
+	if err := s.Publish("test/status", []byte("online"), true); err != nil {
+		t.Errorf("got unexpected error publishing after reconnecting: %v", err)
+	}
+
+	// The subscription was restored.
+	o, _ := subscribe(t, b, "unused")
+	defer o.Close()
+	o.Publish("test/commands", []byte("hello"), false)
+	if got, want := receive(t, msgs), (message{"test/commands", "hello"}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Once closed, the session stays disconnected.
+	s.Close()
+	b.Drop()
+	time.Sleep(100 * time.Millisecond)
+	if got := b.Clients(); len(got) != 3 {
+		t.Errorf("got clients %v after closing the session, want no more reconnections", got)
+	}
+	if err := s.Publish("test/status", []byte("online"), true); err == nil {
+		t.Error("expected error publishing after closing, got nil")
+	}
+}
@@ -0,0 +1,731 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cfunkhouser/egobee"
+)
+
+// hvacModes accepted by the mode command.
+var hvacModes = []string{"auto", "auxHeatOnly", "cool", "heat", "off"}
+
+// selectThermostats returns a Selection of the thermostats with ids.
+func selectThermostats(ids []string) *egobee.Selection {
+	return &egobee.Selection{
+		SelectionType:  egobee.SelectionTypeThermostats,
+		SelectionMatch: strings.Join(ids, ","),
+	}
+}
+
+// temperature converts t to the configured units, rounded to a tenth.
+func (s *session) temperature(t egobee.Temperature) float64 {
+	v := t.Fahrenheit()
+	if s.cfg.get("units") == "C" {
+		v = t.Celsius()
+	}
+	return math.Round(v*10) / 10
+}
+
+func (s *session) formatTemperature(t egobee.Temperature) string {
+	return fmt.Sprintf("%.1f°%v", s.temperature(t), s.cfg.get("units"))
+}
+
+// parseTemperature parses a temperature in the configured units.
+func (s *session) parseTemperature(v string) (egobee.Temperature, error) {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid temperature %q", v)
+	}
+	if s.cfg.get("units") == "C" {
+		return egobee.FromCelsius(f), nil
+	}
+	return egobee.FromFahrenheit(f), nil
+}
+
+func authLogin(fs *flag.FlagSet) runner {
+	scope := fs.String("scope", string(egobee.ScopeSmartWrite), "Scope of the requested authorization")
+	return func(ctx context.Context, s *session, args []string) (view, error) {
+		if len(args) != 0 {
+			return nil, errUsage
+		}
+		app := s.cfg.get("app")
+		if app == "" {
+			return nil, errors.New("no app ID; set --app, $EGO_APP_ID or app in the config file")
+		}
+		pa := egobee.NewPinAuthorizer(app, egobee.Scope(*scope), clientOptions)
+		trr, err := pa.Authorize(ctx, func(pac *egobee.PinAuthenticationChallenge) error {
+			fmt.Fprintf(s.stderr, "Add an application with the PIN %v under My Apps in the ecobee portal.\n", pac.Pin)
+			fmt.Fprintf(s.stderr, "Waiting for authorization; the PIN expires in %v minutes.\n", pac.ExpiresIn)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to authorize: %v", err)
+		}
+		path := s.cfg.get("store")
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+		if _, err := egobee.NewPersistentTokenStore(trr, path); err != nil {
+			return nil, fmt.Errorf("failed to save credentials: %v", err)
+		}
+		return &message{fmt.Sprintf("Saved credentials to %v", path)}, nil
+	}
+}
+
+// authStatusView is the result of the auth status command.
+type authStatusView struct {
+	Store       string `json:"store"`
+	Authorized  bool   `json:"authorized"`
+	ValidFor    string `json:"validFor,omitempty"`
+	Thermostats int    `json:"thermostats"`
+	Error       string `json:"error,omitempty"`
+}
+
+func (v *authStatusView) writeTable(w io.Writer) error {
+	t := &table{}
+	t.add("Store:", v.Store)
+	t.add("Authorized:", v.Authorized)
+	if v.Authorized {
+		t.add("Access token valid for:", v.ValidFor)
+		t.add("Thermostats:", v.Thermostats)
+	}
+	if v.Error != "" {
+		t.add("Error:", v.Error)
+	}
+	return t.write(w)
+}
+
+func authStatus(fs *flag.FlagSet) runner {
+	return func(ctx context.Context, s *session, args []string) (view, error) {
+		if len(args) != 0 {
+			return nil, errUsage
+		}
+		v := &authStatusView{Store: s.cfg.get("store")}
+		app := s.cfg.get("app")
+		if app == "" {
+			return nil, errors.New("no app ID; set --app, $EGO_APP_ID or app in the config file")
+		}
+		ts, err := egobee.NewPersistentTokenFromDisk(v.Store)
+		if err != nil {
+			v.Error = err.Error()
+			return v, nil
+		}
+		// Retrieving the summary verifies the credentials, refreshing them if
+		// necessary.
+		summary, err := egobee.New(app, ts, clientOptions).ThermostatSummaryContext(ctx)
+		if err != nil {
+			v.Error = err.Error()
+			return v, nil
+		}
+		v.Authorized = true
+		v.ValidFor = ts.ValidFor().Round(time.Second).String()
+		v.Thermostats = summary.ThermostatCount
+		return v, nil
+	}
+}
+
+// thermostatEntry summarizes a thermostat in the list command.
+type thermostatEntry struct {
+	Identifier  string  `json:"identifier"`
+	Name        string  `json:"name"`
+	ModelNumber string  `json:"modelNumber"`
+	Connected   bool    `json:"connected"`
+	Mode        string  `json:"mode"`
+	Temperature float64 `json:"temperature"`
+	Humidity    int     `json:"humidity"`
+	DesiredHeat float64 `json:"desiredHeat"`
+	DesiredCool float64 `json:"desiredCool"`
+	Units       string  `json:"units"`
+}
+
+type listView []*thermostatEntry
+
+func (v listView) writeTable(w io.Writer) error {
+	t := &table{header: []string{"ID", "NAME", "MODE", "TEMPERATURE", "HUMIDITY", "HEAT", "COOL", "CONNECTED"}}
+	for _, e := range v {
+		deg := "°" + e.Units
+		t.add(e.Identifier, e.Name, e.Mode,
+			fmt.Sprintf("%.1f%v", e.Temperature, deg),
+			fmt.Sprintf("%v%%", e.Humidity),
+			fmt.Sprintf("%.1f%v", e.DesiredHeat, deg),
+			fmt.Sprintf("%.1f%v", e.DesiredCool, deg),
+			e.Connected)
+	}
+	return t.write(w)
+}
+
+func list(fs *flag.FlagSet) runner {
+	return func(ctx context.Context, s *session, args []string) (view, error) {
+		if len(args) != 0 {
+			return nil, errUsage
+		}
+		c, err := s.client()
+		if err != nil {
+			return nil, err
+		}
+		thermostats, err := c.ThermostatsContext(ctx, &egobee.Selection{
+			SelectionType:   egobee.SelectionTypeRegistered,
+			IncludeRuntime:  true,
+			IncludeSettings: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		v := listView{}
+		for _, t := range thermostats {
+			v = append(v, &thermostatEntry{
+				Identifier:  t.Identifier,
+				Name:        t.Name,
+				ModelNumber: t.ModelNumber,
+				Connected:   t.Runtime.Connected,
+				Mode:        t.Settings.HVACMode,
+				Temperature: s.temperature(t.Runtime.ActualTemperature),
+				Humidity:    t.Runtime.ActualHumidity,
+				DesiredHeat: s.temperature(t.Runtime.DesiredHeat),
+				DesiredCool: s.temperature(t.Runtime.DesiredCool),
+				Units:       s.cfg.get("units"),
+			})
+		}
+		return v, nil
+	}
+}
+
+// section of a thermostat which may be included by the show command.
+type section struct {
+	name    string
+	key     string // in the Thermostat's JSON encoding
+	include func(*egobee.Selection)
+}
+
+var sections = []section{
+	{"alerts", "alerts", func(s *egobee.Selection) { s.IncludeAlerts = true }},
+	{"audio", "audio", func(s *egobee.Selection) { s.IncludeAudio = true }},
+	{"device", "devices", func(s *egobee.Selection) { s.IncludeDevice = true }},
+	{"electricity", "electricity", func(s *egobee.Selection) { s.IncludeElectricity = true }},
+	{"energy", "energy", func(s *egobee.Selection) { s.IncludeEnergy = true }},
+	{"equipmentStatus", "equipmentStatus", func(s *egobee.Selection) { s.IncludeEquipmentStatus = true }},
+	{"events", "events", func(s *egobee.Selection) { s.IncludeEvents = true }},
+	{"extendedRuntime", "extendedRuntime", func(s *egobee.Selection) { s.IncludeExtendedRuntime = true }},
+	{"houseDetails", "houseDetails", func(s *egobee.Selection) { s.IncludeHouseDetails = true }},
+	{"location", "location", func(s *egobee.Selection) { s.IncludeLocation = true }},
+	{"management", "management", func(s *egobee.Selection) { s.IncludeManagement = true }},
+	{"notificationSettings", "notificationSettings", func(s *egobee.Selection) { s.IncludeNotificationSettings = true }},
+	{"program", "program", func(s *egobee.Selection) { s.IncludeProgram = true }},
+	{"reminders", "reminders", func(s *egobee.Selection) { s.IncludeReminders = true }},
+	{"runtime", "runtime", func(s *egobee.Selection) { s.IncludeRuntime = true }},
+	{"securitySettings", "securitySettings", func(s *egobee.Selection) { s.IncludeSecuritySettings = true }},
+	{"sensors", "remoteSensors", func(s *egobee.Selection) { s.IncludeSensors = true }},
+	{"settings", "settings", func(s *egobee.Selection) { s.IncludeSettings = true }},
+	{"technician", "technician", func(s *egobee.Selection) { s.IncludeTechnician = true }},
+	{"utility", "utility", func(s *egobee.Selection) { s.IncludeUtility = true }},
+	{"version", "version", func(s *egobee.Selection) { s.IncludeVersion = true }},
+	{"weather", "weather", func(s *egobee.Selection) { s.IncludeWeather = true }},
+}
+
+// sectionKeys are the keys of sections in a Thermostat's JSON encoding.
+var sectionKeys = func() map[string]bool {
+	keys := make(map[string]bool)
+	for _, s := range sections {
+		keys[s.key] = true
+	}
+	return keys
+}()
+
+func sectionNames() []string {
+	var names []string
+	for _, s := range sections {
+		names = append(names, s.name)
+	}
+	return names
+}
+
+// thermostatView is a thermostat with only the included sections.
+type thermostatView struct {
+	*node
+}
+
+func (v *thermostatView) writeTable(w io.Writer) error {
+	t := &table{}
+	v.flatten("", func(path, value string) { t.add(path, value) })
+	return t.write(w)
+}
+
+// newThermostatView of th, omitting the sections which were not included.
+func newThermostatView(th *egobee.Thermostat, included map[string]bool) (*thermostatView, error) {
+	b, err := json.Marshal(th)
+	if err != nil {
+		return nil, err
+	}
+	n, err := parseNode(b)
+	if err != nil {
+		return nil, err
+	}
+	filtered := &node{object: true}
+	for i, k := range n.keys {
+		if sectionKeys[k] && !included[k] {
+			continue
+		}
+		filtered.keys = append(filtered.keys, k)
+		filtered.children = append(filtered.children, n.children[i])
+	}
+	return &thermostatView{filtered}, nil
+}
+
+func show(fs *flag.FlagSet) runner {
+	include := fs.String("include", "runtime,settings", fmt.Sprintf("Comma separated sections to include, of: %v", strings.Join(sectionNames(), ", ")))
+	return func(ctx context.Context, s *session, args []string) (view, error) {
+		if len(args) != 1 {
+			return nil, errUsage
+		}
+		sel := selectThermostats(args)
+		included := make(map[string]bool)
+		for _, name := range strings.Split(*include, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			var found bool
+			for _, sec := range sections {
+				if sec.name == name {
+					sec.include(sel)
+					included[sec.key] = true
+					found = true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unknown section %q", name)
+			}
+		}
+		c, err := s.client()
+		if err != nil {
+			return nil, err
+		}
+		thermostats, err := c.ThermostatsContext(ctx, sel)
+		if err != nil {
+			return nil, err
+		}
+		if len(thermostats) != 1 {
+			return nil, fmt.Errorf("no thermostat %v", args[0])
+		}
+		return newThermostatView(thermostats[0], included)
+	}
+}
+
+func hold(fs *flag.FlagSet) runner {
+	heat := fs.String("heat", "", "Heat setpoint; defaults to the current setpoint")
+	cool := fs.String("cool", "", "Cool setpoint; defaults to the current setpoint")
+	climate := fs.String("climate", "", "Hold this climate, such as home or away, rather than temperatures")
+	fan := fs.String("fan", "", "Fan mode: auto or on")
+	holdType := fs.String("type", string(egobee.HoldTypeNextTransition), "Hold type: nextTransition, indefinite or holdHours")
+	hours := fs.Int("hours", 0, "Hours to hold for, with --type=holdHours")
+	return func(ctx context.Context, s *session, args []string) (view, error) {
+		if len(args) == 0 {
+			return nil, errUsage
+		}
+		if *heat == "" && *cool == "" && *climate == "" && *fan == "" {
+			return nil, errors.New("one of --heat, --cool, --climate or --fan is required")
+		}
+		if *climate != "" && (*heat != "" || *cool != "") {
+			return nil, errors.New("--climate may not be combined with --heat or --cool")
+		}
+		if egobee.HoldType(*holdType) == egobee.HoldTypeHoldHours {
+			if *hours < 1 {
+				return nil, errors.New("--type=holdHours requires --hours of at least 1")
+			}
+		} else if *hours != 0 {
+			return nil, errors.New("--hours may only be used with --type=holdHours")
+		}
+		p := egobee.SetHoldParams{
+			HoldClimateRef: *climate,
+			HoldType:       egobee.HoldType(*holdType),
+			HoldHours:      *hours,
+			Fan:            *fan,
+		}
+		var err error
+		if *heat != "" {
+			if p.HeatHoldTemp, err = s.parseTemperature(*heat); err != nil {
+				return nil, err
+			}
+		}
+		if *cool != "" {
+			if p.CoolHoldTemp, err = s.parseTemperature(*cool); err != nil {
+				return nil, err
+			}
+		}
+		c, err := s.client()
+		if err != nil {
+			return nil, err
+		}
+
+		if *climate != "" || (*heat != "" && *cool != "") {
+			if err := c.UpdateThermostatsContext(ctx, selectThermostats(args), egobee.SetHold(p)); err != nil {
+				return nil, err
+			}
+		} else {
+			// A temperature hold requires both setpoints, so the missing one is
+			// kept at its current value on each thermostat.
+			sel := selectThermostats(args)
+			sel.IncludeRuntime = true
+			thermostats, err := c.ThermostatsContext(ctx, sel)
+			if err != nil {
+				return nil, err
+			}
+			for _, t := range thermostats {
+				tp := p
+				if *heat == "" {
+					tp.HeatHoldTemp = t.Runtime.DesiredHeat
+				}
+				if *cool == "" {
+					tp.CoolHoldTemp = t.Runtime.DesiredCool
+				}
+				if err := c.UpdateThermostatsContext(ctx, selectThermostats([]string{t.Identifier}), egobee.SetHold(tp)); err != nil {
+					return nil, fmt.Errorf("failed to hold %v: %v", t.Identifier, err)
+				}
+			}
+		}
+		return &message{fmt.Sprintf("Set hold on %v", strings.Join(args, ", "))}, nil
+	}
+}
+
+func resume(fs *flag.FlagSet) runner {
+	all := fs.Bool("all", false, "Remove every event, rather than only the running one")
+	return func(ctx context.Context, s *session, args []string) (view, error) {
+		if len(args) == 0 {
+			return nil, errUsage
+		}
+		c, err := s.client()
+		if err != nil {
+			return nil, err
+		}
+		if err := c.UpdateThermostatsContext(ctx, selectThermostats(args), egobee.ResumeProgram(*all)); err != nil {
+			return nil, err
+		}
+		return &message{fmt.Sprintf("Resumed program on %v", strings.Join(args, ", "))}, nil
+	}
+}
+
+func mode(fs *flag.FlagSet) runner {
+	return func(ctx context.Context, s *session, args []string) (view, error) {
+		if len(args) < 2 {
+			return nil, errUsage
+		}
+		m, ids := args[0], args[1:]
+		var valid bool
+		for _, hm := range hvacModes {
+			valid = valid || hm == m
+		}
+		if !valid {
+			return nil, fmt.Errorf("invalid mode %q; must be one of %v", m, strings.Join(hvacModes, ", "))
+		}
+		p := egobee.NewThermostatPatch()
+		if err := p.Set("settings.hvacMode", m); err != nil {
+			return nil, err
+		}
+		c, err := s.client()
+		if err != nil {
+			return nil, err
+		}
+		if err := c.UpdateThermostatContext(ctx, selectThermostats(ids), p); err != nil {
+			return nil, err
+		}
+		return &message{fmt.Sprintf("Set mode %v on %v", m, strings.Join(ids, ", "))}, nil
+	}
+}
+
+// splitDateTime splits "YYYY-MM-DD HH:MM" into the date and time formats of
+// thermostat functions.
+func splitDateTime(v string) (date, timeOfDay string, err error) {
+	t, err := time.Parse("2006-01-02 15:04", v)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid date and time %q; expected YYYY-MM-DD HH:MM", v)
+	}
+	return t.Format("2006-01-02"), t.Format("15:04:05"), nil
+}
+
+func vacationCreate(fs *flag.FlagSet) runner {
+	name := fs.String("name", "", "Name of the vacation (required)")
+	heat := fs.String("heat", "", "Heat setpoint (required)")
+	cool := fs.String("cool", "", "Cool setpoint (required)")
+	start := fs.String("start", "", "Start, as YYYY-MM-DD HH:MM in thermostat local time; defaults to now")
+	end := fs.String("end", "", "End, as YYYY-MM-DD HH:MM in thermostat local time")
+	fan := fs.String("fan", "", "Fan mode: auto or on")
+	return func(ctx context.Context, s *session, args []string) (view, error) {
+		if len(args) == 0 || *name == "" || *heat == "" || *cool == "" {
+			return nil, errUsage
+		}
+		p := egobee.CreateVacationParams{Name: *name, Fan: *fan}
+		var err error
+		if p.HeatHoldTemp, err = s.parseTemperature(*heat); err != nil {
+			return nil, err
+		}
+		if p.CoolHoldTemp, err = s.parseTemperature(*cool); err != nil {
+			return nil, err
+		}
+		if *start != "" {
+			if p.StartDate, p.StartTime, err = splitDateTime(*start); err != nil {
+				return nil, err
+			}
+		}
+		if *end != "" {
+			if p.EndDate, p.EndTime, err = splitDateTime(*end); err != nil {
+				return nil, err
+			}
+		}
+		c, err := s.client()
+		if err != nil {
+			return nil, err
+		}
+		if err := c.UpdateThermostatsContext(ctx, selectThermostats(args), egobee.CreateVacation(p)); err != nil {
+			return nil, err
+		}
+		return &message{fmt.Sprintf("Created vacation %q on %v", *name, strings.Join(args, ", "))}, nil
+	}
+}
+
+func vacationDelete(fs *flag.FlagSet) runner {
+	return func(ctx context.Context, s *session, args []string) (view, error) {
+		if len(args) < 2 {
+			return nil, errUsage
+		}
+		name, ids := args[0], args[1:]
+		c, err := s.client()
+		if err != nil {
+			return nil, err
+		}
+		if err := c.UpdateThermostatsContext(ctx, selectThermostats(ids), egobee.DeleteVacation(name)); err != nil {
+			return nil, err
+		}
+		return &message{fmt.Sprintf("Deleted vacation %q on %v", name, strings.Join(ids, ", "))}, nil
+	}
+}
+
+func sendMessage(fs *flag.FlagSet) runner {
+	return func(ctx context.Context, s *session, args []string) (view, error) {
+		if len(args) < 2 {
+			return nil, errUsage
+		}
+		c, err := s.client()
+		if err != nil {
+			return nil, err
+		}
+		if err := c.UpdateThermostatsContext(ctx, selectThermostats(args[:1]), egobee.SendMessage(strings.Join(args[1:], " "))); err != nil {
+			return nil, err
+		}
+		return &message{fmt.Sprintf("Sent message to %v", args[0])}, nil
+	}
+}
+
+// alertEntry is an alert in the alerts list command.
+type alertEntry struct {
+	Thermostat     string    `json:"thermostat"`
+	AcknowledgeRef string    `json:"acknowledgeRef"`
+	Time           time.Time `json:"time"`
+	Severity       string    `json:"severity"`
+	Text           string    `json:"text"`
+}
+
+type alertsView []*alertEntry
+
+func (v alertsView) writeTable(w io.Writer) error {
+	t := &table{header: []string{"THERMOSTAT", "ACKREF", "TIME", "SEVERITY", "TEXT"}}
+	for _, a := range v {
+		t.add(a.Thermostat, a.AcknowledgeRef, a.Time.Format("2006-01-02 15:04"), a.Severity, a.Text)
+	}
+	return t.write(w)
+}
+
+func alertsList(fs *flag.FlagSet) runner {
+	return func(ctx context.Context, s *session, args []string) (view, error) {
+		if len(args) == 0 {
+			return nil, errUsage
+		}
+		c, err := s.client()
+		if err != nil {
+			return nil, err
+		}
+		sel := selectThermostats(args)
+		sel.IncludeAlerts = true
+		sel.IncludeLocation = true
+		thermostats, err := c.ThermostatsContext(ctx, sel)
+		if err != nil {
+			return nil, err
+		}
+		v := alertsView{}
+		for _, t := range thermostats {
+			for i := range t.Alerts {
+				a := &t.Alerts[i]
+				at, err := t.AlertDateTime(a)
+				if err != nil {
+					return nil, fmt.Errorf("alert %v on %v: %v", a.AcknowledgeRef, t.Identifier, err)
+				}
+				v = append(v, &alertEntry{
+					Thermostat:     t.Identifier,
+					AcknowledgeRef: a.AcknowledgeRef,
+					Time:           at,
+					Severity:       a.Severity,
+					Text:           a.Text,
+				})
+			}
+		}
+		return v, nil
+	}
+}
+
+func alertsAck(fs *flag.FlagSet) runner {
+	ackType := fs.String("type", string(egobee.AcknowledgeTypeAccept), "Response: accept, decline, defer or unacknowledged")
+	remind := fs.Bool("remind", false, "Remind later")
+	return func(ctx context.Context, s *session, args []string) (view, error) {
+		if len(args) != 2 {
+			return nil, errUsage
+		}
+		c, err := s.client()
+		if err != nil {
+			return nil, err
+		}
+		f := egobee.Acknowledge(args[0], args[1], egobee.AcknowledgeType(*ackType), *remind)
+		if err := c.UpdateThermostatsContext(ctx, selectThermostats(args[:1]), f); err != nil {
+			return nil, err
+		}
+		return &message{fmt.Sprintf("Acknowledged alert %v on %v", args[1], args[0])}, nil
+	}
+}
+
+// reportRow is one interval of a runtime or sensor report.
+type reportRow struct {
+	Thermostat string        `json:"thermostat"`
+	Time       time.Time     `json:"time"`
+	Values     []interface{} `json:"values"`
+}
+
+// runtimeReportView is the result of the report runtime command. Values in
+// each row are in the order of Columns.
+type runtimeReportView struct {
+	Columns []string            `json:"columns"`
+	Rows    []*reportRow        `json:"rows"`
+	Sensors []*sensorReportView `json:"sensors,omitempty"`
+}
+
+// sensorReportView is the sensor history of one thermostat.
+type sensorReportView struct {
+	Thermostat string                 `json:"thermostat"`
+	Sensors    []egobee.RuntimeSensor `json:"sensors"`
+	Rows       []*reportRow           `json:"rows"`
+}
+
+func writeReportTable(w io.Writer, columns []string, rows []*reportRow) error {
+	t := &table{header: append([]string{"THERMOSTAT", "TIME"}, columns...)}
+	for _, r := range rows {
+		cells := []interface{}{r.Thermostat, r.Time.Format("2006-01-02 15:04")}
+		for _, v := range r.Values {
+			if v == nil {
+				v = "-"
+			}
+			cells = append(cells, v)
+		}
+		t.add(cells...)
+	}
+	return t.write(w)
+}
+
+func (v *runtimeReportView) writeTable(w io.Writer) error {
+	if err := writeReportTable(w, v.Columns, v.Rows); err != nil {
+		return err
+	}
+	for _, sr := range v.Sensors {
+		var columns []string
+		for _, s := range sr.Sensors {
+			columns = append(columns, fmt.Sprintf("%v (%v)", s.SensorName, s.SensorType))
+		}
+		fmt.Fprintln(w)
+		if err := writeReportTable(w, columns, sr.Rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reportValue converts a runtime report value for output.
+func (s *session) reportValue(v interface{}) interface{} {
+	if t, ok := v.(egobee.Temperature); ok {
+		return s.temperature(t)
+	}
+	return v
+}
+
+func reportRows(s *session, thermostat string, rows []*egobee.RuntimeReportRow, columns []string) []*reportRow {
+	var out []*reportRow
+	for _, r := range rows {
+		rr := &reportRow{Thermostat: thermostat, Time: r.Time}
+		for _, col := range columns {
+			rr.Values = append(rr.Values, s.reportValue(r.Values[col]))
+		}
+		out = append(out, rr)
+	}
+	return out
+}
+
+func reportRuntime(fs *flag.FlagSet) runner {
+	today := time.Now().Format("2006-01-02")
+	start := fs.String("start", today, "First day of the report, as YYYY-MM-DD")
+	end := fs.String("end", today, "Last day of the report, as YYYY-MM-DD")
+	columns := fs.String("columns", "zoneAveTemp,zoneHumidity,zoneHeatTemp,zoneCoolTemp,outdoorTemp", "Comma separated columns to report")
+	sensors := fs.Bool("sensors", false, "Include the history of each sensor")
+	return func(ctx context.Context, s *session, args []string) (view, error) {
+		if len(args) == 0 {
+			return nil, errUsage
+		}
+		startDate, err := time.Parse("2006-01-02", *start)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --start %q", *start)
+		}
+		endDate, err := time.Parse("2006-01-02", *end)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --end %q", *end)
+		}
+		c, err := s.client()
+		if err != nil {
+			return nil, err
+		}
+		report, err := c.RuntimeReportContext(ctx, &egobee.RuntimeReportRequest{
+			Selection:      selectThermostats(args),
+			StartDate:      startDate,
+			EndDate:        endDate,
+			EndInterval:    287,
+			Columns:        strings.Split(*columns, ","),
+			IncludeSensors: *sensors,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return newRuntimeReportView(s, report), nil
+	}
+}
+
+func newRuntimeReportView(s *session, report *egobee.RuntimeReport) *runtimeReportView {
+	v := &runtimeReportView{Columns: report.Columns, Rows: []*reportRow{}}
+	for _, r := range report.Reports {
+		v.Rows = append(v.Rows, reportRows(s, r.ThermostatIdentifier, r.Rows, report.Columns)...)
+	}
+	for _, sr := range report.SensorReports {
+		var ids []string
+		for _, sensor := range sr.Sensors {
+			ids = append(ids, sensor.SensorID)
+		}
+		v.Sensors = append(v.Sensors, &sensorReportView{
+			Thermostat: sr.ThermostatIdentifier,
+			Sensors:    sr.Sensors,
+			Rows:       reportRows(s, sr.ThermostatIdentifier, sr.Rows, ids),
+		})
+	}
+	return v
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cfunkhouser/egobee"
+	"github.com/cfunkhouser/egobee/egobeetest"
+)
+
+// testEgo runs ego commands against a fake ecobee API.
+type testEgo struct {
+	t       *testing.T
+	s       *egobeetest.Server
+	dir     string
+	restore func()
+}
+
+func newTestEgo(t *testing.T, thermostats ...*egobee.Thermostat) *testEgo {
+	dir, err := ioutil.TempDir("", "ego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := egobeetest.NewServer(thermostats...)
+	clientOptions = s.Options()
+	restore := fakeEnvironment(map[string]string{"EGO_APP_ID": s.AppID}, dir)
+	return &testEgo{t: t, s: s, dir: dir, restore: restore}
+}
+
+func (e *testEgo) Close() {
+	e.restore()
+	clientOptions = nil
+	e.s.Close()
+	os.RemoveAll(e.dir)
+}
+
+func (e *testEgo) storePath() string {
+	return filepath.Join(e.dir, "ego", "credentials")
+}
+
+// login saves credentials for the fake API.
+func (e *testEgo) login() {
+	os.MkdirAll(filepath.Dir(e.storePath()), 0700)
+	if _, err := egobee.NewPersistentTokenStore(e.s.Token(egobee.ScopeSmartWrite), e.storePath()); err != nil {
+		e.t.Fatal(err)
+	}
+}
+
+// run ego, failing the test if it fails.
+func (e *testEgo) run(args ...string) string {
+	e.t.Helper()
+	var stdout, stderr bytes.Buffer
+	if err := run(context.Background(), args, &stdout, &stderr); err != nil {
+		e.t.Fatalf("ego %v: got unexpected error: %v\n%v", strings.Join(args, " "), err, stderr.String())
+	}
+	return stdout.String()
+}
+
+func testThermostat() *egobee.Thermostat {
+	return &egobee.Thermostat{
+		Identifier:  "123",
+		Name:        "Main Floor",
+		ModelNumber: "athenaSmart",
+		Runtime: egobee.Runtime{
+			Connected:         true,
+			ActualTemperature: 705,
+			ActualHumidity:    40,
+			DesiredHeat:       700,
+			DesiredCool:       780,
+		},
+		Settings: egobee.Settings{HVACMode: "heat"},
+		Location: egobee.Location{TimeZone: "America/New_York"},
+		Alerts: []egobee.Alert{{
+			AcknowledgeRef: "ack1",
+			Date:           "2026-10-16",
+			Time:           "08:30:00",
+			Severity:       "high",
+			Text:           "Replace the filter.",
+		}},
+	}
+}
+
+func TestAuthLogin(t *testing.T) {
+	e := newTestEgo(t)
+	defer e.Close()
+	e.s.PinInterval = 1
+
+	// Authorize the PIN once it is shown.
+	pinShown := regexp.MustCompile(`PIN (\S+) `)
+	stderr := &watchedWriter{f: func(b []byte) {
+		if m := pinShown.FindSubmatch(b); m != nil {
+			go e.s.AuthorizePin(string(m[1]))
+		}
+	}}
+	var stdout bytes.Buffer
+	if err := run(context.Background(), []string{"auth", "login"}, &stdout, stderr); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if !strings.Contains(stdout.String(), e.storePath()) {
+		t.Errorf("got output %q, want mention of %v", stdout.String(), e.storePath())
+	}
+
+	var status authStatusView
+	if err := json.Unmarshal([]byte(e.run("auth", "status", "--output=json")), &status); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if !status.Authorized || status.Store != e.storePath() || status.Error != "" {
+		t.Errorf("got unexpected status %+v", status)
+	}
+}
+
+// watchedWriter calls f with everything written to it.
+type watchedWriter struct {
+	mu sync.Mutex
+	f  func([]byte)
+}
+
+func (w *watchedWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.f(b)
+	return len(b), nil
+}
+
+func TestAuthStatusUnauthorized(t *testing.T) {
+	e := newTestEgo(t)
+	defer e.Close()
+	out := e.run("auth", "status")
+	if !strings.Contains(out, "Authorized:") || !strings.Contains(out, "false") {
+		t.Errorf("got unexpected status:\n%v", out)
+	}
+
+	e.login()
+	e.s.RevokeTokens()
+	out = e.run("auth", "status", "--output", "yaml")
+	if !strings.Contains(out, "authorized: false") || !strings.Contains(out, "error:") {
+		t.Errorf("got unexpected status:\n%v", out)
+	}
+}
+
+func TestList(t *testing.T) {
+	e := newTestEgo(t, testThermostat())
+	defer e.Close()
+	e.login()
+
+	want := "ID   NAME        MODE  TEMPERATURE  HUMIDITY  HEAT    COOL    CONNECTED\n" +
+		"123  Main Floor  heat  70.5°F       40%       70.0°F  78.0°F  true\n"
+	if got := e.run("list"); got != want {
+		t.Errorf("got:\n%v\nwant:\n%v", got, want)
+	}
+
+	var entries []thermostatEntry
+	if err := json.Unmarshal([]byte(e.run("list", "--output=json", "--units=C")), &entries); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Temperature != 21.4 || entries[0].Units != "C" {
+		t.Errorf("got unexpected entries %+v", entries)
+	}
+}
+
+func TestShow(t *testing.T) {
+	e := newTestEgo(t, testThermostat())
+	defer e.Close()
+	e.login()
+
+	out := e.run("show", "123")
+	for _, want := range []string{"identifier", "runtime.actualTemperature", "705", "settings.hvacMode"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("show output is missing %q:\n%v", want, out)
+		}
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(e.run("--output=json", "show", "--include=alerts", "123")), &got); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if _, ok := got["alerts"]; !ok {
+		t.Error("alerts were not shown")
+	}
+	if _, ok := got["runtime"]; ok {
+		t.Error("runtime was shown without being included")
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := run(context.Background(), []string{"show", "--include=bogus", "123"}, &stdout, &stderr); err == nil {
+		t.Error("expected error for unknown section, got nil")
+	}
+}
+
+func TestFunctions(t *testing.T) {
+	e := newTestEgo(t, testThermostat())
+	defer e.Close()
+	e.login()
+
+	e.run("hold", "--heat=68", "123")
+	th := e.s.Thermostat("123")
+	if th.Runtime.DesiredHeat != 680 || th.Runtime.DesiredCool != 780 {
+		t.Errorf("got setpoints %v and %v, want 68.0°F and 78.0°F", th.Runtime.DesiredHeat, th.Runtime.DesiredCool)
+	}
+	if len(th.Events) != 1 || th.Events[0].Type != "hold" {
+		t.Errorf("got unexpected events %+v", th.Events)
+	}
+
+	e.run("resume", "--all", "123")
+	if th := e.s.Thermostat("123"); len(th.Events) != 0 {
+		t.Errorf("got events %+v after resuming", th.Events)
+	}
+	for _, args := range [][]string{
+		{"hold", "--heat=68", "--type=holdHours", "123"},
+		{"hold", "--heat=68", "--type=holdHours", "--hours=-1", "123"},
+		{"hold", "--heat=68", "--hours=2", "123"},
+		{"hold", "--heat=68", "--type=indefinite", "--hours=2", "123"},
+	} {
+		var stdout, stderr bytes.Buffer
+		if err := run(context.Background(), args, &stdout, &stderr); err == nil {
+			t.Errorf("ego %v: expected error, got nil", strings.Join(args, " "))
+		}
+	}
+	if th := e.s.Thermostat("123"); len(th.Events) != 0 {
+		t.Errorf("got events %+v after invalid holds", th.Events)
+	}
+
+	e.run("mode", "cool", "123")
+	if got := e.s.Thermostat("123").Settings.HVACMode; got != "cool" {
+		t.Errorf("got mode %q, want cool", got)
+	}
+	var stdout, stderr bytes.Buffer
+	if err := run(context.Background(), []string{"mode", "warm", "123"}, &stdout, &stderr); err == nil {
+		t.Error("expected error for invalid mode, got nil")
+	}
+
+	e.run("vacation", "create", "--name=Beach", "--heat=60", "--cool=85", "--start=2026-12-20 08:00", "--end=2026-12-27 17:00", "123")
+	th = e.s.Thermostat("123")
+	if len(th.Events) != 1 || th.Events[0].Name != "Beach" || th.Events[0].StartDate != "2026-12-20" || th.Events[0].EndTime != "17:00:00" {
+		t.Errorf("got unexpected events %+v", th.Events)
+	}
+	e.run("vacation", "delete", "Beach", "123")
+	if th := e.s.Thermostat("123"); len(th.Events) != 0 {
+		t.Errorf("got events %+v after deleting vacation", th.Events)
+	}
+
+	e.run("message", "123", "Hello", "there")
+
+	out := e.run("alerts", "list", "123")
+	if !strings.Contains(out, "ack1") || !strings.Contains(out, "2026-10-16 08:30") {
+		t.Errorf("got unexpected alerts:\n%v", out)
+	}
+	e.run("alerts", "ack", "123", "ack1")
+	if th := e.s.Thermostat("123"); len(th.Alerts) != 0 {
+		t.Errorf("got alerts %+v after acknowledging", th.Alerts)
+	}
+}
+
+func TestRuntimeReportView(t *testing.T) {
+	s := &session{cfg: &config{values: map[string]string{"units": "F"}}}
+	at := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+	v := newRuntimeReportView(s, &egobee.RuntimeReport{
+		Columns: []string{egobee.RuntimeColumnZoneAveTemp, egobee.RuntimeColumnHVACMode},
+		Reports: []*egobee.ThermostatRuntimeReport{{
+			ThermostatIdentifier: "123",
+			Rows: []*egobee.RuntimeReportRow{
+				{Time: at, Values: map[string]interface{}{egobee.RuntimeColumnZoneAveTemp: egobee.Temperature(703), egobee.RuntimeColumnHVACMode: "heat"}},
+				{Time: at.Add(5 * time.Minute), Values: map[string]interface{}{}},
+			},
+		}},
+		SensorReports: []*egobee.SensorRuntimeReport{{
+			ThermostatIdentifier: "123",
+			Sensors:              []egobee.RuntimeSensor{{SensorID: "rs1", SensorName: "Bedroom", SensorType: "temperature"}},
+			Rows:                 []*egobee.RuntimeReportRow{{Time: at, Values: map[string]interface{}{"rs1": egobee.Temperature(685)}}},
+		}},
+	})
+	var b bytes.Buffer
+	if err := render(&b, v, outputTable); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	want := `THERMOSTAT  TIME              zoneAveTemp  hvacMode
+123         2026-10-16 08:00  70.3         heat
+123         2026-10-16 08:05  -            -
+
+THERMOSTAT  TIME              Bedroom (temperature)
+123         2026-10-16 08:00  68.5
+`
+	if b.String() != want {
+		t.Errorf("got:\n%v\nwant:\n%v", b.String(), want)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Overridable for testing.
+var (
+	getenv        = os.Getenv
+	userConfigDir = os.UserConfigDir
+)
+
+// configKey is a setting which may be given by flag, environment variable or
+// config file, in that order of precedence.
+type configKey struct {
+	name  string // of the flag and in the config file
+	env   string
+	usage string
+}
+
+var configKeys = []configKey{
+	{"app", "EGO_APP_ID", "Ecobee Registered App ID"},
+	{"store", "EGO_STORE", "Persistent egobee credential store path (default <config dir>/ego/credentials)"},
+	{"output", "EGO_OUTPUT", "Output format: table, json or yaml (default table)"},
+	{"units", "EGO_UNITS", "Temperature units: F or C (default F)"},
+}
+
+// config of the ego command.
+type config struct {
+	flags map[string]*string
+	// path of the config file, by flag.
+	path string
+	// values after resolution.
+	values map[string]string
+}
+
+func newConfig() *config {
+	c := &config{flags: make(map[string]*string)}
+	for _, k := range configKeys {
+		c.flags[k.name] = new(string)
+	}
+	return c
+}
+
+// register the configuration flags on fs. They are registered on every
+// command's flags so that they may be given before or after the command.
+func (c *config) register(fs *flag.FlagSet) {
+	for _, k := range configKeys {
+		fs.Var((*configFlag)(c.flags[k.name]), k.name, fmt.Sprintf("%v; or $%v", k.usage, k.env))
+	}
+	fs.Var((*configFlag)(&c.path), "config", "Config file path (default <config dir>/ego/config); or $EGO_CONFIG")
+}
+
+// configFlag is a string flag. Unlike with flag.StringVar, registering it does
+// not reset its value, so it may be registered on several FlagSets.
+type configFlag string
+
+func (f *configFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return string(*f)
+}
+
+func (f *configFlag) Set(s string) error {
+	*f = configFlag(s)
+	return nil
+}
+
+// configDir returns the directory containing ego's default files.
+func configDir() (string, error) {
+	d, err := userConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d, "ego"), nil
+}
+
+// resolve the configuration from flags, the environment and the config file.
+func (c *config) resolve() error {
+	path, explicit := c.path, true
+	if path == "" {
+		path = getenv("EGO_CONFIG")
+	}
+	if path == "" {
+		explicit = false
+		dir, err := configDir()
+		if err == nil {
+			path = filepath.Join(dir, "config")
+		}
+	}
+	var file map[string]string
+	if path != "" {
+		var err error
+		file, err = readConfigFile(path)
+		if err != nil && (explicit || !os.IsNotExist(err)) {
+			return err
+		}
+	}
+
+	c.values = make(map[string]string)
+	for _, k := range configKeys {
+		v := *c.flags[k.name]
+		if v == "" {
+			v = getenv(k.env)
+		}
+		if v == "" {
+			v = file[k.name]
+		}
+		c.values[k.name] = v
+	}
+	if c.values["store"] == "" {
+		dir, err := configDir()
+		if err != nil {
+			return fmt.Errorf("no --store given and no default: %v", err)
+		}
+		c.values["store"] = filepath.Join(dir, "credentials")
+	}
+	if c.values["output"] == "" {
+		c.values["output"] = outputTable
+	}
+	switch c.values["output"] {
+	case outputTable, outputJSON, outputYAML:
+	default:
+		return fmt.Errorf("unknown output format %q", c.values["output"])
+	}
+	switch c.values["units"] = strings.ToUpper(c.values["units"]); c.values["units"] {
+	case "":
+		c.values["units"] = "F"
+	case "F", "C":
+	default:
+		return fmt.Errorf("unknown temperature units %q", c.values["units"])
+	}
+	return nil
+}
+
+func (c *config) get(name string) string {
+	return c.values[name]
+}
+
+// readConfigFile reads "name: value" lines from the file at path. Blank lines
+// and those starting with # are ignored. This is a subset of YAML.
+func readConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	known := make(map[string]bool)
+	for _, k := range configKeys {
+		known[k.name] = true
+	}
+	values := make(map[string]string)
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		l := strings.TrimSpace(s.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		i := strings.Index(l, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("%v:%v: expected name: value", path, line)
+		}
+		name, value := strings.TrimSpace(l[:i]), strings.TrimSpace(l[i+1:])
+		if !known[name] {
+			return nil, fmt.Errorf("%v:%v: unknown setting %q", path, line, name)
+		}
+		values[name] = strings.Trim(value, `"'`)
+	}
+	return values, s.Err()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeEnvironment overrides the environment variables and user config
+// directory, returning a function which restores them.
+func fakeEnvironment(env map[string]string, dir string) func() {
+	oldGetenv, oldUserConfigDir := getenv, userConfigDir
+	getenv = func(k string) string { return env[k] }
+	userConfigDir = func() (string, error) { return dir, nil }
+	return func() {
+		getenv, userConfigDir = oldGetenv, oldUserConfigDir
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "ego"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	defaultConfig := filepath.Join(dir, "ego", "config")
+	if err := ioutil.WriteFile(defaultConfig, []byte("# ego settings\napp: file-app\nstore: \"/file/store\"\n\noutput: yaml\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	otherConfig := filepath.Join(dir, "other")
+	if err := ioutil.WriteFile(otherConfig, []byte("units: c\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "config file",
+			want: map[string]string{"app": "file-app", "store": "/file/store", "output": "yaml", "units": "F"},
+		},
+		{
+			name: "environment overrides file",
+			env:  map[string]string{"EGO_APP_ID": "env-app", "EGO_OUTPUT": "json"},
+			want: map[string]string{"app": "env-app", "store": "/file/store", "output": "json", "units": "F"},
+		},
+		{
+			name: "flags override environment",
+			args: []string{"--app=flag-app", "--store=/flag/store"},
+			env:  map[string]string{"EGO_APP_ID": "env-app"},
+			want: map[string]string{"app": "flag-app", "store": "/flag/store", "output": "yaml", "units": "F"},
+		},
+		{
+			name: "other config file by environment",
+			env:  map[string]string{"EGO_CONFIG": otherConfig},
+			want: map[string]string{"app": "", "store": filepath.Join(dir, "ego", "credentials"), "output": "table", "units": "C"},
+		},
+		{
+			name:    "missing config file",
+			args:    []string{"--config", filepath.Join(dir, "missing")},
+			wantErr: true,
+		},
+		{
+			name:    "bad output",
+			args:    []string{"--output", "xml"},
+			wantErr: true,
+		},
+	} {
+		restore := fakeEnvironment(tt.env, dir)
+		c := newConfig()
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		c.register(fs)
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatalf("%v: got unexpected error: %v", tt.name, err)
+		}
+		err := c.resolve()
+		restore()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: got error %v, want error: %v", tt.name, err, tt.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		for k, v := range tt.want {
+			if got := c.get(k); got != v {
+				t.Errorf("%v: got %v %q, want %q", tt.name, k, got, v)
+			}
+		}
+	}
+}
+
+func TestReadConfigFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "ego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("app: x\ncolour: blue\n")
+	f.Close()
+	if _, err := readConfigFile(f.Name()); err == nil {
+		t.Error("expected error for unknown setting, got nil")
+	}
+}
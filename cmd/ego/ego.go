@@ -0,0 +1,214 @@
+// ego is a command line interface to the ecobee API.
+//
+// Usage:
+//
+//	ego [flags] <command> [flags] [arguments]
+//
+// The app ID, credential store path, output format and temperature units may be
+// given by flag, by environment variable, or in a config file of "name: value"
+// lines. Run "ego help" for the list of commands.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cfunkhouser/egobee"
+)
+
+// clientOptions used to contact the ecobee API. Overridable for testing.
+var clientOptions *egobee.Options
+
+// errUsage is returned when a command is invoked incorrectly. The usage has
+// already been printed.
+var errUsage = errors.New("usage")
+
+// runner performs a command with its positional arguments.
+type runner func(ctx context.Context, s *session, args []string) (view, error)
+
+// command is an ego subcommand.
+type command struct {
+	name  string
+	args  string // synopsis of positional arguments
+	short string
+	// setup registers the command's flags on fs, and returns its runner. It is
+	// nil for commands which only group subcommands.
+	setup       func(fs *flag.FlagSet) runner
+	subcommands []*command
+}
+
+// commands is set in init to avoid an initialization loop through help.
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{name: "auth", short: "Manage authorization", subcommands: []*command{
+			{name: "login", short: "Authorize ego with an ecobee PIN", setup: authLogin},
+			{name: "status", short: "Report the state of the stored credentials", setup: authStatus},
+		}},
+		{name: "list", short: "List registered thermostats", setup: list},
+		{name: "show", args: "<thermostat>", short: "Show a thermostat", setup: show},
+		{name: "hold", args: "<thermostat>...", short: "Hold temperatures, a climate or the fan", setup: hold},
+		{name: "resume", args: "<thermostat>...", short: "Resume the program", setup: resume},
+		{name: "mode", args: "<mode> <thermostat>...", short: "Set the HVAC mode", setup: mode},
+		{name: "vacation", short: "Manage vacations", subcommands: []*command{
+			{name: "create", args: "<thermostat>...", short: "Create a vacation", setup: vacationCreate},
+			{name: "delete", args: "<name> <thermostat>...", short: "Delete a vacation", setup: vacationDelete},
+		}},
+		{name: "message", args: "<thermostat> <text>...", short: "Display a message on a thermostat", setup: sendMessage},
+		{name: "alerts", short: "Manage alerts", subcommands: []*command{
+			{name: "list", args: "<thermostat>...", short: "List alerts", setup: alertsList},
+			{name: "ack", args: "<thermostat> <ackRef>", short: "Acknowledge an alert", setup: alertsAck},
+		}},
+		{name: "report", short: "Retrieve historical data", subcommands: []*command{
+			{name: "runtime", args: "<thermostat>...", short: "Report runtime history", setup: reportRuntime},
+		}},
+		{name: "help", args: "[command]", short: "Show help for a command", setup: help},
+	}
+}
+
+// session is the state shared by a command invocation.
+type session struct {
+	cfg    *config
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// client returns a Client authorized by the credential store.
+func (s *session) client() (*egobee.Client, error) {
+	app := s.cfg.get("app")
+	if app == "" {
+		return nil, errors.New("no app ID; set --app, $EGO_APP_ID or app in the config file")
+	}
+	ts, err := egobee.NewPersistentTokenFromDisk(s.cfg.get("store"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials from %v: %v; run \"ego auth login\"", s.cfg.get("store"), err)
+	}
+	return egobee.New(app, ts, clientOptions), nil
+}
+
+func main() {
+	err := run(context.Background(), os.Args[1:], os.Stdout, os.Stderr)
+	switch {
+	case err == errUsage:
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "ego: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run ego with args.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	s := &session{cfg: newConfig(), stdout: stdout, stderr: stderr}
+	fs := flag.NewFlagSet("ego", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	s.cfg.register(fs)
+	fs.Usage = func() { usage(stderr, fs, "ego", commands) }
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	name := "ego"
+	cmds, args := commands, fs.Args()
+	printUsage := fs.Usage
+	for {
+		if len(args) == 0 || isHelpFlag(args[0]) {
+			printUsage()
+			return errUsage
+		}
+		cmd := findCommand(cmds, args[0])
+		if cmd == nil {
+			fmt.Fprintf(stderr, "%v: unknown command %q\n", name, args[0])
+			printUsage()
+			return errUsage
+		}
+		name, args = name+" "+cmd.name, args[1:]
+		if cmd.setup == nil {
+			group, subcommands := name, cmd.subcommands
+			cmds = subcommands
+			printUsage = func() { usage(stderr, nil, group, subcommands) }
+			continue
+		}
+
+		fs = flag.NewFlagSet(name, flag.ContinueOnError)
+		fs.SetOutput(stderr)
+		s.cfg.register(fs)
+		r := cmd.setup(fs)
+		fs.Usage = func() {
+			fmt.Fprintf(stderr, "Usage: %v [flags] %v\n\n%v.\n\nFlags:\n", name, cmd.args, cmd.short)
+			fs.PrintDefaults()
+		}
+		if err := fs.Parse(args); err != nil {
+			return errUsage
+		}
+		if err := s.cfg.resolve(); err != nil {
+			return err
+		}
+		v, err := r(ctx, s, fs.Args())
+		if err == errUsage {
+			fs.Usage()
+		}
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			return nil
+		}
+		return render(stdout, v, s.cfg.get("output"))
+	}
+}
+
+func findCommand(cmds []*command, name string) *command {
+	for _, c := range cmds {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// usage prints the commands available under name, and the flags in fs if it is
+// not nil.
+func usage(w io.Writer, fs *flag.FlagSet, name string, cmds []*command) {
+	fmt.Fprintf(w, "Usage: %v <command> [flags] [arguments]\n\nCommands:\n", name)
+	t := &table{}
+	for _, c := range cmds {
+		synopsis := c.name
+		if c.args != "" {
+			synopsis += " " + c.args
+		}
+		t.add("  "+synopsis, c.short)
+		for _, sub := range c.subcommands {
+			t.add("  "+strings.TrimSpace(c.name+" "+sub.name+" "+sub.args), sub.short)
+		}
+	}
+	t.write(w)
+	if fs != nil {
+		fmt.Fprintln(w, "\nFlags:")
+		fs.PrintDefaults()
+	}
+}
+
+// help prints the usage of a command.
+func help(fs *flag.FlagSet) runner {
+	return func(ctx context.Context, s *session, args []string) (view, error) {
+		if len(args) == 0 {
+			usage(s.stdout, nil, "ego", commands)
+			return nil, nil
+		}
+		if err := run(ctx, append(args, "-h"), s.stdout, s.stdout); err != errUsage {
+			return nil, err
+		}
+		return nil, nil
+	}
+}
+
+func isHelpFlag(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
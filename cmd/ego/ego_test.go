@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRunUsage(t *testing.T) {
+	for _, tt := range []struct {
+		args       []string
+		wantErr    error
+		wantStdout string
+		wantStderr string
+	}{
+		{args: nil, wantErr: errUsage, wantStderr: "Usage: ego <command>"},
+		{args: []string{"frobnicate"}, wantErr: errUsage, wantStderr: `unknown command "frobnicate"`},
+		{args: []string{"vacation"}, wantErr: errUsage, wantStderr: "Usage: ego vacation <command>"},
+		{args: []string{"vacation", "-h"}, wantErr: errUsage, wantStderr: "delete <name> <thermostat>..."},
+		{args: []string{"show"}, wantErr: errUsage, wantStderr: "Usage: ego show [flags] <thermostat>"},
+		{args: []string{"help"}, wantStdout: "report runtime <thermostat>..."},
+		{args: []string{"help", "alerts", "ack"}, wantStdout: "-remind"},
+	} {
+		var stdout, stderr bytes.Buffer
+		err := run(context.Background(), tt.args, &stdout, &stderr)
+		if err != tt.wantErr {
+			t.Errorf("%v: got error %v, want %v", tt.args, err, tt.wantErr)
+		}
+		if !strings.Contains(stdout.String(), tt.wantStdout) {
+			t.Errorf("%v: got stdout:\n%v\nwant it to contain %q", tt.args, stdout.String(), tt.wantStdout)
+		}
+		if !strings.Contains(stderr.String(), tt.wantStderr) {
+			t.Errorf("%v: got stderr:\n%v\nwant it to contain %q", tt.args, stderr.String(), tt.wantStderr)
+		}
+	}
+}
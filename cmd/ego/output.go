@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// view is the result of a command. It is rendered as JSON or YAML from its
+// JSON encoding, or for humans by writeTable.
+type view interface {
+	writeTable(w io.Writer) error
+}
+
+// render v to w in format.
+func render(w io.Writer, v view, format string) error {
+	switch format {
+	case outputTable:
+		return v.writeTable(w)
+	case outputJSON:
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(v)
+	case outputYAML:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		n, err := parseNode(b)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		n.writeYAML(&buf, 0)
+		_, err = w.Write(buf.Bytes())
+		return err
+	}
+	return fmt.Errorf("unknown output format %q", format)
+}
+
+// table is a view of rows under a header.
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+func (t *table) add(cells ...interface{}) {
+	row := make([]string, len(cells))
+	for i, c := range cells {
+		row[i] = fmt.Sprint(c)
+	}
+	t.rows = append(t.rows, row)
+}
+
+func (t *table) write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if len(t.header) > 0 {
+		fmt.Fprintln(tw, strings.Join(t.header, "\t"))
+	}
+	for _, row := range t.rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// message is the view of a command which only reports what it did.
+type message struct {
+	Message string `json:"message"`
+}
+
+func (m *message) writeTable(w io.Writer) error {
+	_, err := fmt.Fprintln(w, m.Message)
+	return err
+}
+
+// node is a JSON value which, unlike one decoded into an interface{}, keeps
+// the order of object keys.
+type node struct {
+	// keys of an object, whose values are in children.
+	keys     []string
+	children []*node
+	object   bool
+	array    bool
+	// scalar value of anything else, as a json.Number, string, bool or nil.
+	scalar interface{}
+}
+
+// parseNode parses the JSON document b.
+func parseNode(b []byte) (*node, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	return decodeNode(d)
+}
+
+func decodeNode(d *json.Decoder) (*node, error) {
+	tok, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return &node{scalar: tok}, nil
+	}
+	n := &node{object: delim == '{', array: delim == '['}
+	for d.More() {
+		if n.object {
+			key, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			n.keys = append(n.keys, key.(string))
+		}
+		child, err := decodeNode(d)
+		if err != nil {
+			return nil, err
+		}
+		n.children = append(n.children, child)
+	}
+	// Consume the closing delimiter.
+	if _, err := d.Token(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// MarshalJSON encodes n, preserving the order of object keys.
+func (n *node) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	switch {
+	case n.object:
+		b.WriteByte('{')
+		for i, k := range n.keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			key, err := json.Marshal(k)
+			if err != nil {
+				return nil, err
+			}
+			child, err := n.children[i].MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+			b.Write(key)
+			b.WriteByte(':')
+			b.Write(child)
+		}
+		b.WriteByte('}')
+	case n.array:
+		b.WriteByte('[')
+		for i, c := range n.children {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			child, err := c.MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+			b.Write(child)
+		}
+		b.WriteByte(']')
+	default:
+		return json.Marshal(n.scalar)
+	}
+	return b.Bytes(), nil
+}
+
+// isZero reports whether n is an empty, false, zero or null value.
+func (n *node) isZero() bool {
+	if n.object || n.array {
+		return len(n.children) == 0
+	}
+	switch v := n.scalar.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case string:
+		return v == ""
+	case json.Number:
+		f, err := v.Float64()
+		return err == nil && f == 0
+	}
+	return false
+}
+
+// scalarString formats a scalar for humans.
+func (n *node) scalarString() string {
+	if n.scalar == nil {
+		return ""
+	}
+	return fmt.Sprint(n.scalar)
+}
+
+// flatten calls f with the dotted path to each non-zero scalar under n.
+func (n *node) flatten(path string, f func(path, value string)) {
+	switch {
+	case n.object:
+		for i, k := range n.keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			n.children[i].flatten(p, f)
+		}
+	case n.array:
+		for i, c := range n.children {
+			c.flatten(fmt.Sprintf("%v[%v]", path, i), f)
+		}
+	default:
+		if !n.isZero() {
+			f(path, n.scalarString())
+		}
+	}
+}
+
+// writeYAML writes n as a YAML block at indent.
+func (n *node) writeYAML(w *bytes.Buffer, indent int) {
+	pad := strings.Repeat(" ", indent)
+	switch {
+	case n.object && len(n.children) > 0:
+		for i, k := range n.keys {
+			fmt.Fprintf(w, "%v%v:", pad, yamlString(k))
+			n.children[i].writeYAMLValue(w, indent+2)
+		}
+	case n.array && len(n.children) > 0:
+		for _, c := range n.children {
+			w.WriteString(pad + "-")
+			if (c.object || c.array) && len(c.children) > 0 {
+				// Start the nested block on the same line as the dash.
+				var nested bytes.Buffer
+				c.writeYAML(&nested, indent+2)
+				w.WriteString(" ")
+				w.Write(nested.Bytes()[indent+2:])
+				continue
+			}
+			c.writeYAMLValue(w, indent+2)
+		}
+	default:
+		w.WriteString(pad)
+		n.writeYAMLValue(w, indent)
+	}
+}
+
+// writeYAMLValue writes n following a key or dash.
+func (n *node) writeYAMLValue(w *bytes.Buffer, indent int) {
+	switch {
+	case n.object && len(n.children) == 0:
+		w.WriteString(" {}\n")
+	case n.array && len(n.children) == 0:
+		w.WriteString(" []\n")
+	case n.object || n.array:
+		w.WriteString("\n")
+		n.writeYAML(w, indent)
+	default:
+		w.WriteString(" ")
+		switch v := n.scalar.(type) {
+		case nil:
+			w.WriteString("null")
+		case string:
+			w.WriteString(yamlString(v))
+		default:
+			fmt.Fprint(w, v)
+		}
+		w.WriteString("\n")
+	}
+}
+
+// yamlString returns s as a YAML scalar, quoted if it would otherwise be read
+// as something other than the same string.
+func yamlString(s string) string {
+	if s == "" || strings.TrimSpace(s) != s || strings.ContainsAny(s, ":#{}[],&*!|>'\"%@`\n\t\\") {
+		return strconv.Quote(s)
+	}
+	switch strings.ToLower(s) {
+	case "null", "~", "true", "false", "yes", "no", "on", "off", "y", "n":
+		return strconv.Quote(s)
+	}
+	// Numbers, dates, and indicators.
+	if strings.ContainsAny(s[:1], "0123456789.+-?") {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestYAMLString(t *testing.T) {
+	for _, tt := range []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"two words", "two words"},
+		{"", `""`},
+		{"123", `"123"`},
+		{"2026-10-16", `"2026-10-16"`},
+		{"true", `"true"`},
+		{"Off", `"Off"`},
+		{"a: b", `"a: b"`},
+		{"-dash", `"-dash"`},
+		{" padded", `" padded"`},
+		{"line\nbreak", `"line\nbreak"`},
+		{"71.5°F", `"71.5°F"`},
+	} {
+		if got := yamlString(tt.in); got != tt.want {
+			t.Errorf("yamlString(%q): got %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRenderYAML(t *testing.T) {
+	n, err := parseNode([]byte(`{"name":"Main Floor","count":2,"tags":["a","b"],"empty":[],"nested":[{"z":1,"a":2},{"b":3}],"extra":{},"deep":[[1,2]],"nil":null}`))
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	var b bytes.Buffer
+	n.writeYAML(&b, 0)
+	want := `name: Main Floor
+count: 2
+tags:
+  - a
+  - b
+empty: []
+nested:
+  - z: 1
+    a: 2
+  - b: 3
+extra: {}
+deep:
+  - - 1
+    - 2
+nil: null
+`
+	if b.String() != want {
+		t.Errorf("got:\n%v\nwant:\n%v", b.String(), want)
+	}
+}
+
+func TestNodeRoundTrip(t *testing.T) {
+	in := `{"z":[1,"two",true,null,{"b":{},"a":[]}],"a":1.5}`
+	n, err := parseNode([]byte(in))
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	got, err := n.MarshalJSON()
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if string(got) != in {
+		t.Errorf("got %v, want %v", string(got), in)
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	n, err := parseNode([]byte(`{"name":"Main","runtime":{"connected":true,"desiredHeat":0},"sensors":[{"id":"rs:100"},{"id":""}]}`))
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	var got []string
+	n.flatten("", func(path, value string) { got = append(got, path+"="+value) })
+	want := "name=Main runtime.connected=true sensors[0].id=rs:100"
+	if strings.Join(got, " ") != want {
+		t.Errorf("got %v, want %v", strings.Join(got, " "), want)
+	}
+}
+
+func TestRender(t *testing.T) {
+	v := listView{{Identifier: "123", Name: "Main Floor", Mode: "heat", Temperature: 70.5, Humidity: 40, DesiredHeat: 70, DesiredCool: 78, Units: "F", Connected: true}}
+	for _, tt := range []struct {
+		format string
+		want   string
+	}{
+		{outputTable, "ID   NAME        MODE  TEMPERATURE  HUMIDITY  HEAT    COOL    CONNECTED\n123  Main Floor  heat  70.5°F       40%       70.0°F  78.0°F  true\n"},
+		{outputJSON, "[\n  {\n    \"identifier\": \"123\",\n"},
+		{outputYAML, "- identifier: \"123\"\n  name: Main Floor\n  modelNumber: \"\"\n"},
+	} {
+		var b bytes.Buffer
+		if err := render(&b, v, tt.format); err != nil {
+			t.Fatalf("%v: got unexpected error: %v", tt.format, err)
+		}
+		if !strings.HasPrefix(b.String(), tt.want) {
+			t.Errorf("%v: got:\n%v\nwant prefix:\n%v", tt.format, b.String(), tt.want)
+		}
+	}
+	if err := render(&bytes.Buffer{}, v, "xml"); err == nil {
+		t.Error("expected error for unknown format, got nil")
+	}
+}
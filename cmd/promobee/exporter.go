@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/cfunkhouser/egobee"
+)
+
+// exporterSelection is the data retrieved for each thermostat.
+var exporterSelection = egobee.Selection{
+	SelectionType:          egobee.SelectionTypeRegistered,
+	IncludeRuntime:         true,
+	IncludeSettings:        true,
+	IncludeSensors:         true,
+	IncludeWeather:         true,
+	IncludeEquipmentStatus: true,
+}
+
+// hvacModes reported by the ecobee_hvac_mode metric.
+var hvacModes = []string{"auto", "auxHeatOnly", "cool", "heat", "off"}
+
+// equipment reported by the ecobee_equipment_running metric.
+var equipment = []egobee.Equipment{
+	egobee.EquipmentHeatPump,
+	egobee.EquipmentHeatPump2,
+	egobee.EquipmentHeatPump3,
+	egobee.EquipmentCompCool1,
+	egobee.EquipmentCompCool2,
+	egobee.EquipmentAuxHeat1,
+	egobee.EquipmentAuxHeat2,
+	egobee.EquipmentAuxHeat3,
+	egobee.EquipmentFan,
+	egobee.EquipmentHumidifier,
+	egobee.EquipmentDehumidifier,
+	egobee.EquipmentVentilator,
+	egobee.EquipmentEconomizer,
+	egobee.EquipmentCompHotWater,
+	egobee.EquipmentAuxHotWater,
+}
+
+// unknownWeatherValue is reported by ecobee for weather values which are not
+// available.
+const unknownWeatherValue = -5002
+
+// exporter caches the latest state of each thermostat, as reported by a
+// Watcher, and serves it as Prometheus metrics. Scrapes never make API
+// requests, so they may be as frequent as desired. Thermostats which the
+// Watcher reports removed are forgotten, so their series are no longer served.
+type exporter struct {
+	mu          sync.Mutex // protects the following members
+	thermostats map[string]*egobee.Thermostat
+	updates     int
+	errors      int
+}
+
+func newExporter() *exporter {
+	return &exporter{thermostats: make(map[string]*egobee.Thermostat)}
+}
+
+// watch c for changes to thermostats until ctx is done.
+func (e *exporter) watch(ctx context.Context, c *egobee.Client, opts *egobee.WatcherOptions) error {
+	sel := exporterSelection
+	o := *opts
+	o.Selection = &sel
+	o.OnError = func(err error) {
+		log.Printf("Failed to poll thermostats: %v", err)
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.errors++
+	}
+	w := egobee.NewWatcher(c, &o)
+	go func() {
+		for ev := range w.Events() {
+			if ev.Changes.Has(egobee.ChangeRemoved) {
+				e.remove(ev.Revision.Identifier)
+				continue
+			}
+			e.update(ev.Thermostat)
+		}
+	}()
+	return w.Run(ctx)
+}
+
+func (e *exporter) update(t *egobee.Thermostat) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.thermostats[t.Identifier] = t
+	e.updates++
+}
+
+func (e *exporter) remove(id string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.thermostats, id)
+}
+
+// collect the current metrics.
+func (e *exporter) collect() *metricSet {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	m := newMetricSet()
+	m.counter("ecobee_thermostat_updates_total", "Number of times changed thermostat data was retrieved.", float64(e.updates))
+	m.counter("ecobee_poll_errors_total", "Number of failed attempts to poll the ecobee API.", float64(e.errors))
+
+	ids := make([]string, 0, len(e.thermostats))
+	for id := range e.thermostats {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		collectThermostat(m, e.thermostats[id])
+	}
+	return m
+}
+
+func collectThermostat(m *metricSet, t *egobee.Thermostat) {
+	labels := []string{"thermostat_id", t.Identifier, "thermostat_name", t.Name}
+	m.gauge("ecobee_connected", "Whether the thermostat is connected to the ecobee servers.", boolValue(t.Runtime.Connected), labels...)
+	m.gauge("ecobee_actual_temperature_celsius", "Temperature reported by the thermostat.", t.Runtime.ActualTemperature.Celsius(), labels...)
+	m.gauge("ecobee_desired_heat_temperature_celsius", "Temperature below which the thermostat heats.", t.Runtime.DesiredHeat.Celsius(), labels...)
+	m.gauge("ecobee_desired_cool_temperature_celsius", "Temperature above which the thermostat cools.", t.Runtime.DesiredCool.Celsius(), labels...)
+	m.gauge("ecobee_actual_humidity_percent", "Humidity reported by the thermostat.", float64(t.Runtime.ActualHumidity), labels...)
+	m.gauge("ecobee_desired_humidity_percent", "Humidity below which the thermostat humidifies.", float64(t.Runtime.DesiredHumidity), labels...)
+	m.gauge("ecobee_desired_dehumidity_percent", "Humidity above which the thermostat dehumidifies.", float64(t.Runtime.DesiredDehumidity), labels...)
+
+	for _, mode := range hvacModes {
+		m.gauge("ecobee_hvac_mode", "The thermostat's HVAC mode; 1 for the current mode.", boolValue(t.Settings.HVACMode == mode), append(labels, "mode", mode)...)
+	}
+	running := egobee.ParseEquipment(t.EquipmentStatus)
+	for _, eq := range equipment {
+		m.gauge("ecobee_equipment_running", "Whether the equipment is running.", boolValue(running[eq]), append(labels, "equipment", string(eq))...)
+	}
+
+	for _, s := range t.RemoteSensors {
+		sensorLabels := append(labels, "sensor_id", s.ID, "sensor_name", s.Name, "sensor_type", s.Type)
+		if temp, err := s.Temperature(); err == nil {
+			m.gauge("ecobee_sensor_temperature_celsius", "Temperature reported by the sensor.", temp.Celsius(), sensorLabels...)
+		}
+		if h, err := s.Humidity(); err == nil {
+			m.gauge("ecobee_sensor_humidity_percent", "Humidity reported by the sensor.", float64(h), sensorLabels...)
+		}
+		if o, err := s.Occupancy(); err == nil {
+			m.gauge("ecobee_sensor_occupied", "Whether the sensor detects occupancy.", boolValue(o), sensorLabels...)
+		}
+	}
+
+	if len(t.Weather.Forecasts) > 0 {
+		f := t.Weather.Forecasts[0]
+		if f.Temperature != unknownWeatherValue {
+			m.gauge("ecobee_weather_temperature_celsius", "Outdoor temperature forecast for the thermostat's location.", f.Temperature.Celsius(), labels...)
+		}
+		if f.Dewpoint != unknownWeatherValue {
+			m.gauge("ecobee_weather_dewpoint_celsius", "Outdoor dewpoint forecast for the thermostat's location.", f.Dewpoint.Celsius(), labels...)
+		}
+		if f.RelativeHumidity != unknownWeatherValue {
+			m.gauge("ecobee_weather_humidity_percent", "Outdoor relative humidity forecast for the thermostat's location.", float64(f.RelativeHumidity), labels...)
+		}
+		if f.Pressure != unknownWeatherValue {
+			m.gauge("ecobee_weather_pressure_millibars", "Outdoor air pressure forecast for the thermostat's location.", float64(f.Pressure), labels...)
+		}
+	}
+}
+
+// ServeHTTP serves the metrics.
+func (e *exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := e.collect().WriteTo(w); err != nil {
+		log.Printf("Failed to write metrics: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cfunkhouser/egobee"
+	"github.com/cfunkhouser/egobee/egobeetest"
+)
+
+func TestMetricSet(t *testing.T) {
+	m := newMetricSet()
+	m.gauge("a_gauge", "A gauge.", 1.5, "name", `Living "Room"`)
+	m.counter("a_counter", "A counter.", 3)
+	m.gauge("a_gauge", "A gauge.", -2, "name", "Back\\Room\n")
+	var b strings.Builder
+	if _, err := m.WriteTo(&b); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	want := `# HELP a_gauge A gauge.
+# TYPE a_gauge gauge
+a_gauge{name="Living \"Room\""} 1.5
+a_gauge{name="Back\\Room\n"} -2
+# HELP a_counter A counter.
+# TYPE a_counter counter
+a_counter 3
+`
+	if b.String() != want {
+		t.Errorf("got:\n%v\nwant:\n%v", b.String(), want)
+	}
+}
+
+func TestExporter(t *testing.T) {
+	s := egobeetest.NewServer(&egobee.Thermostat{
+		Identifier:      "123",
+		Name:            "Main Floor",
+		EquipmentStatus: "fan,auxHeat1",
+		Runtime: egobee.Runtime{
+			Connected:         true,
+			ActualTemperature: egobee.FromCelsius(21),
+			ActualHumidity:    40,
+			DesiredHeat:       egobee.FromCelsius(20),
+		},
+		Settings: egobee.Settings{HVACMode: "heat"},
+		RemoteSensors: []egobee.RemoteSensor{{
+			ID:   "rs:100",
+			Name: "Bedroom",
+			Type: "ecobee3_remote_sensor",
+			Capability: []egobee.RemoteSensorCapability{
+				{Type: egobee.CapabilityTypeTemperature, Value: "662"},
+				{Type: egobee.CapabilityTypeOccupancy, Value: "true"},
+			},
+		}},
+		Weather: egobee.Weather{Forecasts: []egobee.WeatherForecast{{
+			Temperature:      320,
+			Dewpoint:         unknownWeatherValue,
+			RelativeHumidity: 80,
+			Pressure:         1013,
+		}}},
+	})
+	defer s.Close()
+
+	e := newExporter()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.watch(ctx, s.Client(), &egobee.WatcherOptions{})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		e.mu.Lock()
+		updates := e.updates
+		e.mu.Unlock()
+		if updates > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("thermostat was never retrieved")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	got := rec.Body.String()
+	labels := `thermostat_id="123",thermostat_name="Main Floor"`
+	sensor := labels + `,sensor_id="rs:100",sensor_name="Bedroom",sensor_type="ecobee3_remote_sensor"`
+	for _, want := range []string{
+		"ecobee_thermostat_updates_total 1",
+		"ecobee_connected{" + labels + "} 1",
+		"ecobee_actual_temperature_celsius{" + labels + "} 21",
+		"ecobee_desired_heat_temperature_celsius{" + labels + "} 20",
+		"ecobee_actual_humidity_percent{" + labels + "} 40",
+		"ecobee_hvac_mode{" + labels + `,mode="heat"} 1`,
+		"ecobee_hvac_mode{" + labels + `,mode="cool"} 0`,
+		"ecobee_equipment_running{" + labels + `,equipment="auxHeat1"} 1`,
+		"ecobee_equipment_running{" + labels + `,equipment="compCool1"} 0`,
+		"ecobee_sensor_temperature_celsius{" + sensor + "} 19",
+		"ecobee_sensor_occupied{" + sensor + "} 1",
+		"ecobee_weather_temperature_celsius{" + labels + "} 0",
+		"ecobee_weather_pressure_millibars{" + labels + "} 1013",
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+	for _, unwanted := range []string{"ecobee_weather_dewpoint_celsius", "ecobee_sensor_humidity_percent"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("metrics unexpectedly include %v", unwanted)
+		}
+	}
+}
+
+func TestExporterRemove(t *testing.T) {
+	e := newExporter()
+	e.update(&egobee.Thermostat{Identifier: "1", Name: "One"})
+	e.update(&egobee.Thermostat{Identifier: "2", Name: "Two"})
+	e.remove("1")
+
+	var b strings.Builder
+	if _, err := e.collect().WriteTo(&b); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	got := b.String()
+	if strings.Contains(got, `thermostat_id="1"`) {
+		t.Errorf("metrics still include removed thermostat:\n%v", got)
+	}
+	if !strings.Contains(got, `ecobee_connected{thermostat_id="2",thermostat_name="Two"} 0`+"\n") {
+		t.Errorf("metrics missing remaining thermostat:\n%v", got)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// metricFamily is a set of samples sharing a name, in the Prometheus text
+// exposition format.
+type metricFamily struct {
+	name, help, typ string
+	samples         []string
+}
+
+// metricSet accumulates metric families for exposition.
+type metricSet struct {
+	families []*metricFamily
+	byName   map[string]*metricFamily
+}
+
+func newMetricSet() *metricSet {
+	return &metricSet{byName: make(map[string]*metricFamily)}
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// add a sample to the family name, creating it if necessary. labels are
+// alternating names and values.
+func (m *metricSet) add(typ, name, help string, value float64, labels ...string) {
+	f, ok := m.byName[name]
+	if !ok {
+		f = &metricFamily{name: name, help: help, typ: typ}
+		m.byName[name] = f
+		m.families = append(m.families, f)
+	}
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, `%v="%v"`, labels[i], labelValueEscaper.Replace(labels[i+1]))
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	f.samples = append(f.samples, b.String())
+}
+
+// gauge adds a sample to a gauge family.
+func (m *metricSet) gauge(name, help string, value float64, labels ...string) {
+	m.add("gauge", name, help, value, labels...)
+}
+
+// counter adds a sample to a counter family.
+func (m *metricSet) counter(name, help string, value float64, labels ...string) {
+	m.add("counter", name, help, value, labels...)
+}
+
+// WriteTo writes every family in the order they were first added.
+func (m *metricSet) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, f := range m.families {
+		fmt.Fprintf(cw, "# HELP %v %v\n", f.name, f.help)
+		fmt.Fprintf(cw, "# TYPE %v %v\n", f.name, f.typ)
+		for _, s := range f.samples {
+			fmt.Fprintln(cw, s)
+		}
+	}
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, cw.w.Flush()
+}
+
+// countingWriter counts bytes written, and remembers the first error.
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+// boolValue converts b to a sample value.
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,46 @@
+// promobee exports the state of all registered thermostats and their sensors as
+// Prometheus metrics. Thermostats are only retrieved when their revisions in
+// the thermostat summary change, so /metrics may be scraped as often as
+// desired.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/cfunkhouser/egobee"
+)
+
+var (
+	appID     = flag.String("app", "", "Ecobee Registered App ID")
+	storePath = flag.String("store", "/tmp/promobee", "Persistent egobee credential store path")
+	listen    = flag.String("listen", ":9442", "Address on which to serve /metrics")
+	interval  = flag.Duration("interval", egobee.MinWatchInterval, "Interval at which to poll the thermostat summary")
+)
+
+func main() {
+	flag.Parse()
+	if *appID == "" {
+		log.Fatal("--app is required.")
+	}
+	if *storePath == "" {
+		log.Fatal("--store is required")
+	}
+
+	ts, err := egobee.NewPersistentTokenFromDisk(*storePath)
+	if err != nil {
+		log.Fatalf("Failed to initialize store %q: %v", *storePath, err)
+	}
+	c := egobee.New(*appID, ts)
+
+	e := newExporter()
+	go func() {
+		log.Fatal(e.watch(context.Background(), c, &egobee.WatcherOptions{Interval: *interval}))
+	}()
+
+	http.Handle("/metrics", e)
+	log.Printf("Serving metrics on %v/metrics", *listen)
+	log.Fatal(http.ListenAndServe(*listen, nil))
+}
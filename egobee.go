@@ -3,12 +3,16 @@
 package egobee
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"io/ioutil"
 	"net/http"
 	"net/http/httputil"
+	"sync"
 	"time"
 )
 
@@ -24,12 +28,15 @@ const (
 	// These API Paths are relative to the API Host above.
 	thermostatSummaryURL = "/1/thermostatSummary"
 	thermostatURL        = "/1/thermostat"
+	runtimeReportURL     = "/1/runtimeReport"
+	authorizeURL         = "/authorize"
 	tokenURL             = "/token"
 )
 
 type reauthResponse struct {
-	Err  *AuthorizationErrorResponse
-	Resp *TokenRefreshResponse
+	Err        *AuthorizationErrorResponse
+	Resp       *TokenRefreshResponse
+	statusCode int // HTTP status code of the response
 }
 
 func (r *reauthResponse) ok() bool {
@@ -40,14 +47,28 @@ func (r *reauthResponse) ok() bool {
 }
 
 func (r *reauthResponse) err() error {
-	if r.Err != nil && r.Err.Error != "" && r.Err.Description != "" {
-		return fmt.Errorf("unable to re-authenticate: %v: %v", r.Err.Error, r.Err.Description)
+	if err := r.authError(); err != nil {
+		return fmt.Errorf("unable to re-authenticate: %w", err)
 	}
 	return errors.New("unable to re-authenticate for unknown reasons")
 }
 
+// authError returns the *AuthError described by the response, or nil if the
+// response does not describe one.
+func (r *reauthResponse) authError() *AuthError {
+	if r.Err == nil || r.Err.Error == "" {
+		return nil
+	}
+	return &AuthError{
+		HTTPStatusCode: r.statusCode,
+		Code:           r.Err.Error,
+		Description:    r.Err.Description,
+		URI:            r.Err.URI,
+	}
+}
+
 func reauthResponseFromHTTPResponse(resp *http.Response) (*reauthResponse, error) {
-	r := &reauthResponse{}
+	r := &reauthResponse{statusCode: resp.StatusCode}
 	if (resp.StatusCode / 100) != 2 {
 		r.Err = &AuthorizationErrorResponse{}
 		if err := r.Err.Populate(resp.Body); err != nil {
@@ -69,42 +90,283 @@ type authorizingTransport struct {
 	transport http.RoundTripper
 	appID     string
 	api       apiBaseURL
+	leadTime  time.Duration // refresh this long before expiry
+	log       Logger        // of token refreshes; may be nil
+	hooks     tokenHooks
+
+	mu         sync.Mutex   // protects the following members
+	inflight   *refreshCall // the token refresh in progress, if any
+	refreshErr error        // from the last token refresh, if it failed
+}
+
+// refreshCall is a token refresh shared by every request which needs it.
+type refreshCall struct {
+	done chan struct{} // closed when the refresh completes
+	err  error
 }
 
 func (t *authorizingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	if t.shouldReauth() {
-		if err := t.reauth(); err != nil {
+	if stale := t.auth.AccessToken(); t.shouldReauth() {
+		if err := t.reauth(req.Context(), stale); err != nil {
 			return nil, err
 		}
 	}
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %v", t.auth.AccessToken()))
-	return t.transport.RoundTrip(req)
+	getBody, err := replayableBody(req)
+	if err != nil {
+		return nil, err
+	}
+	token := t.auth.AccessToken()
+	res, err := t.transport.RoundTrip(authorize(req, getBody, token))
+	if err != nil {
+		return nil, err
+	}
+	expired, err := isTokenExpiredResponse(res)
+	if err != nil || !expired {
+		return res, err
+	}
+
+	// The API considers the access token expired, even though the store did
+	// not. Refresh once and replay the original request with the new token.
+	res.Body.Close()
+	if err := t.reauth(req.Context(), token); err != nil {
+		return nil, err
+	}
+	return t.transport.RoundTrip(authorize(req, getBody, t.auth.AccessToken()))
+}
+
+// authorize returns a copy of req bearing the access token, with a fresh copy of
+// the request body from getBody if there is one.
+func authorize(req *http.Request, getBody func() (io.ReadCloser, error), token string) *http.Request {
+	r := req.Clone(req.Context())
+	if getBody != nil {
+		// getBody only fails if reading the original body failed, and that was
+		// already checked by replayableBody.
+		r.Body, _ = getBody()
+	}
+	r.Header.Set("Authorization", fmt.Sprintf("Bearer %v", token))
+	return r
+}
+
+// replayableBody returns a function which produces a new copy of the body of
+// req each time it is called, buffering the body in memory if req does not
+// already provide GetBody. It returns nil if req has no body.
+func replayableBody(req *http.Request) (func() (io.ReadCloser, error), error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		// Every attempt uses a copy from GetBody, so the original is unused.
+		req.Body.Close()
+		return req.GetBody, nil
+	}
+	b, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to buffer request body: %v", err)
+	}
+	return func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}, nil
+}
+
+// isTokenExpiredResponse reports whether res carries an ecobee status
+// indicating that the access token has expired. The body of res is buffered
+// and replaced, so that it may still be read by the caller.
+func isTokenExpiredResponse(res *http.Response) (bool, error) {
+	if (res.StatusCode/100) == 2 || res.Body == nil {
+		return false, nil
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return false, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(b))
+	sr := &statusResponse{}
+	if err := json.Unmarshal(b, sr); err != nil {
+		return false, nil
+	}
+	return sr.Status.Code == StatusCodeAuthenticationExpired, nil
+}
+
+// lastRefreshError returns the error from the last token refresh, or nil if it
+// succeeded or there has been none.
+func (t *authorizingTransport) lastRefreshError() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.refreshErr
+}
+
+// clearRefreshError forgets the error from the last token refresh, once the
+// TokenStorer has been given tokens which do not share its cause.
+func (t *authorizingTransport) clearRefreshError() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.refreshErr = nil
 }
 
 func (t *authorizingTransport) shouldReauth() bool {
-	// TODO(cfunkhouser): make the timeout customizable.
-	return (t.auth.ValidFor() < (time.Second * 15)) || (t.auth.AccessToken() == "")
+	leadTime := t.leadTime
+	if leadTime == 0 {
+		leadTime = defaultRefreshLeadTime
+	}
+	return (t.auth.ValidFor() < leadTime) || (t.auth.AccessToken() == "")
 }
 
-func (t *authorizingTransport) sendReauth(url string) (*reauthResponse, error) {
+func (t *authorizingTransport) sendReauth(ctx context.Context, url string) (*reauthResponse, error) {
 	tokenURL := fmt.Sprintf("%v?grant_type=refresh_token&refresh_token=%v&client_id=%v", url, t.auth.RefreshToken(), t.appID)
-	resp, err := http.Post(tokenURL, "", nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, nil)
 	if err != nil {
 		return nil, err
 	}
+	// The refresh request must not pass through this transport, or it would
+	// attempt to authorize itself.
+	resp, err := (&http.Client{Transport: t.transport}).Do(req)
+	if err != nil {
+		return nil, redactURLError(err)
+	}
 	defer resp.Body.Close()
 	return reauthResponseFromHTTPResponse(resp)
 }
 
-func (t *authorizingTransport) reauth() error {
-	r, err := t.sendReauth(t.api.URL(tokenURL))
+// reauth refreshes the access token, if it is still stale. Concurrent callers
+// share a single refresh: since the API rotates the refresh token, only the
+// first of several simultaneous refreshes could succeed anyway.
+//
+// The refresh itself is not abandoned when ctx is done, as the API may already
+// have rotated the refresh token; losing the response would lose the only
+// valid refresh token. The caller stops waiting for it, though.
+func (t *authorizingTransport) reauth(ctx context.Context, stale string) error {
+	t.mu.Lock()
+	call := t.inflight
+	if call == nil {
+		if t.auth.AccessToken() != stale {
+			// Another request refreshed the token while this one was in flight.
+			t.mu.Unlock()
+			return nil
+		}
+		call = &refreshCall{done: make(chan struct{})}
+		t.inflight = call
+		go func() {
+			rctx, cancel := context.WithTimeout(detachedContext{ctx}, refreshTimeout)
+			defer cancel()
+			call.err = t.refresh(rctx, stale)
+			t.mu.Lock()
+			t.inflight = nil
+			t.refreshErr = call.err
+			t.mu.Unlock()
+			close(call.done)
+		}()
+	}
+	t.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// refreshTimeout bounds the time a token refresh may take.
+const refreshTimeout = time.Minute
+
+// reauthorizationTimeout bounds the time the NeedsReauthorization hook may take,
+// which is long enough for the user to enter a PIN before it expires.
+const reauthorizationTimeout = 15 * time.Minute
+
+// detachedContext carries the values of its parent Context, but not its
+// deadline or cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// refresh exchanges the refresh token for a new access token, and updates the
+// TokenStorer with the result.
+//
+// If the TokenStorer is a RefreshLocker, its lock is held throughout, and the
+// refresh is skipped if another process has already replaced the stale access
+// token. The token hooks from Options are called with the outcome, and the
+// NeedsReauthorization hook replaces a rejected refresh token. The lock is still
+// held while that hook runs, so other processes sharing the TokenStorer wait for
+// its tokens rather than asking the user to authorize again themselves.
+func (t *authorizingTransport) refresh(ctx context.Context, stale string) error {
+	if l, ok := t.auth.(RefreshLocker); ok {
+		unlock, err := l.LockRefresh(ctx)
+		if err != nil {
+			logAt(t.log, LevelWarn, "Failed to lock token store", "error", err)
+			return err
+		}
+		defer unlock()
+		if t.auth.AccessToken() != stale && !t.shouldReauth() {
+			logAt(t.log, LevelInfo, "Access token was refreshed by another process", "validFor", t.auth.ValidFor())
+			return nil
+		}
+	}
+	resp, err := t.sendRefresh(ctx)
+	if err != nil && t.hooks.needsReauthorization != nil && requiresReauthorization(err) {
+		logAt(t.log, LevelWarn, "Refresh token rejected, reauthorizing", "error", err)
+		resp, err = t.reauthorize(ctx, err)
+	}
 	if err != nil {
+		logAt(t.log, LevelWarn, "Failed to refresh access token", "error", err)
+		if t.hooks.onRefreshFailed != nil {
+			t.hooks.onRefreshFailed(err)
+		}
 		return err
 	}
+	logAt(t.log, LevelInfo, "Refreshed access token", "validFor", t.auth.ValidFor())
+	if t.hooks.onTokenRefreshed != nil {
+		t.hooks.onTokenRefreshed(resp)
+	}
+	return nil
+}
+
+func (t *authorizingTransport) sendRefresh(ctx context.Context) (*TokenRefreshResponse, error) {
+	r, err := t.sendReauth(ctx, t.api.URL(tokenURL))
+	if err != nil {
+		return nil, err
+	}
 	if !r.ok() {
-		return r.err()
+		return nil, r.err()
+	}
+	return r.Resp, t.auth.Update(r.Resp)
+}
+
+// requiresReauthorization reports whether err means that the refresh token is
+// no longer valid, and the user must authorize the application again.
+func requiresReauthorization(err error) bool {
+	return IsAuthorizationError(err, AuthorizationErrorInvalidGrant) ||
+		IsAuthorizationError(err, AuthorizationErrorAuthorizationExpired)
+}
+
+// reauthorize obtains new tokens from the NeedsReauthorization hook after the
+// refresh token was rejected with refreshErr, and updates the TokenStorer with
+// them. If that fails, the returned error still wraps refreshErr.
+//
+// The hook is given longer than refreshTimeout, as the user takes part.
+func (t *authorizingTransport) reauthorize(ctx context.Context, refreshErr error) (*TokenRefreshResponse, error) {
+	ctx, cancel := context.WithTimeout(detachedContext{ctx}, reauthorizationTimeout)
+	defer cancel()
+	resp, err := t.hooks.needsReauthorization(ctx)
+	if err == nil && resp == nil {
+		err = errors.New("no tokens returned")
+	}
+	if err == nil {
+		err = t.auth.Update(resp)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w (reauthorization failed: %v)", refreshErr, err)
 	}
-	return t.auth.Update(r.Resp)
+	return resp, nil
 }
 
 func simpleRequestID() string {
@@ -112,34 +374,130 @@ func simpleRequestID() string {
 }
 
 // loggingTransport is a RoundTripper which wraps a RoundTripper and logs every
-// HTTP request and response to a Logger.
+// HTTP request and response to a Logger at LevelDebug, and failed requests at
+// LevelError. Credentials are redacted unless logTokens is set.
 type loggingTransport struct {
-	l         *log.Logger
+	l         Logger
+	logTokens bool
 	transport http.RoundTripper
 }
 
+func (t *loggingTransport) redact(s string) string {
+	if t.logTokens {
+		return s
+	}
+	return redact(s)
+}
+
 func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	id := simpleRequestID()
-	if rb, err := httputil.DumpRequest(req, true); err == nil {
-		t.l.Printf("Outgoing Request %v:\n%+v\n<< END %v", id, string(rb), id)
+	if t.l.Enabled(LevelDebug) {
+		if rb, err := httputil.DumpRequest(req, true); err == nil {
+			t.l.Log(LevelDebug, "Outgoing request", "id", id, "request", t.redact(string(rb)))
+		}
 	}
 	r, err := t.transport.RoundTrip(req)
 	if err != nil {
-		t.l.Printf("Error %v: %v", id, err)
-	} else if rb, err := httputil.DumpResponse(r, true); err == nil {
-		t.l.Printf("Incoming Response to %v:\n%+v\n<< END resp %v", id, string(rb), id)
+		t.l.Log(LevelError, "Request failed", "id", id, "url", t.redact(req.URL.String()), "error", t.redact(err.Error()))
+	} else if t.l.Enabled(LevelDebug) {
+		if rb, err := httputil.DumpResponse(r, true); err == nil {
+			t.l.Log(LevelDebug, "Incoming response", "id", id, "status", r.StatusCode, "response", t.redact(string(rb)))
+		}
 	}
 	return r, err
 }
 
+// userAgentTransport is a RoundTripper which sets the User-Agent header on
+// every request.
+type userAgentTransport struct {
+	userAgent string
+	transport http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.Header.Set("User-Agent", t.userAgent)
+	return t.transport.RoundTrip(r)
+}
+
+// defaultRefreshLeadTime is used when Options.RefreshLeadTime is unset.
+const defaultRefreshLeadTime = 30 * time.Second
+
 // Options to New.
 type Options struct {
 	// APIHost for Ecobee API requests. Defaults to https://api.ecobee.com.
 	APIHost string
 	// Log all requests to LogTo if true.
 	Log bool
-	// LogTo gets all requests and responses to this Writer verbosely.
+	// LogTo gets all requests and responses to this Writer verbosely. Setting
+	// Log and LogTo is equivalent to setting Logger to
+	// NewWriterLogger(LogTo, LevelDebug).
 	LogTo io.Writer
+	// Logger receives every request and response at LevelDebug, token refreshes
+	// at LevelInfo, and failures at higher levels. It takes precedence over Log
+	// and LogTo.
+	Logger Logger
+	// LogTokens disables the redaction of access tokens, refresh tokens and
+	// authorization codes from logs. Anyone able to read such logs can act as
+	// the user, so it should only be set while debugging.
+	LogTokens bool
+	// RefreshLeadTime is how long before the access token expires that it is
+	// refreshed. This allows for network and processing delays. Defaults to 30
+	// seconds.
+	RefreshLeadTime time.Duration
+	// Transport used to make HTTP requests, including token refreshes. Defaults
+	// to http.DefaultTransport.
+	Transport http.RoundTripper
+	// Timeout for each request made by the Client, including any token refresh
+	// it requires. Zero means no timeout.
+	Timeout time.Duration
+	// UserAgent sent with every request. Defaults to the Go HTTP client's.
+	UserAgent string
+
+	// The following hooks are called by the Client while refreshing tokens, so
+	// must not make requests with it. Concurrent requests needing a refresh
+	// share one, and so call the hooks once.
+
+	// OnTokenRefreshed, if set, is called with the new tokens after each
+	// successful refresh, once the TokenStorer has been updated.
+	OnTokenRefreshed func(*TokenRefreshResponse)
+	// OnRefreshFailed, if set, is called with the error from each failed
+	// refresh, which is also returned by the request needing it. If the refresh
+	// token was rejected, the error satisfies IsAuthorizationError with
+	// AuthorizationErrorInvalidGrant or AuthorizationErrorAuthorizationExpired.
+	OnRefreshFailed func(error)
+	// NeedsReauthorization, if set, is called when the API rejects the refresh
+	// token with AuthorizationErrorInvalidGrant or
+	// AuthorizationErrorAuthorizationExpired, meaning that the user must
+	// authorize the application again, such as by a PinAuthorizer. The tokens it
+	// returns replace those in the TokenStorer, and requests waiting for the
+	// refresh then continue with them. A request which reaches its Timeout or
+	// whose Context is done stops waiting, but the hook is not interrupted, and
+	// later requests use the tokens it returns. If it fails, the refresh fails.
+	//
+	// The hook should return once ctx is done, which is 15 minutes after it is
+	// called. If the TokenStorer is a RefreshLocker, such as a store returned by
+	// NewPersistentTokenFromDisk, its lock is held until the hook returns, and
+	// so other processes sharing the store wait for it too.
+	NeedsReauthorization func(ctx context.Context) (*TokenRefreshResponse, error)
+}
+
+// tokenHooks are the token lifecycle hooks from Options.
+type tokenHooks struct {
+	onTokenRefreshed     func(*TokenRefreshResponse)
+	onRefreshFailed      func(error)
+	needsReauthorization func(context.Context) (*TokenRefreshResponse, error)
+}
+
+func (o *Options) hooks() tokenHooks {
+	if o == nil {
+		return tokenHooks{}
+	}
+	return tokenHooks{
+		onTokenRefreshed:     o.OnTokenRefreshed,
+		onRefreshFailed:      o.OnRefreshFailed,
+		needsReauthorization: o.NeedsReauthorization,
+	}
 }
 
 func (o *Options) apiHost() apiBaseURL {
@@ -149,16 +507,79 @@ func (o *Options) apiHost() apiBaseURL {
 	return apiBaseURL(o.APIHost)
 }
 
-func (o *Options) log() (io.Writer, bool) {
+// logger returns the Logger to which requests are logged, or nil if they are
+// not.
+func (o *Options) logger() Logger {
+	switch {
+	case o == nil:
+		return nil
+	case o.Logger != nil:
+		return o.Logger
+	case o.Log && o.LogTo != nil:
+		return NewWriterLogger(o.LogTo, LevelDebug)
+	}
+	return nil
+}
+
+func (o *Options) logTokens() bool {
+	return o != nil && o.LogTokens
+}
+
+// logging wraps trans in a loggingTransport, if requests are logged.
+func (o *Options) logging(trans http.RoundTripper) http.RoundTripper {
+	l := o.logger()
+	if l == nil {
+		return trans
+	}
+	return &loggingTransport{
+		l:         l,
+		logTokens: o.logTokens(),
+		transport: trans,
+	}
+}
+
+func (o *Options) refreshLeadTime() time.Duration {
+	if o == nil || o.RefreshLeadTime == 0 {
+		return defaultRefreshLeadTime
+	}
+	return o.RefreshLeadTime
+}
+
+// transport returns the RoundTripper on which all others are layered.
+func (o *Options) transport() http.RoundTripper {
+	var t http.RoundTripper = http.DefaultTransport
+	if o != nil && o.Transport != nil {
+		t = o.Transport
+	}
+	if o != nil && o.UserAgent != "" {
+		t = &userAgentTransport{
+			userAgent: o.UserAgent,
+			transport: t,
+		}
+	}
+	return t
+}
+
+func (o *Options) timeout() time.Duration {
 	if o == nil {
-		return nil, false
+		return 0
+	}
+	return o.Timeout
+}
+
+// httpClient returns an *http.Client configured according to the Options, for
+// requests which do not require an access token.
+func (o *Options) httpClient() *http.Client {
+	return &http.Client{
+		Transport: o.logging(o.transport()),
+		Timeout:   o.timeout(),
 	}
-	return o.LogTo, o.Log
 }
 
 // Client for the ecobee API.
 type Client struct {
-	api apiBaseURL
+	api  apiBaseURL
+	auth *authorizingTransport
 	http.Client
 }
 
@@ -170,22 +591,21 @@ func New(appID string, ts TokenStorer, opts ...*Options) *Client {
 	if len(opts) > 0 {
 		opt = opts[0]
 	}
-	var trans http.RoundTripper = &authorizingTransport{
+	auth := &authorizingTransport{
 		auth:      ts,
-		transport: http.DefaultTransport,
+		transport: opt.transport(),
 		appID:     appID,
 		api:       opt.apiHost(),
-	}
-	if w, doLog := opt.log(); doLog {
-		trans = &loggingTransport{
-			l:         log.New(w, "", log.LstdFlags),
-			transport: trans,
-		}
+		leadTime:  opt.refreshLeadTime(),
+		log:       opt.logger(),
+		hooks:     opt.hooks(),
 	}
 	return &Client{
-		api: opt.apiHost(),
+		api:  opt.apiHost(),
+		auth: auth,
 		Client: http.Client{
-			Transport: trans,
+			Transport: opt.logging(auth),
+			Timeout:   opt.timeout(),
 		},
 	}
 }
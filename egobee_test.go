@@ -1,8 +1,17 @@
 package egobee
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -163,3 +172,563 @@ func TestOptions_APIHost(t *testing.T) {
 		}
 	}
 }
+
+// expiringTokenTestServer rejects requests with a status code 14 response
+// until a refresh has been performed, after which it accepts only the
+// refreshed access token.
+type expiringTokenTestServer struct {
+	t *testing.T
+
+	mu        sync.Mutex
+	refreshes int
+	bodies    []string
+}
+
+func (s *expiringTokenTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.URL.Path == tokenURL {
+		s.refreshes++
+		w.Header().Set("Content-Type", requestContentType)
+		fmt.Fprintf(w, `{"access_token":"refreshed%v","token_type":"Bearer","expires_in":3600,"refresh_token":"refresh%v","scope":"smartWrite"}`, s.refreshes, s.refreshes)
+		return
+	}
+	b, _ := ioutil.ReadAll(r.Body)
+	s.bodies = append(s.bodies, string(b))
+	if got := r.Header["Authorization"]; len(got) != 1 {
+		s.t.Errorf("got %v Authorization headers, want 1: %v", len(got), got)
+	}
+	if s.refreshes == 0 || r.Header.Get("Authorization") != fmt.Sprintf("Bearer refreshed%v", s.refreshes) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"status":{"code":14,"message":"Authentication token has expired. Refresh your tokens."}}`))
+		return
+	}
+	w.Write([]byte(`{"status":{"code":0,"message":""}}`))
+}
+
+func TestAuthorizingTransportRetriesExpiredToken(t *testing.T) {
+	ets := &expiringTokenTestServer{t: t}
+	s := httptest.NewServer(ets)
+	defer s.Close()
+
+	ts := NewMemoryTokenStore(&TokenRefreshResponse{
+		AccessToken:  "revokedtoken",
+		RefreshToken: "refresh0",
+		ExpiresIn:    TokenDuration{Duration: time.Hour},
+	})
+	client := &http.Client{
+		Transport: &authorizingTransport{
+			auth:      ts,
+			transport: http.DefaultTransport,
+			api:       apiBaseURL(s.URL),
+		},
+	}
+	res, err := client.Post(s.URL+thermostatURL, requestContentType, strings.NewReader("the body"))
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("got status %v, want %v", res.StatusCode, http.StatusOK)
+	}
+	if ets.refreshes != 1 {
+		t.Errorf("got %v refreshes, want 1", ets.refreshes)
+	}
+	if want := []string{"the body", "the body"}; !reflect.DeepEqual(ets.bodies, want) {
+		t.Errorf("body not replayed; got: %q, want: %q", ets.bodies, want)
+	}
+	if got := ts.AccessToken(); got != "refreshed1" {
+		t.Errorf("store not updated; got access token %q, want %q", got, "refreshed1")
+	}
+}
+
+func TestAuthorizingTransportRetriesOnlyOnce(t *testing.T) {
+	var requests int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == tokenURL {
+			w.Write([]byte(`{"access_token":"stillbad","expires_in":3600,"refresh_token":"refresh"}`))
+			return
+		}
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"status":{"code":14,"message":"Authentication token has expired. Refresh your tokens."}}`))
+	}))
+	defer s.Close()
+
+	client := &Client{
+		api: apiBaseURL(s.URL),
+		Client: http.Client{
+			Transport: &authorizingTransport{
+				auth: NewMemoryTokenStore(&TokenRefreshResponse{
+					AccessToken: "revokedtoken",
+					ExpiresIn:   TokenDuration{Duration: time.Hour},
+				}),
+				transport: http.DefaultTransport,
+				api:       apiBaseURL(s.URL),
+			},
+		},
+	}
+	_, err := client.Thermostats(&Selection{})
+	if !IsTokenExpired(err) {
+		t.Errorf("got error %v, want expired token APIError", err)
+	}
+	if requests != 2 {
+		t.Errorf("got %v requests, want 2", requests)
+	}
+}
+
+func TestIsTokenExpiredResponsePreservesBody(t *testing.T) {
+	body := `{"status":{"code":3,"message":"Processing error."}}`
+	res := &http.Response{
+		StatusCode: http.StatusInternalServerError,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+	expired, err := isTokenExpiredResponse(res)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if expired {
+		t.Error("got expired for processing error status")
+	}
+	if b, _ := ioutil.ReadAll(res.Body); string(b) != body {
+		t.Errorf("body not preserved; got: %q, want: %q", b, body)
+	}
+}
+
+type recordingTransport struct {
+	mu       sync.Mutex
+	requests []string
+	next     http.RoundTripper
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.requests = append(t.requests, req.URL.Path)
+	t.mu.Unlock()
+	return t.next.RoundTrip(req)
+}
+
+func TestAuthorizingTransportReauthUsesTransportAndContext(t *testing.T) {
+	unblock := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-unblock:
+		}
+	}))
+	defer s.Close()
+	defer close(unblock)
+
+	rt := &recordingTransport{next: http.DefaultTransport}
+	client := &http.Client{
+		Transport: &authorizingTransport{
+			auth:      &fakeTokenStorer{"", "refresh", 0},
+			transport: rt,
+			api:       apiBaseURL(s.URL),
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, s.URL+thermostatURL, nil)
+	_, err := client.Do(req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if want := []string{tokenURL}; !reflect.DeepEqual(rt.requests, want) {
+		t.Errorf("got requests %v, want %v", rt.requests, want)
+	}
+}
+
+// rotatingTokenTestServer behaves like the ecobee API with respect to refresh
+// tokens: each refresh token may be used only once.
+type rotatingTokenTestServer struct {
+	mu           sync.Mutex
+	refreshes    int
+	refreshToken string
+	accessToken  string
+}
+
+func (s *rotatingTokenTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == tokenURL {
+		// Widen the window in which concurrent refreshes could collide.
+		time.Sleep(10 * time.Millisecond)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.refreshes++
+		if r.URL.Query().Get("refresh_token") != s.refreshToken {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant","error_description":"The refresh token is invalid."}`))
+			return
+		}
+		s.accessToken = fmt.Sprintf("access%v", s.refreshes)
+		s.refreshToken = fmt.Sprintf("refresh%v", s.refreshes)
+		fmt.Fprintf(w, `{"access_token":%q,"token_type":"Bearer","expires_in":3600,"refresh_token":%q}`, s.accessToken, s.refreshToken)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer "+s.accessToken {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"status":{"code":14,"message":"Authentication token has expired. Refresh your tokens."}}`))
+		return
+	}
+	w.Write([]byte(`{"status":{"code":0,"message":""}}`))
+}
+
+func TestAuthorizingTransportConcurrentRefresh(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		ts   TokenStorer
+	}{
+		{
+			name: "store reports expiry",
+			ts: NewMemoryTokenStore(&TokenRefreshResponse{
+				AccessToken:  "access0",
+				RefreshToken: "refresh0",
+			}),
+		},
+		{
+			name: "API reports expiry",
+			ts: NewMemoryTokenStore(&TokenRefreshResponse{
+				AccessToken:  "revoked",
+				RefreshToken: "refresh0",
+				ExpiresIn:    TokenDuration{Duration: time.Hour},
+			}),
+		},
+	} {
+		rts := &rotatingTokenTestServer{accessToken: "access0", refreshToken: "refresh0"}
+		s := httptest.NewServer(rts)
+		client := &http.Client{
+			Transport: &authorizingTransport{
+				auth:      tt.ts,
+				transport: http.DefaultTransport,
+				api:       apiBaseURL(s.URL),
+			},
+		}
+
+		const workers = 50
+		var wg sync.WaitGroup
+		errs := make(chan error, workers)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				res, err := client.Get(s.URL + thermostatURL)
+				if err != nil {
+					errs <- err
+					return
+				}
+				defer res.Body.Close()
+				if res.StatusCode != http.StatusOK {
+					errs <- fmt.Errorf("got status %v", res.Status)
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Errorf("%v: got unexpected error: %v", tt.name, err)
+		}
+		if rts.refreshes != 1 {
+			t.Errorf("%v: got %v refreshes, want 1", tt.name, rts.refreshes)
+		}
+		if got := tt.ts.RefreshToken(); got != "refresh1" {
+			t.Errorf("%v: got refresh token %q, want %q", tt.name, got, "refresh1")
+		}
+		s.Close()
+	}
+}
+
+func TestAuthorizingTransportRefreshSurvivesCancelledInitiator(t *testing.T) {
+	rts := &rotatingTokenTestServer{accessToken: "access0", refreshToken: "refresh0"}
+	s := httptest.NewServer(rts)
+	defer s.Close()
+	client := &http.Client{
+		Transport: &authorizingTransport{
+			auth: NewMemoryTokenStore(&TokenRefreshResponse{
+				AccessToken:  "access0",
+				RefreshToken: "refresh0",
+			}),
+			transport: http.DefaultTransport,
+			api:       apiBaseURL(s.URL),
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, s.URL+thermostatURL, nil)
+	if _, err := client.Do(req); err == nil {
+		t.Error("expected error from cancelled request, got nil")
+	}
+	res, err := client.Get(s.URL + thermostatURL)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("got status %v, want %v", res.StatusCode, http.StatusOK)
+	}
+}
+
+func TestAuthorizingTransport_ShouldReauthWithLeadTime(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		leadTime time.Duration
+		vf       time.Duration
+		want     bool
+	}{
+		{"default lead time, valid", 0, time.Minute, false},
+		{"default lead time, expiring", 0, 20 * time.Second, true},
+		{"long lead time, expiring", 10 * time.Minute, 5 * time.Minute, true},
+		{"short lead time, valid", time.Second, 5 * time.Second, false},
+	} {
+		testTransport := &authorizingTransport{
+			auth:     &fakeTokenStorer{"foo", "bar", tt.vf},
+			leadTime: tt.leadTime,
+		}
+		if got := testTransport.shouldReauth(); got != tt.want {
+			t.Errorf("%v: got %v, wanted %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOptions_RefreshLeadTime(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opt  *Options
+		want time.Duration
+	}{
+		{"nil opts", nil, defaultRefreshLeadTime},
+		{"empty RefreshLeadTime", &Options{}, defaultRefreshLeadTime},
+		{"set RefreshLeadTime", &Options{RefreshLeadTime: time.Minute}, time.Minute},
+	} {
+		if got := tt.opt.refreshLeadTime(); got != tt.want {
+			t.Errorf("%v: refreshLeadTime returned incorrect value; got: %v, want: %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOptions_Transport(t *testing.T) {
+	custom := &recordingTransport{}
+	for _, tt := range []struct {
+		name string
+		opt  *Options
+		want http.RoundTripper
+	}{
+		{"nil opts", nil, http.DefaultTransport},
+		{"empty Transport", &Options{}, http.DefaultTransport},
+		{"set Transport", &Options{Transport: custom}, custom},
+		{"set UserAgent", &Options{UserAgent: "test/1.0"}, &userAgentTransport{"test/1.0", http.DefaultTransport}},
+		{"set Transport and UserAgent", &Options{Transport: custom, UserAgent: "test/1.0"}, &userAgentTransport{"test/1.0", custom}},
+	} {
+		if got := tt.opt.transport(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: transport returned incorrect value; got: %#v, want: %#v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewWithOptions(t *testing.T) {
+	var userAgents []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents = append(userAgents, r.Header.Get("User-Agent"))
+		if r.URL.Path == tokenURL {
+			w.Write([]byte(`{"access_token":"access1","expires_in":3600,"refresh_token":"refresh1"}`))
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer access1" {
+			t.Errorf(`invalid Authorization header; got: %q, want: "Bearer access1"`, got)
+		}
+		w.Write([]byte(`{"revisionList":[],"status":{"code":0}}`))
+	}))
+	defer s.Close()
+
+	rt := &recordingTransport{next: http.DefaultTransport}
+	// The token is valid for another 10 minutes, which is inside the lead time.
+	ts := NewMemoryTokenStore(&TokenRefreshResponse{
+		AccessToken:  "access0",
+		RefreshToken: "refresh0",
+		ExpiresIn:    TokenDuration{Duration: 10 * time.Minute},
+	})
+	c := New("appid", ts, &Options{
+		APIHost:         s.URL,
+		RefreshLeadTime: 15 * time.Minute,
+		Transport:       rt,
+		Timeout:         time.Minute,
+		UserAgent:       "egobee-test/1.0",
+	})
+	if c.Timeout != time.Minute {
+		t.Errorf("got Timeout %v, want %v", c.Timeout, time.Minute)
+	}
+	if _, err := c.ThermostatSummary(); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if want := []string{tokenURL, thermostatSummaryURL}; !reflect.DeepEqual(rt.requests, want) {
+		t.Errorf("got requests %v, want %v", rt.requests, want)
+	}
+	if want := []string{"egobee-test/1.0", "egobee-test/1.0"}; !reflect.DeepEqual(userAgents, want) {
+		t.Errorf("got User-Agents %v, want %v", userAgents, want)
+	}
+}
+
+func TestClientsSharingPersistentStore(t *testing.T) {
+	rts := &rotatingTokenTestServer{accessToken: "access0", refreshToken: "refresh0"}
+	s := httptest.NewServer(rts)
+	defer s.Close()
+	dir, err := ioutil.TempDir("", "egobee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "store")
+	if _, err := NewPersistentTokenStore(&TokenRefreshResponse{AccessToken: "access0", RefreshToken: "refresh0"}, path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Clients with their own stores stand in for separate processes.
+	var clients []*Client
+	for i := 0; i < 4; i++ {
+		ts, err := NewPersistentTokenFromDisk(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clients = append(clients, New("app", ts, &Options{APIHost: s.URL}))
+	}
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			if _, err := c.ThermostatSummary(); err != nil {
+				t.Errorf("got unexpected error: %v", err)
+			}
+		}(c)
+	}
+	wg.Wait()
+	if rts.refreshes != 1 {
+		t.Errorf("got %v refresh attempts, want 1", rts.refreshes)
+	}
+}
+
+func TestOptionsTokenHooks(t *testing.T) {
+	rts := &rotatingTokenTestServer{accessToken: "access0", refreshToken: "refresh0"}
+	s := httptest.NewServer(rts)
+	defer s.Close()
+
+	var mu sync.Mutex
+	var refreshed []string
+	var failures []error
+	opts := &Options{
+		APIHost: s.URL,
+		OnTokenRefreshed: func(r *TokenRefreshResponse) {
+			mu.Lock()
+			defer mu.Unlock()
+			refreshed = append(refreshed, r.RefreshToken)
+		},
+		OnRefreshFailed: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failures = append(failures, err)
+		},
+	}
+	ts := NewMemoryTokenStore(&TokenRefreshResponse{AccessToken: "access0", RefreshToken: "refresh0"})
+	if _, err := New("app", ts, opts).ThermostatSummary(); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if want := []string{"refresh1"}; !reflect.DeepEqual(refreshed, want) || len(failures) != 0 {
+		t.Errorf("got refreshes %v and failures %v, want %v and none", refreshed, failures, want)
+	}
+
+	// Another client's refresh token has since been rotated by the first.
+	refreshed = nil
+	ts = NewMemoryTokenStore(&TokenRefreshResponse{AccessToken: "access0", RefreshToken: "refresh0"})
+	_, err := New("app", ts, opts).ThermostatSummary()
+	if !IsAuthorizationError(err, AuthorizationErrorInvalidGrant) {
+		t.Errorf("got error %v, want invalid_grant", err)
+	}
+	if len(refreshed) != 0 || len(failures) != 1 || !IsAuthorizationError(failures[0], AuthorizationErrorInvalidGrant) {
+		t.Errorf("got refreshes %v and failures %v, want none and invalid_grant", refreshed, failures)
+	}
+}
+
+func TestOptionsNeedsReauthorization(t *testing.T) {
+	rts := &rotatingTokenTestServer{accessToken: "access0", refreshToken: "refresh0"}
+	s := httptest.NewServer(rts)
+	defer s.Close()
+
+	var mu sync.Mutex
+	var reauths int
+	var refreshed []string
+	var failures []error
+	var reauthErr error
+	opts := &Options{
+		APIHost: s.URL,
+		OnTokenRefreshed: func(r *TokenRefreshResponse) {
+			mu.Lock()
+			defer mu.Unlock()
+			refreshed = append(refreshed, r.RefreshToken)
+		},
+		OnRefreshFailed: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failures = append(failures, err)
+		},
+		// Stands in for the user authorizing the application again.
+		NeedsReauthorization: func(ctx context.Context) (*TokenRefreshResponse, error) {
+			if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) <= refreshTimeout {
+				t.Errorf("got hook deadline %v, %v, want one later than refreshTimeout", deadline, ok)
+			}
+			mu.Lock()
+			reauths++
+			err := reauthErr
+			mu.Unlock()
+			if err != nil {
+				return nil, err
+			}
+			rts.mu.Lock()
+			defer rts.mu.Unlock()
+			rts.accessToken, rts.refreshToken = "accessR", "refreshR"
+			return &TokenRefreshResponse{
+				AccessToken:  rts.accessToken,
+				RefreshToken: rts.refreshToken,
+				ExpiresIn:    TokenDuration{Duration: time.Hour},
+			}, nil
+		},
+	}
+
+	ts := NewMemoryTokenStore(&TokenRefreshResponse{AccessToken: "dead", RefreshToken: "dead"})
+	client := New("app", ts, opts)
+	const workers = 10
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.ThermostatSummary(); err != nil {
+				t.Errorf("got unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if reauths != 1 {
+		t.Errorf("got %v reauthorizations, want 1", reauths)
+	}
+	if want := []string{"refreshR"}; !reflect.DeepEqual(refreshed, want) || len(failures) != 0 {
+		t.Errorf("got refreshes %v and failures %v, want %v and none", refreshed, failures, want)
+	}
+	if got := ts.RefreshToken(); got != "refreshR" {
+		t.Errorf("got refresh token %q, want refreshR", got)
+	}
+
+	// When reauthorization fails, so does the refresh.
+	reauthErr = errors.New("user declined")
+	ts = NewMemoryTokenStore(&TokenRefreshResponse{AccessToken: "dead", RefreshToken: "dead"})
+	_, err := New("app", ts, opts).ThermostatSummary()
+	if !IsAuthorizationError(err, AuthorizationErrorInvalidGrant) || !strings.Contains(err.Error(), "user declined") {
+		t.Errorf("got error %v, want invalid_grant and the reauthorization error", err)
+	}
+	if reauths != 2 || len(failures) != 1 || !strings.HasSuffix(err.Error(), failures[0].Error()) {
+		t.Errorf("got %v reauthorizations and failures %v, want 2 and the request's error", reauths, failures)
+	}
+}
@@ -0,0 +1,391 @@
+// Package egobeetest provides an in-memory fake of the ecobee API, for testing
+// code which uses egobee without network access or a real thermostat.
+//
+//	s := egobeetest.NewServer(&egobee.Thermostat{Identifier: "123", Name: "Home"})
+//	defer s.Close()
+//	client := s.Client()
+//	thermostats, err := client.Thermostats(&egobee.Selection{
+//		SelectionType: egobee.SelectionTypeRegistered,
+//	})
+//
+// The fake implements token issue, refresh and expiry, PIN and authorization
+// code authorization, the thermostat summary, thermostat retrieval with
+// selection filtering and paging, and the common thermostat functions and
+// property updates, which modify its state. Runtime reports are not
+// implemented.
+package egobeetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cfunkhouser/egobee"
+)
+
+// Defaults for Server configuration.
+const (
+	DefaultAppID          = "egobeetest"
+	DefaultAccessTokenTTL = time.Hour
+	DefaultPageSize       = 25
+	DefaultPinInterval    = 30
+	DefaultPinExpiresIn   = 9
+)
+
+// Failure is returned in place of the normal response to a request. See
+// Server.FailNext.
+type Failure struct {
+	// Path of the request to fail, such as "/1/thermostat". If empty, the next
+	// request to any path fails.
+	Path string
+	// HTTPStatusCode of the response. Defaults to 500.
+	HTTPStatusCode int
+	// Code is the ecobee status code included in the response, one of the
+	// egobee.StatusCode constants.
+	Code int
+	// Message accompanying Code.
+	Message string
+	// AuthError, if set, is returned as an OAuth error instead of a status. It
+	// is appropriate for failures of the token and authorize endpoints.
+	AuthError egobee.AuthorizationError
+}
+
+// pin is an outstanding PIN authorization.
+type pin struct {
+	pin        string
+	scope      egobee.Scope
+	expires    time.Time
+	authorized bool
+}
+
+// Server is a fake ecobee API. Its exported fields may be changed before it
+// handles any requests.
+type Server struct {
+	// URL of the server, for use as egobee.Options.APIHost.
+	URL string
+
+	// AppID which clients must use. Defaults to DefaultAppID.
+	AppID string
+	// AccessTokenTTL is how long issued access tokens are valid. Defaults to
+	// DefaultAccessTokenTTL.
+	AccessTokenTTL time.Duration
+	// PageSize is the maximum number of thermostats in each page of a response.
+	// Defaults to DefaultPageSize.
+	PageSize int
+	// PinInterval is the number of seconds clients are asked to wait between
+	// polls for PIN authorization. Defaults to DefaultPinInterval.
+	PinInterval int
+
+	srv *httptest.Server
+
+	mu            sync.Mutex // protects the following members
+	seq           int        // for generating tokens and revisions
+	accessTokens  map[string]time.Time
+	refreshTokens map[string]egobee.Scope
+	pins          map[string]*pin // by authorization code
+	codes         map[string]egobee.Scope
+	failures      []Failure
+	requests      map[string]int
+	thermostats   []*thermostat
+}
+
+// NewServer starts a Server with the given thermostats registered to its
+// user. The caller must Close it when done.
+func NewServer(thermostats ...*egobee.Thermostat) *Server {
+	s := &Server{
+		AppID:          DefaultAppID,
+		AccessTokenTTL: DefaultAccessTokenTTL,
+		PageSize:       DefaultPageSize,
+		PinInterval:    DefaultPinInterval,
+		accessTokens:   make(map[string]time.Time),
+		refreshTokens:  make(map[string]egobee.Scope),
+		pins:           make(map[string]*pin),
+		codes:          make(map[string]egobee.Scope),
+		requests:       make(map[string]int),
+	}
+	for _, t := range thermostats {
+		s.AddThermostat(t)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/authorize", s.handleAuthorize)
+	mux.HandleFunc("/token", s.handleToken)
+	mux.HandleFunc("/1/thermostatSummary", s.authenticated(s.handleThermostatSummary))
+	mux.HandleFunc("/1/thermostat", s.authenticated(s.handleThermostat))
+	s.srv = httptest.NewServer(s.failing(mux))
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Options for an egobee.Client which uses the server.
+func (s *Server) Options() *egobee.Options {
+	return &egobee.Options{APIHost: s.URL}
+}
+
+// Client returns an egobee.Client which uses the server, authorized with newly
+// issued tokens.
+func (s *Server) Client() *egobee.Client {
+	return egobee.New(s.AppID, egobee.NewMemoryTokenStore(s.Token(egobee.ScopeSmartWrite)), s.Options())
+}
+
+// Token issues new tokens with scope, as if the user had authorized the
+// application.
+func (s *Server) Token(scope egobee.Scope) *egobee.TokenRefreshResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.issueLocked(scope)
+}
+
+func (s *Server) issueLocked(scope egobee.Scope) *egobee.TokenRefreshResponse {
+	access, refresh := s.nextLocked("access"), s.nextLocked("refresh")
+	s.accessTokens[access] = time.Now().Add(s.AccessTokenTTL)
+	s.refreshTokens[refresh] = scope
+	return &egobee.TokenRefreshResponse{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    egobee.TokenDuration{Duration: s.AccessTokenTTL},
+		RefreshToken: refresh,
+		Scope:        scope,
+	}
+}
+
+// nextLocked returns a new unique value with prefix.
+func (s *Server) nextLocked(prefix string) string {
+	s.seq++
+	return fmt.Sprintf("%v-%d", prefix, s.seq)
+}
+
+// ExpireTokens immediately expires every access token issued so far. Refresh
+// tokens remain valid.
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for t := range s.accessTokens {
+		s.accessTokens[t] = time.Time{}
+	}
+}
+
+// RevokeTokens invalidates every access and refresh token issued so far, as if
+// the user had removed the application.
+func (s *Server) RevokeTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accessTokens = make(map[string]time.Time)
+	s.refreshTokens = make(map[string]egobee.Scope)
+}
+
+// AuthorizePin authorizes the application for the outstanding PIN p, as if the
+// user had entered it in the ecobee portal.
+func (s *Server) AuthorizePin(p string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, pending := range s.pins {
+		if pending.pin == p {
+			pending.authorized = true
+			return nil
+		}
+	}
+	return fmt.Errorf("no outstanding PIN %q", p)
+}
+
+// FailNext causes the next request matching f.Path to fail with f. Failures
+// are used in the order they were added.
+func (s *Server) FailNext(f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, f)
+}
+
+// Requests returns the number of requests made to path, including those which
+// failed.
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// failing wraps h, recording requests and responding with any pending Failure.
+func (s *Server) failing(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.URL.Path]++
+		var f *Failure
+		for i := range s.failures {
+			if p := s.failures[i].Path; p == "" || p == r.URL.Path {
+				failure := s.failures[i]
+				f = &failure
+				s.failures = append(s.failures[:i], s.failures[i+1:]...)
+				break
+			}
+		}
+		s.mu.Unlock()
+		if f == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		code := f.HTTPStatusCode
+		if code == 0 {
+			code = http.StatusInternalServerError
+		}
+		if f.AuthError != "" {
+			writeAuthError(w, code, f.AuthError, f.Message)
+			return
+		}
+		writeStatus(w, code, f.Code, f.Message)
+	})
+}
+
+// status is included in every API response.
+type status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeStatus(w http.ResponseWriter, httpStatusCode, code int, message string) {
+	writeJSON(w, httpStatusCode, struct {
+		Status status `json:"status"`
+	}{status{code, message}})
+}
+
+func writeAuthError(w http.ResponseWriter, httpStatusCode int, e egobee.AuthorizationError, description string) {
+	writeJSON(w, httpStatusCode, &egobee.AuthorizationErrorResponse{
+		Error:       e,
+		Description: description,
+	})
+}
+
+// authenticated wraps h, rejecting requests without a valid access token as
+// the ecobee API does.
+func (s *Server) authenticated(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		s.mu.Lock()
+		expires, ok := s.accessTokens[token]
+		s.mu.Unlock()
+		switch {
+		case !ok:
+			writeStatus(w, http.StatusInternalServerError, egobee.StatusCodeInvalidToken, "Invalid token. Token has been deauthorized by user. You must re-request authorization.")
+		case !time.Now().Before(expires):
+			writeStatus(w, http.StatusInternalServerError, egobee.StatusCodeAuthenticationExpired, "Authentication token has expired. Refresh your tokens.")
+		default:
+			h(w, r)
+		}
+	}
+}
+
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != s.AppID {
+		writeAuthError(w, http.StatusBadRequest, egobee.AuthorizationErrorInvalidClient, "unknown client_id")
+		return
+	}
+	scope := egobee.Scope(q.Get("scope"))
+	switch q.Get("response_type") {
+	case "ecobeePin":
+		s.mu.Lock()
+		p := &pin{
+			pin:     fmt.Sprintf("%04d", s.seq%10000),
+			scope:   scope,
+			expires: time.Now().Add(DefaultPinExpiresIn * time.Minute),
+		}
+		code := s.nextLocked("pin")
+		s.pins[code] = p
+		interval := s.PinInterval
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, &egobee.PinAuthenticationChallenge{
+			Pin:               p.pin,
+			AuthorizationCode: code,
+			Scope:             scope,
+			ExpiresIn:         DefaultPinExpiresIn,
+			Interval:          interval,
+		})
+	case "code":
+		// The user immediately approves the application.
+		redirect, err := url.Parse(q.Get("redirect_uri"))
+		if err != nil || redirect.Scheme == "" {
+			writeAuthError(w, http.StatusBadRequest, egobee.AuthorizationErrorInvalidRequest, "invalid redirect_uri")
+			return
+		}
+		s.mu.Lock()
+		code := s.nextLocked("code")
+		s.codes[code] = scope
+		s.mu.Unlock()
+		rq := redirect.Query()
+		rq.Set("code", code)
+		rq.Set("state", q.Get("state"))
+		redirect.RawQuery = rq.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+	default:
+		writeAuthError(w, http.StatusBadRequest, egobee.AuthorizationErrorInvalidRequest, "unsupported response_type")
+	}
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAuthError(w, http.StatusBadRequest, egobee.AuthorizationErrorInvalidRequest, "token requests must be POSTed")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeAuthError(w, http.StatusBadRequest, egobee.AuthorizationErrorInvalidRequest, err.Error())
+		return
+	}
+	if r.Form.Get("client_id") != s.AppID {
+		writeAuthError(w, http.StatusUnauthorized, egobee.AuthorizationErrorInvalidClient, "unknown client_id")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Form.Get("grant_type") {
+	case "refresh_token":
+		scope, ok := s.refreshTokens[r.Form.Get("refresh_token")]
+		if !ok {
+			writeAuthError(w, http.StatusBadRequest, egobee.AuthorizationErrorInvalidGrant, "invalid refresh token")
+			return
+		}
+		// Refresh tokens are rotated on every use.
+		delete(s.refreshTokens, r.Form.Get("refresh_token"))
+		writeJSON(w, http.StatusOK, s.issueLocked(scope))
+	case "ecobeePin":
+		code := r.Form.Get("code")
+		p, ok := s.pins[code]
+		switch {
+		case !ok:
+			writeAuthError(w, http.StatusBadRequest, egobee.AuthorizationErrorInvalidGrant, "unknown authorization code")
+		case !time.Now().Before(p.expires):
+			delete(s.pins, code)
+			writeAuthError(w, http.StatusBadRequest, egobee.AuthorizationErrorAuthorizationExpired, "the PIN has expired")
+		case !p.authorized:
+			writeAuthError(w, http.StatusUnauthorized, egobee.AuthorizationErrorAuthorizationPending, "waiting for the user to authorize the application")
+		default:
+			delete(s.pins, code)
+			writeJSON(w, http.StatusOK, s.issueLocked(p.scope))
+		}
+	case "authorization_code":
+		code := r.Form.Get("code")
+		scope, ok := s.codes[code]
+		if !ok {
+			writeAuthError(w, http.StatusBadRequest, egobee.AuthorizationErrorInvalidGrant, "unknown authorization code")
+			return
+		}
+		delete(s.codes, code)
+		writeJSON(w, http.StatusOK, s.issueLocked(scope))
+	default:
+		writeAuthError(w, http.StatusBadRequest, egobee.AuthorizationErrorUnsupportedGrantType, "unsupported grant_type")
+	}
+}
@@ -0,0 +1,139 @@
+package egobeetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/cfunkhouser/egobee"
+)
+
+// get makes an authenticated GET request for path with the selection request
+// sr, and decodes the response into v. It returns the response status code.
+func get(t *testing.T, s *Server, path string, sr interface{}, v interface{}) int {
+	t.Helper()
+	b, err := json.Marshal(sr)
+	if err != nil {
+		t.Fatalf("failed to marshal selection: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodGet, s.URL+path+"?json="+url.QueryEscape(string(b)), nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.Token(egobee.ScopeSmartRead).AccessToken)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer res.Body.Close()
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return res.StatusCode
+}
+
+func TestThermostatSummary(t *testing.T) {
+	s := NewServer(
+		&egobee.Thermostat{Identifier: "1", Name: "One", EquipmentStatus: "fan,compCool1"},
+		&egobee.Thermostat{Identifier: "2", Name: "Two"},
+	)
+	defer s.Close()
+
+	summary := &egobee.ThermostatSummary{}
+	get(t, s, "/1/thermostatSummary", &selectionRequest{Selection: egobee.Selection{
+		SelectionType:          egobee.SelectionTypeRegistered,
+		IncludeEquipmentStatus: true,
+	}}, summary)
+	if summary.ThermostatCount != 2 || len(summary.RevisionList) != 2 {
+		t.Fatalf("got unexpected summary %+v", summary)
+	}
+	statuses, err := summary.EquipmentStatuses()
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if !statuses[0].IsRunning(egobee.EquipmentCompCool1) || len(statuses[1].Running) != 0 {
+		t.Errorf("got unexpected equipment status %+v", statuses)
+	}
+
+	before, err := summary.Revisions()
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if err := s.UpdateThermostat("2", func(th *egobee.Thermostat) {
+		th.Runtime.ActualTemperature = 715
+	}); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	get(t, s, "/1/thermostatSummary", &selectionRequest{Selection: egobee.Selection{
+		SelectionType: egobee.SelectionTypeRegistered,
+	}}, summary)
+	after, err := summary.Revisions()
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if *after[0] != *before[0] {
+		t.Errorf("revisions of unchanged thermostat changed; before: %+v, after: %+v", before[0], after[0])
+	}
+	if after[1].RuntimeRev == before[1].RuntimeRev || after[1].ThermostatRev != before[1].ThermostatRev {
+		t.Errorf("only the runtime revision should have changed; before: %+v, after: %+v", before[1], after[1])
+	}
+
+	if err := s.UpdateThermostat("3", func(*egobee.Thermostat) {}); err == nil {
+		t.Error("expected error updating unknown thermostat, got nil")
+	}
+}
+
+func TestThermostatsInclude(t *testing.T) {
+	s := NewServer(&egobee.Thermostat{
+		Identifier: "1",
+		Runtime:    egobee.Runtime{ActualTemperature: 700},
+		Settings:   egobee.Settings{HVACMode: "cool"},
+		Alerts:     []egobee.Alert{{AcknowledgeRef: "a"}},
+	})
+	defer s.Close()
+
+	res := &thermostatsResponse{}
+	get(t, s, "/1/thermostat", &selectionRequest{Selection: egobee.Selection{
+		SelectionType:   egobee.SelectionTypeThermostats,
+		SelectionMatch:  "1",
+		IncludeSettings: true,
+	}}, res)
+	if len(res.ThermostatList) != 1 {
+		t.Fatalf("got %v thermostats, want 1", len(res.ThermostatList))
+	}
+	got := res.ThermostatList[0]
+	if got.Settings.HVACMode != "cool" {
+		t.Errorf("settings not included: %+v", got.Settings)
+	}
+	if got.Runtime.ActualTemperature != 0 || got.Alerts != nil {
+		t.Errorf("got runtime %+v and alerts %+v which were not selected", got.Runtime, got.Alerts)
+	}
+	if !got.IsRegistered {
+		t.Error("thermostat not registered")
+	}
+}
+
+func TestInvalidRequests(t *testing.T) {
+	s := NewServer(&egobee.Thermostat{Identifier: "1"})
+	defer s.Close()
+
+	var res struct {
+		Status status `json:"status"`
+	}
+	if code := get(t, s, "/1/thermostat", &selectionRequest{Selection: egobee.Selection{
+		SelectionType: egobee.SelectionTypeManagementSet,
+	}}, &res); code != http.StatusBadRequest || res.Status.Code != egobee.StatusCodeInvalidSelection {
+		t.Errorf("got %v %+v for unsupported selection", code, res.Status)
+	}
+
+	sr := &selectionRequest{Selection: egobee.Selection{SelectionType: egobee.SelectionTypeRegistered}}
+	sr.Page.Page = 2
+	if code := get(t, s, "/1/thermostat", sr, &res); code != http.StatusBadRequest || res.Status.Code != egobee.StatusCodeInvalidPage {
+		t.Errorf("got %v %+v for page out of range", code, res.Status)
+	}
+
+	if err := s.AuthorizePin("0000"); err == nil {
+		t.Error("expected error authorizing unknown PIN, got nil")
+	}
+}
@@ -0,0 +1,489 @@
+package egobeetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/cfunkhouser/egobee"
+)
+
+// thermostat is the server's state for one thermostat.
+type thermostat struct {
+	t           *egobee.Thermostat
+	alertsRev   string
+	intervalRev string
+}
+
+// copyThermostat returns a deep copy of t.
+func copyThermostat(t *egobee.Thermostat) *egobee.Thermostat {
+	b, err := json.Marshal(t)
+	if err != nil {
+		panic(fmt.Sprintf("egobeetest: failed to copy thermostat: %v", err))
+	}
+	c := &egobee.Thermostat{}
+	if err := json.Unmarshal(b, c); err != nil {
+		panic(fmt.Sprintf("egobeetest: failed to copy thermostat: %v", err))
+	}
+	return c
+}
+
+// AddThermostat registers a copy of t to the server's user. Unset revisions are
+// initialized.
+func (s *Server) AddThermostat(t *egobee.Thermostat) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	th := &thermostat{t: copyThermostat(t)}
+	th.t.IsRegistered = true
+	if th.t.ThermostatRev == "" {
+		th.t.ThermostatRev = s.revisionLocked()
+	}
+	if th.t.Runtime.RuntimeRev == "" {
+		th.t.Runtime.RuntimeRev = s.revisionLocked()
+	}
+	th.alertsRev = s.revisionLocked()
+	th.intervalRev = s.revisionLocked()
+	s.thermostats = append(s.thermostats, th)
+}
+
+// revisionLocked returns a new revision, which sorts after every previous one.
+func (s *Server) revisionLocked() string {
+	s.seq++
+	return fmt.Sprintf("%012d", s.seq)
+}
+
+func (s *Server) thermostatLocked(id string) *thermostat {
+	for _, th := range s.thermostats {
+		if th.t.Identifier == id {
+			return th
+		}
+	}
+	return nil
+}
+
+// Thermostat returns a copy of the current state of the thermostat identified
+// by id, or nil if there is none.
+func (s *Server) Thermostat(id string) *egobee.Thermostat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	th := s.thermostatLocked(id)
+	if th == nil {
+		return nil
+	}
+	return copyThermostat(th.t)
+}
+
+// UpdateThermostat calls update with the thermostat identified by id, as if the
+// thermostat had changed. The revisions of the parts of the thermostat which
+// update modifies are advanced.
+func (s *Server) UpdateThermostat(id string, update func(*egobee.Thermostat)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	th := s.thermostatLocked(id)
+	if th == nil {
+		return fmt.Errorf("no thermostat %q", id)
+	}
+	before := copyThermostat(th.t)
+	update(th.t)
+	s.advanceLocked(th, before)
+	return nil
+}
+
+// advanceLocked advances the revisions of the parts of th which differ from
+// before.
+func (s *Server) advanceLocked(th *thermostat, before *egobee.Thermostat) {
+	after := copyThermostat(th.t)
+	if !reflect.DeepEqual(before.Alerts, after.Alerts) {
+		th.alertsRev = s.revisionLocked()
+	}
+	before.Alerts, after.Alerts = nil, nil
+	if !reflect.DeepEqual(before.Runtime, after.Runtime) || !reflect.DeepEqual(before.ExtendedRuntime, after.ExtendedRuntime) || before.EquipmentStatus != after.EquipmentStatus {
+		th.t.Runtime.RuntimeRev = s.revisionLocked()
+		th.intervalRev = s.revisionLocked()
+	}
+	before.Runtime, after.Runtime = egobee.Runtime{}, egobee.Runtime{}
+	before.ExtendedRuntime, after.ExtendedRuntime = egobee.ExtendedRuntime{}, egobee.ExtendedRuntime{}
+	before.EquipmentStatus, after.EquipmentStatus = "", ""
+	if !reflect.DeepEqual(before, after) {
+		th.t.ThermostatRev = s.revisionLocked()
+	}
+}
+
+// selectionRequest is the json query parameter of GET requests.
+type selectionRequest struct {
+	Selection egobee.Selection `json:"selection"`
+	Page      struct {
+		Page int `json:"page"`
+	} `json:"page"`
+}
+
+// selectLocked returns the thermostats matching sel, or a status code if sel is
+// not valid.
+func (s *Server) selectLocked(sel *egobee.Selection) ([]*thermostat, int) {
+	switch sel.SelectionType {
+	case egobee.SelectionTypeRegistered:
+		return s.thermostats, egobee.StatusCodeSuccess
+	case egobee.SelectionTypeThermostats:
+		var selected []*thermostat
+		for _, id := range strings.Split(sel.SelectionMatch, ",") {
+			if th := s.thermostatLocked(strings.TrimSpace(id)); th != nil {
+				selected = append(selected, th)
+			}
+		}
+		return selected, egobee.StatusCodeSuccess
+	}
+	return nil, egobee.StatusCodeInvalidSelection
+}
+
+// parseSelection decodes the selection from a GET request, writing an error
+// response if it is invalid.
+func parseSelection(w http.ResponseWriter, r *http.Request) (*selectionRequest, bool) {
+	sr := &selectionRequest{}
+	if err := json.Unmarshal([]byte(r.URL.Query().Get("json")), sr); err != nil {
+		writeStatus(w, http.StatusBadRequest, egobee.StatusCodeSerializationError, fmt.Sprintf("Serialization error: %v", err))
+		return nil, false
+	}
+	return sr, true
+}
+
+func (s *Server) handleThermostatSummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeStatus(w, http.StatusBadRequest, egobee.StatusCodePostNotSupported, "Post not supported for request.")
+		return
+	}
+	sr, ok := parseSelection(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	selected, code := s.selectLocked(&sr.Selection)
+	if code != egobee.StatusCodeSuccess {
+		writeStatus(w, http.StatusBadRequest, code, "Invalid selection.")
+		return
+	}
+	summary := &egobee.ThermostatSummary{ThermostatCount: len(selected)}
+	for _, th := range selected {
+		summary.RevisionList = append(summary.RevisionList, strings.Join([]string{
+			th.t.Identifier,
+			th.t.Name,
+			fmt.Sprint(th.t.Runtime.Connected),
+			th.t.ThermostatRev,
+			th.alertsRev,
+			th.t.Runtime.RuntimeRev,
+			th.intervalRev,
+		}, ":"))
+		if sr.Selection.IncludeEquipmentStatus {
+			summary.StatusList = append(summary.StatusList, th.t.Identifier+":"+th.t.EquipmentStatus)
+		}
+	}
+	writeJSON(w, http.StatusOK, summary)
+}
+
+func (s *Server) handleThermostat(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.getThermostats(w, r)
+	case http.MethodPost:
+		s.updateThermostats(w, r)
+	default:
+		writeStatus(w, http.StatusMethodNotAllowed, egobee.StatusCodeInvalidRequestFormat, "Invalid request format.")
+	}
+}
+
+// included returns a copy of t with only the parts included by sel.
+func included(t *egobee.Thermostat, sel *egobee.Selection) *egobee.Thermostat {
+	c := copyThermostat(t)
+	for _, part := range []struct {
+		include bool
+		clear   func()
+	}{
+		{sel.IncludeRuntime, func() { c.Runtime = egobee.Runtime{} }},
+		{sel.IncludeExtendedRuntime, func() { c.ExtendedRuntime = egobee.ExtendedRuntime{} }},
+		{sel.IncludeElectricity, func() { c.Electricity = egobee.Electricity{} }},
+		{sel.IncludeSettings, func() { c.Settings = egobee.Settings{} }},
+		{sel.IncludeLocation, func() { c.Location = egobee.Location{} }},
+		{sel.IncludeProgram, func() { c.Program = egobee.Program{} }},
+		{sel.IncludeEvents, func() { c.Events = nil }},
+		{sel.IncludeDevice, func() { c.Devices = nil }},
+		{sel.IncludeTechnician, func() { c.Technician = egobee.Technician{} }},
+		{sel.IncludeUtility, func() { c.Utility = egobee.Utility{} }},
+		{sel.IncludeManagement, func() { c.Management = egobee.Management{} }},
+		{sel.IncludeAlerts, func() { c.Alerts = nil }},
+		{sel.IncludeReminders, func() { c.Reminders = nil }},
+		{sel.IncludeWeather, func() { c.Weather = egobee.Weather{} }},
+		{sel.IncludeHouseDetails, func() { c.HouseDetails = egobee.HouseDetails{} }},
+		{sel.IncludeEquipmentStatus, func() { c.EquipmentStatus = "" }},
+		{sel.IncludeNotificationSettings, func() { c.NotifictionSettings = egobee.NotificationSettings{} }},
+		{sel.IncludeVersion, func() { c.Version = egobee.Version{} }},
+		{sel.IncludeSecuritySettings, func() { c.SecuritySettings = egobee.SecuritySettings{} }},
+		{sel.IncludeSensors, func() { c.RemoteSensors = nil }},
+		{sel.IncludeAudio, func() { c.Audio = egobee.Audio{} }},
+		{sel.IncludeEnergy, func() { c.Energy = egobee.Energy{} }},
+	} {
+		if !part.include {
+			part.clear()
+		}
+	}
+	return c
+}
+
+// thermostatsResponse is the response to a GET request for thermostats.
+type thermostatsResponse struct {
+	Page struct {
+		Page       int `json:"page"`
+		TotalPages int `json:"totalPages"`
+		PageSize   int `json:"pageSize"`
+		Total      int `json:"total"`
+	} `json:"page"`
+	ThermostatList []*egobee.Thermostat `json:"thermostatList"`
+	Status         status               `json:"status"`
+}
+
+func (s *Server) getThermostats(w http.ResponseWriter, r *http.Request) {
+	sr, ok := parseSelection(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	selected, code := s.selectLocked(&sr.Selection)
+	if code != egobee.StatusCodeSuccess {
+		writeStatus(w, http.StatusBadRequest, code, "Invalid selection.")
+		return
+	}
+
+	res := &thermostatsResponse{}
+	res.Page.Page = sr.Page.Page
+	if res.Page.Page == 0 {
+		res.Page.Page = 1
+	}
+	res.Page.PageSize = s.PageSize
+	res.Page.Total = len(selected)
+	res.Page.TotalPages = (len(selected) + s.PageSize - 1) / s.PageSize
+	if res.Page.TotalPages == 0 {
+		res.Page.TotalPages = 1
+	}
+	if res.Page.Page > res.Page.TotalPages {
+		writeStatus(w, http.StatusBadRequest, egobee.StatusCodeInvalidPage, "Invalid page.")
+		return
+	}
+	start := (res.Page.Page - 1) * s.PageSize
+	for i := start; i < len(selected) && i < start+s.PageSize; i++ {
+		res.ThermostatList = append(res.ThermostatList, included(selected[i].t, &sr.Selection))
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// updateRequest is the body of a POST request to the thermostat endpoint.
+type updateRequest struct {
+	Selection egobee.Selection `json:"selection"`
+	Functions []struct {
+		Type   string          `json:"type"`
+		Params json.RawMessage `json:"params"`
+	} `json:"functions"`
+	Thermostat json.RawMessage `json:"thermostat"`
+}
+
+func (s *Server) updateThermostats(w http.ResponseWriter, r *http.Request) {
+	ur := &updateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(ur); err != nil {
+		writeStatus(w, http.StatusBadRequest, egobee.StatusCodeSerializationError, fmt.Sprintf("Serialization error: %v", err))
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	selected, code := s.selectLocked(&ur.Selection)
+	if code != egobee.StatusCodeSuccess {
+		writeStatus(w, http.StatusBadRequest, code, "Invalid selection.")
+		return
+	}
+
+	// Apply every change to copies, so that a failure leaves the state as it
+	// was.
+	updated := make([]*egobee.Thermostat, len(selected))
+	for i, th := range selected {
+		t := copyThermostat(th.t)
+		if len(ur.Thermostat) > 0 {
+			if err := json.Unmarshal(ur.Thermostat, t); err != nil {
+				writeStatus(w, http.StatusBadRequest, egobee.StatusCodeValidationError, fmt.Sprintf("Validation error: %v", err))
+				return
+			}
+		}
+		for _, f := range ur.Functions {
+			fn, ok := functions[f.Type]
+			if !ok {
+				writeStatus(w, http.StatusBadRequest, egobee.StatusCodeInvalidFunction, "Invalid function.")
+				return
+			}
+			if err := fn(t, f.Params); err != nil {
+				writeStatus(w, http.StatusInternalServerError, egobee.StatusCodeFunctionError, fmt.Sprintf("Function error: %v", err))
+				return
+			}
+		}
+		updated[i] = t
+	}
+	for i, th := range selected {
+		before := th.t
+		th.t = updated[i]
+		s.advanceLocked(th, before)
+	}
+	writeStatus(w, http.StatusOK, egobee.StatusCodeSuccess, "")
+}
+
+// functions implemented by the server, which modify a thermostat according to
+// their params.
+var functions = map[string]func(t *egobee.Thermostat, params json.RawMessage) error{
+	"setHold": func(t *egobee.Thermostat, params json.RawMessage) error {
+		p := &egobee.SetHoldParams{}
+		if err := json.Unmarshal(params, p); err != nil {
+			return err
+		}
+		hold := egobee.Event{
+			Type:           "hold",
+			Name:           "auto",
+			Running:        true,
+			StartDate:      p.StartDate,
+			StartTime:      p.StartTime,
+			EndDate:        p.EndDate,
+			EndTime:        p.EndTime,
+			CoolHoldTemp:   p.CoolHoldTemp,
+			HeatHoldTemp:   p.HeatHoldTemp,
+			HoldClimateRef: p.HoldClimateRef,
+			Fan:            p.Fan,
+		}
+		if p.HoldClimateRef != "" {
+			var found bool
+			for _, c := range t.Program.Climates {
+				if c.ClimateRef == p.HoldClimateRef {
+					hold.CoolHoldTemp, hold.HeatHoldTemp = c.CoolTemp, c.HeatTemp
+					found = true
+				}
+			}
+			if !found {
+				return fmt.Errorf("unknown climate %q", p.HoldClimateRef)
+			}
+		}
+		// A new hold replaces the running one.
+		if len(t.Events) > 0 && t.Events[0].Type == "hold" {
+			t.Events = t.Events[1:]
+		}
+		t.Events = append([]egobee.Event{hold}, t.Events...)
+		t.Runtime.DesiredCool, t.Runtime.DesiredHeat = hold.CoolHoldTemp, hold.HeatHoldTemp
+		return nil
+	},
+	"resumeProgram": func(t *egobee.Thermostat, params json.RawMessage) error {
+		p := &egobee.ResumeProgramParams{}
+		if err := json.Unmarshal(params, p); err != nil {
+			return err
+		}
+		for len(t.Events) > 0 {
+			t.Events = t.Events[1:]
+			if !p.ResumeAll {
+				break
+			}
+		}
+		return nil
+	},
+	"sendMessage": func(t *egobee.Thermostat, params json.RawMessage) error {
+		p := &egobee.SendMessageParams{}
+		if err := json.Unmarshal(params, p); err != nil {
+			return err
+		}
+		if len(p.Text) > 500 {
+			return fmt.Errorf("message is %v characters, at most 500 are allowed", len(p.Text))
+		}
+		return nil
+	},
+	"acknowledge": func(t *egobee.Thermostat, params json.RawMessage) error {
+		p := &egobee.AcknowledgeParams{}
+		if err := json.Unmarshal(params, p); err != nil {
+			return err
+		}
+		if p.ThermostatIdentifier != t.Identifier {
+			return nil
+		}
+		for i, a := range t.Alerts {
+			if a.AcknowledgeRef == p.AckRef {
+				t.Alerts = append(t.Alerts[:i], t.Alerts[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown alert %q", p.AckRef)
+	},
+	"createVacation": func(t *egobee.Thermostat, params json.RawMessage) error {
+		p := &egobee.CreateVacationParams{}
+		if err := json.Unmarshal(params, p); err != nil {
+			return err
+		}
+		t.Events = append(t.Events, egobee.Event{
+			Type:         "vacation",
+			Name:         p.Name,
+			StartDate:    p.StartDate,
+			StartTime:    p.StartTime,
+			EndDate:      p.EndDate,
+			EndTime:      p.EndTime,
+			CoolHoldTemp: p.CoolHoldTemp,
+			HeatHoldTemp: p.HeatHoldTemp,
+			Fan:          p.Fan,
+		})
+		return nil
+	},
+	"deleteVacation": func(t *egobee.Thermostat, params json.RawMessage) error {
+		p := &egobee.DeleteVacationParams{}
+		if err := json.Unmarshal(params, p); err != nil {
+			return err
+		}
+		for i, e := range t.Events {
+			if e.Type == "vacation" && e.Name == p.Name {
+				t.Events = append(t.Events[:i], t.Events[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown vacation %q", p.Name)
+	},
+	"updateSensor": func(t *egobee.Thermostat, params json.RawMessage) error {
+		p := &egobee.UpdateSensorParams{}
+		if err := json.Unmarshal(params, p); err != nil {
+			return err
+		}
+		for i := range t.RemoteSensors {
+			if t.RemoteSensors[i].ID == p.DeviceID+":"+p.SensorID {
+				t.RemoteSensors[i].Name = p.Name
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown sensor %v:%v", p.DeviceID, p.SensorID)
+	},
+	"updateClimate": func(t *egobee.Thermostat, params json.RawMessage) error {
+		p := &egobee.UpdateClimateParams{}
+		if err := json.Unmarshal(params, p); err != nil {
+			return err
+		}
+		for i := range t.Program.Climates {
+			c := &t.Program.Climates[i]
+			if c.ClimateRef != p.ClimateRef {
+				continue
+			}
+			if p.Name != "" {
+				c.Name = p.Name
+			}
+			if p.CoolTemp != 0 {
+				c.CoolTemp = p.CoolTemp
+			}
+			if p.HeatTemp != 0 {
+				c.HeatTemp = p.HeatTemp
+			}
+			if p.CoolFan != "" {
+				c.CoolFan = p.CoolFan
+			}
+			if p.HeatFan != "" {
+				c.HeatFan = p.HeatFan
+			}
+			return nil
+		}
+		return fmt.Errorf("unknown climate %q", p.ClimateRef)
+	},
+}
@@ -1 +1,138 @@
 package egobee
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Status codes returned by the ecobee API in the status object of a response.
+// See https://www.ecobee.com/home/developer/api/documentation/v1/general/responses.shtml
+const (
+	StatusCodeSuccess                = 0
+	StatusCodeAuthenticationFailed   = 1
+	StatusCodeNotAuthorized          = 2
+	StatusCodeProcessingError        = 3
+	StatusCodeSerializationError     = 4
+	StatusCodeInvalidRequestFormat   = 5
+	StatusCodeTooManyThermostats     = 6
+	StatusCodeValidationError        = 7
+	StatusCodeInvalidFunction        = 8
+	StatusCodeInvalidSelection       = 9
+	StatusCodeInvalidPage            = 10
+	StatusCodeFunctionError          = 11
+	StatusCodePostNotSupported       = 12
+	StatusCodeGetNotSupported        = 13
+	StatusCodeAuthenticationExpired  = 14
+	StatusCodeDuplicateDataViolation = 15
+	StatusCodeInvalidToken           = 16
+)
+
+// Status is included in every response from the ecobee API. A Code other than
+// StatusCodeSuccess indicates that the request failed.
+type Status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// err returns an *APIError if the Status indicates failure, and nil otherwise.
+func (s Status) err(httpStatusCode int) error {
+	if s.Code == StatusCodeSuccess {
+		return nil
+	}
+	return &APIError{
+		HTTPStatusCode: httpStatusCode,
+		Code:           s.Code,
+		Message:        s.Message,
+	}
+}
+
+// APIError is returned by Client methods when the ecobee API responds with a
+// non-success status. Use errors.As to inspect it.
+type APIError struct {
+	// HTTPStatusCode of the response.
+	HTTPStatusCode int
+	// Code is the ecobee status code, one of the StatusCode constants. It is
+	// StatusCodeSuccess if the response did not include a status object.
+	Code int
+	// Message accompanying the status code.
+	Message string
+}
+
+func (e *APIError) Error() string {
+	if e.Code == StatusCodeSuccess {
+		return fmt.Sprintf("non-ok status response from API: %v %v", e.HTTPStatusCode, e.Message)
+	}
+	return fmt.Sprintf("non-ok status from API: %v %v", e.Code, e.Message)
+}
+
+// isAPIError reports whether err is an *APIError for which match returns true.
+func isAPIError(err error, match func(*APIError) bool) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return match(apiErr)
+}
+
+// IsTokenExpired reports whether err was caused by an expired access token.
+// Refreshing the token and retrying the request should succeed.
+func IsTokenExpired(err error) bool {
+	return isAPIError(err, func(e *APIError) bool {
+		return e.Code == StatusCodeAuthenticationExpired
+	})
+}
+
+// IsTokenInvalid reports whether err was caused by an access token which has
+// been deauthorized by the user. The application must be authorized again.
+func IsTokenInvalid(err error) bool {
+	return isAPIError(err, func(e *APIError) bool {
+		return e.Code == StatusCodeInvalidToken
+	})
+}
+
+// IsNotAuthorized reports whether err was caused by a request which the
+// application is not authorized to make, such as a write with a smartRead
+// token.
+func IsNotAuthorized(err error) bool {
+	return isAPIError(err, func(e *APIError) bool {
+		return e.Code == StatusCodeAuthenticationFailed || e.Code == StatusCodeNotAuthorized
+	})
+}
+
+// IsRateLimited reports whether err was caused by the API rejecting a request
+// because too many requests have been made, which is reported with the HTTP
+// status 429 Too Many Requests. The ecobee API has no status code of its own
+// for this.
+func IsRateLimited(err error) bool {
+	return isAPIError(err, func(e *APIError) bool {
+		return e.HTTPStatusCode == http.StatusTooManyRequests
+	})
+}
+
+// AuthError is returned when the ecobee authorization API rejects a request,
+// such as a token refresh or a PIN authorization. Use errors.As to inspect it.
+type AuthError struct {
+	// HTTPStatusCode of the response.
+	HTTPStatusCode int
+	// Code identifying the type of error.
+	Code AuthorizationError
+	// Description of the error, intended for humans.
+	Description string
+	// URI of documentation for the error, if any.
+	URI string
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Code, e.Description)
+}
+
+// IsAuthorizationError reports whether err was caused by the authorization API
+// rejecting a request with the given code.
+func IsAuthorizationError(err error, code AuthorizationError) bool {
+	var authErr *AuthError
+	if !errors.As(err, &authErr) {
+		return false
+	}
+	return authErr.Code == code
+}
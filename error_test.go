@@ -1 +1,97 @@
 package egobee
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestAPIErrorError(t *testing.T) {
+	for _, tt := range []struct {
+		err  *APIError
+		want string
+	}{
+		{
+			err:  &APIError{HTTPStatusCode: 503, Message: "Service Unavailable"},
+			want: "non-ok status response from API: 503 Service Unavailable",
+		},
+		{
+			err:  &APIError{HTTPStatusCode: 500, Code: 14, Message: "Authentication token has expired."},
+			want: "non-ok status from API: 14 Authentication token has expired.",
+		},
+	} {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("got: %q, want: %q", got, tt.want)
+		}
+	}
+}
+
+func TestStatusErr(t *testing.T) {
+	if err := (Status{Code: StatusCodeSuccess, Message: "whatever"}).err(200); err != nil {
+		t.Errorf("got unexpected error for success status: %v", err)
+	}
+	err := (Status{Code: StatusCodeInvalidSelection, Message: "Invalid selection."}).err(200)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("got %#v, want *APIError", err)
+	}
+	if apiErr.Code != StatusCodeInvalidSelection || apiErr.HTTPStatusCode != 200 || apiErr.Message != "Invalid selection." {
+		t.Errorf("got unexpected APIError: %#v", apiErr)
+	}
+}
+
+func TestErrorPredicates(t *testing.T) {
+	expired := &APIError{HTTPStatusCode: 500, Code: StatusCodeAuthenticationExpired}
+	invalid := &APIError{HTTPStatusCode: 500, Code: StatusCodeInvalidToken}
+	notAuthorized := &APIError{HTTPStatusCode: 500, Code: StatusCodeNotAuthorized}
+	authFailed := &APIError{HTTPStatusCode: 500, Code: StatusCodeAuthenticationFailed}
+	limited := &APIError{HTTPStatusCode: 429, Message: "Too Many Requests"}
+	plain := errors.New("not an APIError")
+
+	for _, tt := range []struct {
+		name      string
+		predicate func(error) bool
+		err       error
+		want      bool
+	}{
+		{"IsTokenExpired expired", IsTokenExpired, expired, true},
+		{"IsTokenExpired wrapped", IsTokenExpired, fmt.Errorf("wrapped: %w", expired), true},
+		{"IsTokenExpired invalid", IsTokenExpired, invalid, false},
+		{"IsTokenExpired plain", IsTokenExpired, plain, false},
+		{"IsTokenExpired nil", IsTokenExpired, nil, false},
+		{"IsTokenInvalid invalid", IsTokenInvalid, invalid, true},
+		{"IsTokenInvalid expired", IsTokenInvalid, expired, false},
+		{"IsNotAuthorized not authorized", IsNotAuthorized, notAuthorized, true},
+		{"IsNotAuthorized auth failed", IsNotAuthorized, authFailed, true},
+		{"IsNotAuthorized expired", IsNotAuthorized, expired, false},
+		{"IsRateLimited limited", IsRateLimited, limited, true},
+		{"IsRateLimited expired", IsRateLimited, expired, false},
+		{"IsRateLimited plain", IsRateLimited, plain, false},
+	} {
+		if got := tt.predicate(tt.err); got != tt.want {
+			t.Errorf("%v: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIsAuthorizationError(t *testing.T) {
+	err := &AuthError{HTTPStatusCode: 400, Code: AuthorizationErrorInvalidGrant, Description: "bad token"}
+	if got, want := err.Error(), "invalid_grant: bad token"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+	for _, tt := range []struct {
+		name string
+		err  error
+		code AuthorizationError
+		want bool
+	}{
+		{"matching", err, AuthorizationErrorInvalidGrant, true},
+		{"wrapped", fmt.Errorf("unable to re-authenticate: %w", err), AuthorizationErrorInvalidGrant, true},
+		{"other code", err, AuthorizationErrorSlowDown, false},
+		{"not an AuthError", errors.New("nope"), AuthorizationErrorInvalidGrant, false},
+	} {
+		if got := IsAuthorizationError(tt.err, tt.code); got != tt.want {
+			t.Errorf("%v: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
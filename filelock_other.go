@@ -0,0 +1,17 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package egobee
+
+import "os"
+
+// tryLockFile does nothing on platforms without advisory file locks, so
+// processes sharing a store are not protected from each other there.
+func tryLockFile(f *os.File) (bool, error) {
+	return true, nil
+}
+
+// unlockFile does nothing.
+func unlockFile(f *os.File) error {
+	return nil
+}
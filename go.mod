@@ -1,10 +1,11 @@
 module github.com/cfunkhouser/egobee
 
-go 1.12
+go 1.13
 
 require (
 	github.com/imdario/mergo v0.3.7
 	github.com/kr/pretty v0.1.0 // indirect
+	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
 	gopkg.in/yaml.v2 v2.2.2 // indirect
 )
@@ -0,0 +1,269 @@
+package egobee_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cfunkhouser/egobee"
+	"github.com/cfunkhouser/egobee/egobeetest"
+)
+
+// These tests exercise the Client against the fake API in egobeetest.
+
+func testThermostats(n int) []*egobee.Thermostat {
+	var thermostats []*egobee.Thermostat
+	for i := 1; i <= n; i++ {
+		thermostats = append(thermostats, &egobee.Thermostat{
+			Identifier: fmt.Sprintf("%03d", i),
+			Name:       fmt.Sprintf("Thermostat %d", i),
+			Runtime: egobee.Runtime{
+				Connected:         true,
+				ActualTemperature: egobee.FromFahrenheit(70),
+			},
+			Settings: egobee.Settings{HVACMode: "heat"},
+		})
+	}
+	return thermostats
+}
+
+func TestIntegrationThermostatsPaging(t *testing.T) {
+	s := egobeetest.NewServer(testThermostats(5)...)
+	defer s.Close()
+	s.PageSize = 2
+	client := s.Client()
+
+	got, err := client.Thermostats(&egobee.Selection{
+		SelectionType:  egobee.SelectionTypeRegistered,
+		IncludeRuntime: true,
+	})
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if len(got) != 5 {
+		t.Fatalf("got %v thermostats, want 5", len(got))
+	}
+	if got[4].Identifier != "005" || got[4].Runtime.ActualTemperature != 700 {
+		t.Errorf("got unexpected thermostat %+v", got[4])
+	}
+	if got[0].Settings.HVACMode != "" {
+		t.Error("got settings which were not included in the selection")
+	}
+	if n := s.Requests("/1/thermostat"); n != 3 {
+		t.Errorf("got %v requests, want 3", n)
+	}
+
+	got, err = client.Thermostats(&egobee.Selection{
+		SelectionType:  egobee.SelectionTypeThermostats,
+		SelectionMatch: "002,004",
+	})
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if len(got) != 2 || got[0].Identifier != "002" || got[1].Identifier != "004" {
+		t.Errorf("got unexpected thermostats %+v", got)
+	}
+}
+
+func TestIntegrationTokenRefresh(t *testing.T) {
+	s := egobeetest.NewServer(testThermostats(1)...)
+	defer s.Close()
+	client := s.Client()
+
+	s.ExpireTokens()
+	if _, err := client.ThermostatSummary(); err != nil {
+		t.Fatalf("got unexpected error after tokens expired: %v", err)
+	}
+	if n := s.Requests("/token"); n != 1 {
+		t.Errorf("got %v token requests, want 1", n)
+	}
+
+	// The refresh token was rotated, so a second refresh must use the new one.
+	s.ExpireTokens()
+	if _, err := client.ThermostatSummary(); err != nil {
+		t.Fatalf("got unexpected error after tokens expired again: %v", err)
+	}
+
+	s.RevokeTokens()
+	_, err := client.ThermostatSummary()
+	if !egobee.IsTokenInvalid(err) {
+		t.Errorf("got error %v after tokens were revoked, want an invalid token error", err)
+	}
+}
+
+func TestIntegrationFailures(t *testing.T) {
+	s := egobeetest.NewServer(testThermostats(1)...)
+	defer s.Close()
+	client := s.Client()
+
+	s.FailNext(egobeetest.Failure{Path: "/1/thermostatSummary", HTTPStatusCode: http.StatusTooManyRequests})
+	_, err := client.ThermostatSummary()
+	if !egobee.IsRateLimited(err) {
+		t.Errorf("got error %v, want a rate limiting error", err)
+	}
+	s.FailNext(egobeetest.Failure{Code: egobee.StatusCodeProcessingError, Message: "Processing error."})
+	_, err = client.Thermostats(&egobee.Selection{SelectionType: egobee.SelectionTypeRegistered})
+	var apiErr *egobee.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != egobee.StatusCodeProcessingError {
+		t.Errorf("got error %v, want a processing error", err)
+	}
+	if _, err := client.ThermostatSummary(); err != nil {
+		t.Errorf("got unexpected error once failures were used up: %v", err)
+	}
+}
+
+func TestIntegrationFunctions(t *testing.T) {
+	thermostats := testThermostats(2)
+	thermostats[0].Alerts = []egobee.Alert{{AcknowledgeRef: "ack-1", Text: "Change your filter"}}
+	s := egobeetest.NewServer(thermostats...)
+	defer s.Close()
+	client := s.Client()
+
+	sel := &egobee.Selection{SelectionType: egobee.SelectionTypeThermostats, SelectionMatch: "001"}
+	summary, err := client.ThermostatSummaryWithSelection(sel)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	before, err := summary.Revisions()
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	if err := client.UpdateThermostats(sel,
+		egobee.SetHold(egobee.SetHoldParams{
+			HeatHoldTemp: egobee.FromCelsius(22),
+			CoolHoldTemp: egobee.FromCelsius(26),
+			HoldType:     egobee.HoldTypeIndefinite,
+		}),
+		egobee.Acknowledge("001", "ack-1", egobee.AcknowledgeTypeAccept, false),
+	); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	got := s.Thermostat("001")
+	if len(got.Events) != 1 || got.Events[0].Type != "hold" || got.Events[0].HeatHoldTemp != egobee.FromCelsius(22) {
+		t.Errorf("got events %+v, want a hold", got.Events)
+	}
+	if len(got.Alerts) != 0 {
+		t.Errorf("got alerts %+v after acknowledging", got.Alerts)
+	}
+	if other := s.Thermostat("002"); len(other.Events) != 0 {
+		t.Errorf("unselected thermostat was modified: %+v", other.Events)
+	}
+
+	summary, err = client.ThermostatSummaryWithSelection(sel)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	after, err := summary.Revisions()
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if after[0].ThermostatRev == before[0].ThermostatRev || after[0].AlertsRev == before[0].AlertsRev {
+		t.Errorf("revisions not advanced; before: %+v, after: %+v", before[0], after[0])
+	}
+
+	err = client.UpdateThermostats(sel, egobee.DeleteVacation("nonexistent"))
+	var apiErr *egobee.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != egobee.StatusCodeFunctionError {
+		t.Errorf("got error %v, want a function error", err)
+	}
+}
+
+func TestIntegrationUpdateThermostat(t *testing.T) {
+	s := egobeetest.NewServer(testThermostats(1)...)
+	defer s.Close()
+	client := s.Client()
+
+	p := egobee.NewThermostatPatch()
+	if err := p.Set("settings.heatMaxTemp", egobee.FromFahrenheit(78)); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if err := client.UpdateThermostat(&egobee.Selection{SelectionType: egobee.SelectionTypeRegistered}, p); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	got := s.Thermostat("001")
+	if got.Settings.HeatMaxTemp != 780 {
+		t.Errorf("got heatMaxTemp %v, want 78°F", got.Settings.HeatMaxTemp)
+	}
+	if got.Settings.HVACMode != "heat" {
+		t.Errorf("patch clobbered hvacMode; got %q, want heat", got.Settings.HVACMode)
+	}
+}
+
+func TestIntegrationWatcher(t *testing.T) {
+	s := egobeetest.NewServer(testThermostats(2)...)
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := egobee.NewWatcher(s.Client(), &egobee.WatcherOptions{
+		Selection: &egobee.Selection{SelectionType: egobee.SelectionTypeRegistered, IncludeRuntime: true},
+		OnError:   func(err error) { t.Errorf("got unexpected error: %v", err) },
+	})
+	go w.Run(ctx)
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		ids = append(ids, (<-w.Events()).Thermostat.Identifier)
+	}
+	if want := []string{"001", "002"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got initial events for %v, want %v", ids, want)
+	}
+}
+
+func TestIntegrationPinAuthorization(t *testing.T) {
+	s := egobeetest.NewServer()
+	defer s.Close()
+	s.PinInterval = 1
+
+	a := egobee.NewPinAuthorizer(s.AppID, egobee.ScopeSmartWrite, s.Options())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	trr, err := a.Authorize(ctx, func(pac *egobee.PinAuthenticationChallenge) error {
+		return s.AuthorizePin(pac.Pin)
+	})
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	client := egobee.New(s.AppID, egobee.NewMemoryTokenStore(trr), s.Options())
+	if _, err := client.ThermostatSummary(); err != nil {
+		t.Errorf("got unexpected error using authorized tokens: %v", err)
+	}
+}
+
+func TestIntegrationCodeAuthorization(t *testing.T) {
+	s := egobeetest.NewServer()
+	defer s.Close()
+
+	a := egobee.NewCodeAuthorizer(s.AppID, "https://example.com/callback", egobee.ScopeSmartRead, s.Options())
+	noRedirect := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	res, err := noRedirect.Get(a.AuthorizeURL("xyzzy"))
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	res.Body.Close()
+	loc, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if got := loc.Query().Get("state"); got != "xyzzy" {
+		t.Errorf("got state %q, want xyzzy", got)
+	}
+	trr, err := a.Exchange(context.Background(), loc.Query().Get("code"))
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if trr.Scope != egobee.ScopeSmartRead {
+		t.Errorf("got scope %v, want %v", trr.Scope, egobee.ScopeSmartRead)
+	}
+	if _, err := a.Exchange(context.Background(), loc.Query().Get("code")); !egobee.IsAuthorizationError(err, egobee.AuthorizationErrorInvalidGrant) {
+		t.Errorf("got error %v reusing the code, want invalid_grant", err)
+	}
+}
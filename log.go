@@ -0,0 +1,128 @@
+package egobee
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Level of a log message.
+type Level int
+
+// Levels of log messages, in increasing order of severity.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// Logger receives structured log messages from a Client. Implementations must
+// be safe for concurrent use.
+type Logger interface {
+	// Enabled reports whether messages at level are logged, so that expensive
+	// messages such as dumps of requests may be skipped.
+	Enabled(level Level) bool
+	// Log msg with context in keyvals, which alternate between string keys and
+	// values of any type.
+	Log(level Level, msg string, keyvals ...interface{})
+}
+
+// writerLogger is a Logger which formats messages as text.
+type writerLogger struct {
+	l   *log.Logger
+	min Level
+}
+
+// NewWriterLogger returns a Logger which writes messages at min or above to w
+// as text, one message per line. Values containing line breaks, such as dumps
+// of requests, are written on the lines following their message.
+func NewWriterLogger(w io.Writer, min Level) Logger {
+	return &writerLogger{l: log.New(w, "", log.LstdFlags), min: min}
+}
+
+func (l *writerLogger) Enabled(level Level) bool {
+	return level >= l.min
+}
+
+func (l *writerLogger) Log(level Level, msg string, keyvals ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v %v", level, msg)
+	var blocks []string
+	for i := 0; i < len(keyvals); i += 2 {
+		var v interface{} = "MISSING"
+		if i+1 < len(keyvals) {
+			v = keyvals[i+1]
+		}
+		s := fmt.Sprint(v)
+		switch {
+		case strings.Contains(s, "\n"):
+			blocks = append(blocks, fmt.Sprintf("%v:\n%v", keyvals[i], strings.TrimRight(s, "\r\n")))
+			continue
+		case s == "" || strings.ContainsAny(s, " \t\"="):
+			s = fmt.Sprintf("%q", s)
+		}
+		fmt.Fprintf(&b, " %v=%v", keyvals[i], s)
+	}
+	for _, block := range blocks {
+		b.WriteString("\n" + block)
+	}
+	l.l.Print(b.String())
+}
+
+// logAt logs to l, if it is not nil.
+func logAt(l Logger, level Level, msg string, keyvals ...interface{}) {
+	if l != nil {
+		l.Log(level, msg, keyvals...)
+	}
+}
+
+// redacted replaces secrets in logs.
+const redacted = "REDACTED"
+
+var (
+	// Credentials in query strings and form encoded bodies.
+	secretParams = regexp.MustCompile(`(?m)((?:^|[?&])(?:access_token|refresh_token|code)=)[^&\s]*`)
+	// Credentials in headers, keeping the authorization scheme.
+	secretHeaders = regexp.MustCompile(`(?im)^((?:proxy-)?authorization:[ \t]*(?:[a-z]+[ \t]+)?)[^\r\n]+`)
+	// String credentials in JSON bodies.
+	secretFields = regexp.MustCompile(`("(?:access_token|refresh_token|code)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+)
+
+// redact access tokens, refresh tokens and authorization codes from s, which
+// may be a URL or a dump of an HTTP request or response.
+func redact(s string) string {
+	s = secretParams.ReplaceAllString(s, "${1}"+redacted)
+	s = secretHeaders.ReplaceAllString(s, "${1}"+redacted)
+	return secretFields.ReplaceAllString(s, `${1}"`+redacted+`"`)
+}
+
+// redactURLError removes credentials from the URL in err, if it is a
+// *url.Error. Such errors are returned by requests which carry credentials in
+// their query string, and would otherwise leak them wherever they are logged.
+func redactURLError(err error) error {
+	if ue, ok := err.(*url.Error); ok {
+		return &url.Error{Op: ue.Op, URL: redact(ue.URL), Err: ue.Err}
+	}
+	return err
+}
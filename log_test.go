@@ -0,0 +1,204 @@
+package egobee
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLevelString(t *testing.T) {
+	for l, want := range map[Level]string{
+		LevelDebug: "DEBUG",
+		LevelInfo:  "INFO",
+		LevelWarn:  "WARN",
+		LevelError: "ERROR",
+		Level(7):   "Level(7)",
+	} {
+		if got := l.String(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestWriterLogger(t *testing.T) {
+	var b bytes.Buffer
+	l := NewWriterLogger(&b, LevelInfo)
+	if l.Enabled(LevelDebug) || !l.Enabled(LevelWarn) {
+		t.Error("got wrong levels enabled for LevelInfo")
+	}
+	l.Log(LevelDebug, "Hidden")
+	l.Log(LevelWarn, "Something happened", "id", 3, "error", "a b", "empty", "", "dump", "GET / HTTP/1.1\r\nHost: x\r\n\r\n", "odd")
+	got := b.String()
+	if strings.Contains(got, "Hidden") {
+		t.Errorf("got message below the minimum level:\n%v", got)
+	}
+	want := "WARN Something happened id=3 error=\"a b\" empty=\"\" odd=MISSING\ndump:\nGET / HTTP/1.1\r\nHost: x\n"
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("got:\n%q\nwant suffix:\n%q", got, want)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	for _, tt := range []struct {
+		name, in, want string
+	}{
+		{
+			name: "refresh URL",
+			in:   "https://api.ecobee.com/token?grant_type=refresh_token&refresh_token=secret&client_id=app",
+			want: "https://api.ecobee.com/token?grant_type=refresh_token&refresh_token=REDACTED&client_id=app",
+		},
+		{
+			name: "authorization code",
+			in:   "POST /token?grant_type=ecobeePin&code=secret&client_id=app HTTP/1.1",
+			want: "POST /token?grant_type=ecobeePin&code=REDACTED&client_id=app HTTP/1.1",
+		},
+		{
+			name: "form body",
+			in:   "\r\n\r\nrefresh_token=secret&grant_type=refresh_token",
+			want: "\r\n\r\nrefresh_token=REDACTED&grant_type=refresh_token",
+		},
+		{
+			name: "bearer header",
+			in:   "GET /1/thermostat HTTP/1.1\r\nAuthorization: Bearer secret\r\nHost: x\r\n",
+			want: "GET /1/thermostat HTTP/1.1\r\nAuthorization: Bearer REDACTED\r\nHost: x\r\n",
+		},
+		{
+			name: "bare header",
+			in:   "proxy-authorization: secret\n",
+			want: "proxy-authorization: REDACTED\n",
+		},
+		{
+			name: "token response",
+			in:   `{"access_token": "secret","token_type":"Bearer","refresh_token":"se\"cret","code":"secret","status":{"code":0}}`,
+			want: `{"access_token": "REDACTED","token_type":"Bearer","refresh_token":"REDACTED","code":"REDACTED","status":{"code":0}}`,
+		},
+		{
+			name: "nothing secret",
+			in:   "https://api.ecobee.com/1/thermostat?json={}&encode=true",
+			want: "https://api.ecobee.com/1/thermostat?json={}&encode=true",
+		},
+	} {
+		if got := redact(tt.in); got != tt.want {
+			t.Errorf("%v: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRedactURLError(t *testing.T) {
+	err := redactURLError(&url.Error{Op: "Post", URL: "https://x/token?refresh_token=secret", Err: errors.New("boom")})
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("got unredacted error %v", err)
+	}
+	other := errors.New("refresh_token=unchanged")
+	if got := redactURLError(other); got != other {
+		t.Errorf("got %v, want %v", got, other)
+	}
+}
+
+// recordingLogger is a Logger which records messages.
+type recordingLogger struct {
+	mu       sync.Mutex
+	min      Level
+	messages []string
+}
+
+func (l *recordingLogger) Enabled(level Level) bool {
+	return level >= l.min
+}
+
+func (l *recordingLogger) Log(level Level, msg string, keyvals ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, fmt.Sprint(level, " ", msg, " ", keyvals))
+}
+
+func (l *recordingLogger) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return strings.Join(l.messages, "\n")
+}
+
+func TestLoggingTransportRedacts(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"access_token":"newaccess","refresh_token":"newrefresh","expires_in":3600}`))
+	}))
+	defer s.Close()
+
+	for _, logTokens := range []bool{false, true} {
+		l := &recordingLogger{}
+		client := &http.Client{Transport: &loggingTransport{
+			l:         l,
+			logTokens: logTokens,
+			transport: http.DefaultTransport,
+		}}
+		req, _ := http.NewRequest(http.MethodPost, s.URL+"/token?grant_type=refresh_token&refresh_token=oldrefresh", nil)
+		req.Header.Set("Authorization", "Bearer oldaccess")
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+		res.Body.Close()
+
+		logs := l.String()
+		if !strings.Contains(logs, "Outgoing request") || !strings.Contains(logs, "Incoming response") {
+			t.Errorf("request and response were not logged:\n%v", logs)
+		}
+		for _, secret := range []string{"oldrefresh", "oldaccess", "newaccess", "newrefresh"} {
+			if strings.Contains(logs, secret) != logTokens {
+				t.Errorf("LogTokens %v: got %q logged: %v\n%v", logTokens, secret, !logTokens, logs)
+			}
+		}
+	}
+
+	// Nothing is dumped unless debug logging is enabled.
+	l := &recordingLogger{min: LevelInfo}
+	client := &http.Client{Transport: &loggingTransport{l: l, transport: http.DefaultTransport}}
+	res, err := client.Get(s.URL)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if logs := l.String(); logs != "" {
+		t.Errorf("got unexpected logs:\n%v", logs)
+	}
+}
+
+func TestClientLogsRefreshes(t *testing.T) {
+	s := httptest.NewServer(&expiringTokenTestServer{t: t})
+	defer s.Close()
+
+	l := &recordingLogger{min: LevelInfo}
+	ts := NewMemoryTokenStore(&TokenRefreshResponse{
+		AccessToken:  "revokedtoken",
+		RefreshToken: "refresh0",
+		ExpiresIn:    TokenDuration{Duration: time.Hour},
+	})
+	c := New("app", ts, &Options{APIHost: s.URL, Logger: l})
+	if _, err := c.ThermostatSummary(); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if logs := l.String(); !strings.Contains(logs, "INFO Refreshed access token") {
+		t.Errorf("refresh was not logged:\n%v", logs)
+	}
+
+	// The refresh token is not leaked by errors.
+	s.Close()
+	ts.Update(&TokenRefreshResponse{RefreshToken: "secret"})
+	_, err := c.ThermostatSummary()
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("got error leaking refresh token: %v", err)
+	}
+	if logs := l.String(); !strings.Contains(logs, "WARN Failed to refresh access token") || strings.Contains(logs, "secret") {
+		t.Errorf("got unexpected logs:\n%v", logs)
+	}
+}
@@ -0,0 +1,196 @@
+package egobee
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var thermostatType = reflect.TypeOf(Thermostat{})
+
+// atomicPatchPaths are properties which the API only accepts in their
+// entirety, so DiffThermostat never descends into them.
+var atomicPatchPaths = map[string]bool{
+	"program": true,
+}
+
+// ThermostatPatch is a sparse set of changes to a Thermostat, for use with
+// Client.UpdateThermostat. Only the properties which have been Set are sent to
+// the API, so the rest of the thermostat's configuration is left alone.
+//
+// Properties are named by their JSON paths, such as "settings.hvacMode". Not
+// every property may be written; see the ecobee documentation for each object.
+//
+// The zero value is an empty patch, ready to use.
+type ThermostatPatch struct {
+	fields map[string]interface{}
+}
+
+// NewThermostatPatch returns an empty ThermostatPatch.
+func NewThermostatPatch() *ThermostatPatch {
+	return &ThermostatPatch{fields: make(map[string]interface{})}
+}
+
+// patchField returns the field of t with the JSON name name, if there is one.
+func patchField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		if tag := strings.Split(f.Tag.Get("json"), ",")[0]; tag == name && tag != "-" {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// patchValue converts value to t, if it is of a compatible type. A value of a
+// different type of the same kind, such as an int for a Temperature, is
+// converted.
+func patchValue(t reflect.Type, value interface{}) (interface{}, bool) {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return nil, false
+	}
+	if v.Kind() == reflect.Ptr && !v.IsNil() && t.Kind() != reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Type().AssignableTo(t) {
+		return v.Interface(), true
+	}
+	if v.Kind() == t.Kind() && v.Type().ConvertibleTo(t) {
+		return v.Convert(t).Interface(), true
+	}
+	return nil, false
+}
+
+// Set the property at path to value. path is a dot-separated list of JSON
+// property names, starting from the Thermostat, and value must be of the
+// property's type. For example:
+//
+//	p.Set("settings.hvacMode", "heat")
+//	p.Set("settings.heatMaxTemp", egobee.FromCelsius(25))
+//	p.Set("program", program)
+//
+// Setting an object, such as "program", replaces every property in it. It is
+// an error to set both an object and a property within it, in either order.
+func (p *ThermostatPatch) Set(path string, value interface{}) error {
+	if p.fields == nil {
+		p.fields = make(map[string]interface{})
+	}
+	names := strings.Split(path, ".")
+	t := thermostatType
+	fields := p.fields
+	for i, name := range names {
+		f, ok := patchField(t, name)
+		if !ok {
+			return fmt.Errorf("unknown thermostat property %q", strings.Join(names[:i+1], "."))
+		}
+		if i == len(names)-1 {
+			v, ok := patchValue(f.Type, value)
+			if !ok {
+				return fmt.Errorf("cannot set thermostat property %q of type %v to %T", path, f.Type, value)
+			}
+			if set, ok := fields[name].(map[string]interface{}); ok {
+				if paths := patchPaths(path+".", set); len(paths) > 0 {
+					return fmt.Errorf("thermostat property %q conflicts with %q, which is already set", path, paths[0])
+				}
+			}
+			fields[name] = v
+			return nil
+		}
+		if f.Type.Kind() != reflect.Struct {
+			return fmt.Errorf("thermostat property %q is not an object", strings.Join(names[:i+1], "."))
+		}
+		next, ok := fields[name].(map[string]interface{})
+		if !ok {
+			if _, set := fields[name]; set {
+				return fmt.Errorf("thermostat property %q conflicts with %q, which is already set", path, strings.Join(names[:i+1], "."))
+			}
+			next = make(map[string]interface{})
+			fields[name] = next
+		}
+		t, fields = f.Type, next
+	}
+	return nil
+}
+
+// Empty reports whether no properties have been set.
+func (p *ThermostatPatch) Empty() bool {
+	return p == nil || len(p.fields) == 0
+}
+
+// Paths of every property which has been set, in sorted order.
+func (p *ThermostatPatch) Paths() []string {
+	if p == nil {
+		return nil
+	}
+	return patchPaths("", p.fields)
+}
+
+// patchPaths returns the paths of every property set in fields, prefixed with
+// prefix, in sorted order.
+func patchPaths(prefix string, fields map[string]interface{}) []string {
+	var paths []string
+	var walk func(prefix string, fields map[string]interface{})
+	walk = func(prefix string, fields map[string]interface{}) {
+		for name, v := range fields {
+			if m, ok := v.(map[string]interface{}); ok {
+				walk(prefix+name+".", m)
+				continue
+			}
+			paths = append(paths, prefix+name)
+		}
+	}
+	walk(prefix, fields)
+	sort.Strings(paths)
+	return paths
+}
+
+// MarshalJSON serializes only the properties which have been set.
+func (p *ThermostatPatch) MarshalJSON() ([]byte, error) {
+	if p == nil || p.fields == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(p.fields)
+}
+
+// DiffThermostat returns a ThermostatPatch which changes each property of from
+// which differs in to. This allows a Thermostat to be retrieved, modified and
+// written back without sending the properties which were not modified. The
+// program is always replaced in its entirety if any part of it changed.
+func DiffThermostat(from, to *Thermostat) (*ThermostatPatch, error) {
+	p := NewThermostatPatch()
+	if err := p.diff("", reflect.ValueOf(from).Elem(), reflect.ValueOf(to).Elem()); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *ThermostatPatch) diff(prefix string, from, to reflect.Value) error {
+	t := from.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if f.PkgPath != "" || name == "" || name == "-" {
+			continue
+		}
+		path := prefix + name
+		a, b := from.Field(i), to.Field(i)
+		if f.Type.Kind() == reflect.Struct && !atomicPatchPaths[path] {
+			if err := p.diff(path+".", a, b); err != nil {
+				return err
+			}
+			continue
+		}
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			if err := p.Set(path, b.Interface()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
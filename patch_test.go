@@ -0,0 +1,194 @@
+package egobee
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestThermostatPatchSet(t *testing.T) {
+	p := NewThermostatPatch()
+	for _, tt := range []struct {
+		path  string
+		value interface{}
+	}{
+		{"name", "Upstairs"},
+		{"settings.hvacMode", "heat"},
+		{"settings.heatMaxTemp", FromFahrenheit(75)},
+		{"settings.coolMinTemp", 650},
+		{"settings.useCelsius", true},
+		{"location.timeZone", "America/Toronto"},
+		{"houseDetails.numberOfOccupants", 3},
+	} {
+		if err := p.Set(tt.path, tt.value); err != nil {
+			t.Errorf("Set(%q, %v): got unexpected error: %v", tt.path, tt.value, err)
+		}
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	want := `{"houseDetails":{"numberOfOccupants":3},"location":{"timeZone":"America/Toronto"},"name":"Upstairs","settings":{"coolMinTemp":650,"heatMaxTemp":750,"hvacMode":"heat","useCelsius":true}}`
+	if string(b) != want {
+		t.Errorf("got: %s\nwant: %s", b, want)
+	}
+	wantPaths := []string{
+		"houseDetails.numberOfOccupants",
+		"location.timeZone",
+		"name",
+		"settings.coolMinTemp",
+		"settings.heatMaxTemp",
+		"settings.hvacMode",
+		"settings.useCelsius",
+	}
+	if got := p.Paths(); !reflect.DeepEqual(got, wantPaths) {
+		t.Errorf("got paths %v, want %v", got, wantPaths)
+	}
+}
+
+func TestThermostatPatchZeroValue(t *testing.T) {
+	var p ThermostatPatch
+	if !p.Empty() {
+		t.Error("zero value patch is not Empty")
+	}
+	if b, err := json.Marshal(&p); err != nil || string(b) != "{}" {
+		t.Errorf("got %s, %v for zero value patch, want {}", b, err)
+	}
+	if err := p.Set("name", "Upstairs"); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	b, err := json.Marshal(&p)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if want := `{"name":"Upstairs"}`; string(b) != want {
+		t.Errorf("got: %s\nwant: %s", b, want)
+	}
+}
+
+func TestThermostatPatchSetErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		path  string
+		value interface{}
+	}{
+		{"unknown property", "settings.hvacMood", "heat"},
+		{"unknown object", "setting.hvacMode", "heat"},
+		{"wrong type", "settings.hvacMode", 1},
+		{"float temperature", "settings.heatMaxTemp", 75.0},
+		{"not an object", "name.first", "Up"},
+		{"nil", "name", nil},
+	} {
+		if err := NewThermostatPatch().Set(tt.path, tt.value); err == nil {
+			t.Errorf("%v: expected error, got nil", tt.name)
+		}
+	}
+}
+
+func TestThermostatPatchSetConflicts(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		first, second string
+		firstValue    interface{}
+		secondValue   interface{}
+		want          string
+	}{
+		{
+			"child after parent",
+			"program", "program.currentClimateRef",
+			&Program{}, "home",
+			`thermostat property "program.currentClimateRef" conflicts with "program", which is already set`,
+		},
+		{
+			"parent after child",
+			"program.currentClimateRef", "program",
+			"home", &Program{},
+			`thermostat property "program" conflicts with "program.currentClimateRef", which is already set`,
+		},
+	} {
+		p := NewThermostatPatch()
+		if err := p.Set(tt.first, tt.firstValue); err != nil {
+			t.Fatalf("%v: got unexpected error: %v", tt.name, err)
+		}
+		err := p.Set(tt.second, tt.secondValue)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%v: got error %v, want %q", tt.name, err, tt.want)
+		}
+		if got, want := p.Paths(), []string{tt.first}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got paths %v after conflict, want %v", tt.name, got, want)
+		}
+	}
+}
+
+func TestDiffThermostat(t *testing.T) {
+	from := &Thermostat{
+		Identifier: "123",
+		Name:       "Downstairs",
+		Settings: Settings{
+			HVACMode:    "auto",
+			HeatMaxTemp: 780,
+		},
+		Program: *testProgram(),
+	}
+	to := *from
+	to.Name = "Upstairs"
+	to.Settings.HVACMode = "heat"
+	s, err := NewSchedule(&from.Program)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if err := s.Set(Weekend, 0, 6*SlotDuration, "home"); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	program, err := s.Program()
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	to.Program = *program
+
+	p, err := DiffThermostat(from, &to)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if want := []string{"name", "program", "settings.hvacMode"}; !reflect.DeepEqual(p.Paths(), want) {
+		t.Errorf("got paths %v, want %v", p.Paths(), want)
+	}
+
+	if p, err := DiffThermostat(from, from); err != nil || !p.Empty() {
+		t.Errorf("got %v, %v for identical thermostats, want an empty patch", p.Paths(), err)
+	}
+}
+
+func TestClientUpdateThermostat(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("invalid method; got: %q, want: %q", r.Method, http.MethodPost)
+		}
+		if got := r.URL.Query().Get("format"); got != "json" {
+			t.Errorf(`invalid format; got: %q, want: "json"`, got)
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		want := `{"selection":{"selectionType":"thermostats","selectionMatch":"123"},"thermostat":{"settings":{"hvacMode":"off"}}}`
+		if string(b) != want {
+			t.Errorf("invalid body;\ngot: %s\nwant: %s", b, want)
+		}
+		w.Write([]byte(`{"status":{"code":0,"message":""}}`))
+	}))
+	defer s.Close()
+	client := &Client{api: apiBaseURL(s.URL)}
+
+	p := NewThermostatPatch()
+	if err := p.Set("settings.hvacMode", "off"); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	sel := &Selection{SelectionType: SelectionTypeThermostats, SelectionMatch: "123"}
+	if err := client.UpdateThermostat(sel, p); err != nil {
+		t.Errorf("got unexpected error: %v", err)
+	}
+	if err := client.UpdateThermostat(sel, NewThermostatPatch()); err == nil {
+		t.Error("expected error for empty patch, got nil")
+	}
+}
@@ -0,0 +1,167 @@
+package egobee
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var (
+	// timeAfter overrideable for testing.
+	timeAfter = time.After
+
+	// slowDownIncrement is added to the polling interval each time the API
+	// responds with slow_down.
+	slowDownIncrement = 5 * time.Second
+)
+
+const defaultPinPollInterval = 30 * time.Second
+
+// PinAuthorizer authorizes an application using the ecobee PIN flow. The user
+// enters the PIN from a challenge in the "My Apps" section of the ecobee web
+// portal, after which the application may retrieve its tokens.
+// See https://www.ecobee.com/home/developer/api/documentation/v1/auth/pin-api-authorization.shtml
+type PinAuthorizer struct {
+	appID  string
+	scope  Scope
+	api    apiBaseURL
+	client *http.Client
+}
+
+// NewPinAuthorizer for the application with appID, requesting scope.
+func NewPinAuthorizer(appID string, scope Scope, opts ...*Options) *PinAuthorizer {
+	var opt *Options
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	return &PinAuthorizer{
+		appID:  appID,
+		scope:  scope,
+		api:    opt.apiHost(),
+		client: opt.httpClient(),
+	}
+}
+
+// Challenge requests a new PIN, which should be shown to the user.
+func (a *PinAuthorizer) Challenge(ctx context.Context) (*PinAuthenticationChallenge, error) {
+	q := url.Values{}
+	q.Set("response_type", "ecobeePin")
+	q.Set("client_id", a.appID)
+	q.Set("scope", string(a.scope))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.api.URL(authorizeURL)+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	res, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if (res.StatusCode / 100) != 2 {
+		if r, err := reauthResponseFromHTTPResponse(res); err == nil {
+			if authErr := r.authError(); authErr != nil {
+				return nil, authErr
+			}
+		}
+		return nil, fmt.Errorf("non-ok status response from API: %v %v", res.StatusCode, http.StatusText(res.StatusCode))
+	}
+
+	pac := &PinAuthenticationChallenge{}
+	if err := jsonDecode(res.Body, pac); err != nil {
+		return nil, err
+	}
+	pac.issued = now()
+	return pac, nil
+}
+
+// Wait for the user to enter the PIN from pac, and return the resulting tokens.
+// The token endpoint is polled at the interval requested by the API until the
+// user authorizes the application, the PIN expires, or ctx is done.
+func (a *PinAuthorizer) Wait(ctx context.Context, pac *PinAuthenticationChallenge) (*TokenRefreshResponse, error) {
+	interval := defaultPinPollInterval
+	if pac.Interval > 0 {
+		interval = time.Duration(pac.Interval) * time.Second
+	}
+	var expires time.Time
+	if pac.ExpiresIn > 0 {
+		issued := pac.issued
+		if issued.IsZero() {
+			issued = now()
+		}
+		expires = issued.Add(time.Duration(pac.ExpiresIn) * time.Minute)
+	}
+
+	q := url.Values{}
+	q.Set("grant_type", "ecobeePin")
+	q.Set("code", pac.AuthorizationCode)
+	q.Set("client_id", a.appID)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timeAfter(interval):
+		}
+
+		trr, err := requestToken(ctx, a.client, a.api, q)
+		if err == nil {
+			return trr, nil
+		}
+		switch {
+		case IsAuthorizationError(err, AuthorizationErrorAuthorizationPending):
+		case IsAuthorizationError(err, AuthorizationErrorSlowDown):
+			interval += slowDownIncrement
+		default:
+			return nil, err
+		}
+		if !expires.IsZero() && !now().Before(expires) {
+			return nil, &AuthError{
+				Code:        AuthorizationErrorAuthorizationExpired,
+				Description: "the PIN expired before the application was authorized",
+			}
+		}
+	}
+}
+
+// Authorize runs the whole PIN flow: it requests a challenge, passes it to
+// show so that the PIN can be presented to the user, and waits for the user to
+// authorize the application.
+func (a *PinAuthorizer) Authorize(ctx context.Context, show func(*PinAuthenticationChallenge) error) (*TokenRefreshResponse, error) {
+	pac, err := a.Challenge(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := show(pac); err != nil {
+		return nil, err
+	}
+	return a.Wait(ctx, pac)
+}
+
+// requestToken POSTs params to the token endpoint, and returns the tokens from
+// the response. If the API rejects the request, the error is an *AuthError.
+func requestToken(ctx context.Context, client *http.Client, api apiBaseURL, params url.Values) (*TokenRefreshResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, api.URL(tokenURL)+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, redactURLError(err)
+	}
+	defer res.Body.Close()
+
+	r, err := reauthResponseFromHTTPResponse(res)
+	if err != nil {
+		return nil, err
+	}
+	if r.ok() {
+		return r.Resp, nil
+	}
+	if authErr := r.authError(); authErr != nil {
+		return nil, authErr
+	}
+	return nil, errors.New("token request failed for unknown reasons")
+}
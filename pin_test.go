@@ -0,0 +1,186 @@
+package egobee
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// pinTestServer serves the authorize and token endpoints for the PIN flow.
+// The token endpoint responds with each entry of tokenErrors in turn, and then
+// with tokens.
+type pinTestServer struct {
+	t           *testing.T
+	tokenErrors []AuthorizationError
+	polls       int
+}
+
+func (s *pinTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if got := q.Get("client_id"); got != "appid" {
+		s.t.Errorf(`invalid client_id; got: %q, want: "appid"`, got)
+	}
+	w.Header().Set("Content-Type", requestContentType)
+	switch r.URL.Path {
+	case authorizeURL:
+		if got := q.Get("response_type"); got != "ecobeePin" {
+			s.t.Errorf(`invalid response_type; got: %q, want: "ecobeePin"`, got)
+		}
+		if got := q.Get("scope"); got != "smartRead" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_scope","error_description":"bad scope"}`))
+			return
+		}
+		w.Write([]byte(`{"ecobeePin":"bv29","code":"authcode","scope":"smartRead","expires_in":9,"interval":30}`))
+	case tokenURL:
+		if r.Method != http.MethodPost {
+			s.t.Errorf("invalid method; got: %q, want: %q", r.Method, http.MethodPost)
+		}
+		if got := q.Get("grant_type"); got != "ecobeePin" {
+			s.t.Errorf(`invalid grant_type; got: %q, want: "ecobeePin"`, got)
+		}
+		if got := q.Get("code"); got != "authcode" {
+			s.t.Errorf(`invalid code; got: %q, want: "authcode"`, got)
+		}
+		s.polls++
+		if s.polls <= len(s.tokenErrors) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"` + string(s.tokenErrors[s.polls-1]) + `","error_description":"not yet"}`))
+			return
+		}
+		w.Write([]byte(`{"access_token":"access","token_type":"Bearer","expires_in":3599,"refresh_token":"refresh","scope":"smartRead"}`))
+	default:
+		s.t.Errorf("unexpected request for %v", r.URL.Path)
+	}
+}
+
+func TestPinAuthorizer(t *testing.T) {
+	var waits []time.Duration
+	origTimeAfter := timeAfter
+	timeAfter = func(d time.Duration) <-chan time.Time {
+		waits = append(waits, d)
+		c := make(chan time.Time, 1)
+		c <- time.Now()
+		return c
+	}
+	defer func() { timeAfter = origTimeAfter }()
+
+	pts := &pinTestServer{
+		t: t,
+		tokenErrors: []AuthorizationError{
+			AuthorizationErrorAuthorizationPending,
+			AuthorizationErrorSlowDown,
+			AuthorizationErrorAuthorizationPending,
+		},
+	}
+	s := httptest.NewServer(pts)
+	defer s.Close()
+
+	pa := NewPinAuthorizer("appid", ScopeSmartRead, &Options{APIHost: s.URL})
+	var shown *PinAuthenticationChallenge
+	got, err := pa.Authorize(context.Background(), func(pac *PinAuthenticationChallenge) error {
+		shown = pac
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if shown == nil || shown.Pin != "bv29" || shown.ExpiresIn != 9 || shown.Interval != 30 {
+		t.Errorf("got unexpected challenge: %+v", shown)
+	}
+	want := &TokenRefreshResponse{
+		AccessToken:  "access",
+		TokenType:    "Bearer",
+		ExpiresIn:    TokenDuration{Duration: 3599 * time.Second},
+		RefreshToken: "refresh",
+		Scope:        ScopeSmartRead,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %+v, want: %+v", got, want)
+	}
+	wantWaits := []time.Duration{30 * time.Second, 30 * time.Second, 35 * time.Second, 35 * time.Second}
+	if !reflect.DeepEqual(waits, wantWaits) {
+		t.Errorf("got poll intervals %v, want %v", waits, wantWaits)
+	}
+}
+
+func TestPinAuthorizerChallengeError(t *testing.T) {
+	s := httptest.NewServer(&pinTestServer{t: t})
+	defer s.Close()
+
+	pa := NewPinAuthorizer("appid", ScopeSmartWrite, &Options{APIHost: s.URL})
+	_, err := pa.Challenge(context.Background())
+	if !IsAuthorizationError(err, AuthorizationErrorInvalidScope) {
+		t.Errorf("got error %v, want invalid_scope AuthError", err)
+	}
+}
+
+func TestPinAuthorizerWaitExpires(t *testing.T) {
+	ttime := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	origNow, origTimeAfter := now, timeAfter
+	now = func() time.Time { return ttime }
+	timeAfter = func(d time.Duration) <-chan time.Time {
+		ttime = ttime.Add(d)
+		c := make(chan time.Time, 1)
+		c <- ttime
+		return c
+	}
+	defer func() { now, timeAfter = origNow, origTimeAfter }()
+
+	pending := make([]AuthorizationError, 100)
+	for i := range pending {
+		pending[i] = AuthorizationErrorAuthorizationPending
+	}
+	pts := &pinTestServer{t: t, tokenErrors: pending}
+	s := httptest.NewServer(pts)
+	defer s.Close()
+
+	pa := NewPinAuthorizer("appid", ScopeSmartRead, &Options{APIHost: s.URL})
+	pac, err := pa.Challenge(context.Background())
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	_, err = pa.Wait(context.Background(), pac)
+	if !IsAuthorizationError(err, AuthorizationErrorAuthorizationExpired) {
+		t.Errorf("got error %v, want authorization_expired AuthError", err)
+	}
+	// 9 minutes at 30 second intervals.
+	if pts.polls != 18 {
+		t.Errorf("got %v polls, want 18", pts.polls)
+	}
+}
+
+func TestPinAuthorizerWaitFails(t *testing.T) {
+	origTimeAfter := timeAfter
+	timeAfter = func(d time.Duration) <-chan time.Time {
+		c := make(chan time.Time, 1)
+		c <- time.Now()
+		return c
+	}
+	defer func() { timeAfter = origTimeAfter }()
+
+	pts := &pinTestServer{t: t, tokenErrors: []AuthorizationError{AuthorizationErrorAccessDenied}}
+	s := httptest.NewServer(pts)
+	defer s.Close()
+
+	pa := NewPinAuthorizer("appid", ScopeSmartRead, &Options{APIHost: s.URL})
+	_, err := pa.Wait(context.Background(), &PinAuthenticationChallenge{AuthorizationCode: "authcode"})
+	if !IsAuthorizationError(err, AuthorizationErrorAccessDenied) {
+		t.Errorf("got error %v, want access_denied AuthError", err)
+	}
+}
+
+func TestPinAuthorizerWaitCancelled(t *testing.T) {
+	s := httptest.NewServer(&pinTestServer{t: t})
+	defer s.Close()
+
+	pa := NewPinAuthorizer("appid", ScopeSmartRead, &Options{APIHost: s.URL})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := pa.Wait(ctx, &PinAuthenticationChallenge{AuthorizationCode: "authcode"}); err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
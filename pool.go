@@ -0,0 +1,132 @@
+package egobee
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ClientPool creates a Client for each account in a TokenStoreRegistry when it
+// is first needed, and reuses it thereafter. Every Client is created with the
+// same Options, and so shares their Transport and its connections.
+type ClientPool struct {
+	appID    string
+	registry *TokenStoreRegistry
+	opts     *Options
+
+	mu      sync.Mutex         // protects the following members
+	clients map[string]*Client // by account
+}
+
+// NewClientPool returns a ClientPool of Clients for the application appID,
+// authorized by the tokens in registry.
+func NewClientPool(appID string, registry *TokenStoreRegistry, opts ...*Options) *ClientPool {
+	var opt *Options
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	return &ClientPool{
+		appID:    appID,
+		registry: registry,
+		opts:     opt,
+		clients:  make(map[string]*Client),
+	}
+}
+
+// Client returns the Client for account. It fails with ErrUnknownAccount if the
+// registry has no tokens for the account.
+func (p *ClientPool) Client(account string) (*Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c, ok := p.clients[account]; ok {
+		return c, nil
+	}
+	ts, err := p.registry.Store(account)
+	if err != nil {
+		return nil, err
+	}
+	c := New(p.appID, ts, p.opts)
+	p.clients[account] = c
+	return c, nil
+}
+
+// Put stores tokens for account in the registry, replacing any it already has,
+// and returns its Client. If the pool already has a Client for the account, it
+// is kept and uses the new tokens, so that all requests for the account still
+// share one token refresh.
+func (p *ClientPool) Put(account string, tokens *TokenRefreshResponse) (*Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ts, err := p.registry.Put(account, tokens)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := p.clients[account]; ok {
+		// Its health must not reflect failures with the old tokens.
+		c.auth.clearRefreshError()
+		return c, nil
+	}
+	c := New(p.appID, ts, p.opts)
+	p.clients[account] = c
+	return c, nil
+}
+
+// Accounts returns the sorted names of the accounts in the registry.
+func (p *ClientPool) Accounts() ([]string, error) {
+	return p.registry.Accounts()
+}
+
+// Remove the account's Client from the pool, and its tokens from the registry.
+// The Client must no longer be used.
+func (p *ClientPool) Remove(account string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.clients, account)
+	return p.registry.Remove(account)
+}
+
+// TokenHealth describes the state of an account's tokens.
+type TokenHealth struct {
+	Account string
+	// ValidFor is how much longer the access token is valid, which is negative
+	// once it has expired. An expired access token is refreshed when the
+	// account's Client is next used, so is not a problem in itself.
+	ValidFor time.Duration
+	// Err is why the account's Client is unable to make requests: its tokens
+	// could not be read, there is no refresh token, or the last token refresh
+	// failed. It is nil if the tokens appear usable.
+	Err error
+}
+
+// Health reports the state of the tokens of every account in the registry. An
+// account whose last token refresh failed with AuthorizationErrorInvalidGrant,
+// as reported by IsAuthorizationError, must be authorized by the user again,
+// and its tokens replaced using Put.
+func (p *ClientPool) Health() ([]TokenHealth, error) {
+	accounts, err := p.Accounts()
+	if err != nil {
+		return nil, err
+	}
+	health := make([]TokenHealth, 0, len(accounts))
+	for _, account := range accounts {
+		h := TokenHealth{Account: account}
+		ts, err := p.registry.Store(account)
+		if err != nil {
+			h.Err = err
+			health = append(health, h)
+			continue
+		}
+		h.ValidFor = ts.ValidFor()
+		if ts.RefreshToken() == "" {
+			h.Err = errors.New("no refresh token")
+		}
+		p.mu.Lock()
+		c := p.clients[account]
+		p.mu.Unlock()
+		if c != nil && h.Err == nil {
+			h.Err = c.auth.lastRefreshError()
+		}
+		health = append(health, h)
+	}
+	return health, nil
+}
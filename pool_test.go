@@ -0,0 +1,119 @@
+package egobee_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/cfunkhouser/egobee"
+	"github.com/cfunkhouser/egobee/egobeetest"
+)
+
+// countingTransport counts the requests made through it.
+type countingTransport struct {
+	n int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.n++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestClientPool(t *testing.T) {
+	s := egobeetest.NewServer(testThermostats(1)...)
+	defer s.Close()
+	dir, err := ioutil.TempDir("", "egobee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	registry, err := egobee.NewTokenStoreRegistry(dir)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	for _, account := range []string{"smith", "jones"} {
+		if _, err := registry.Put(account, s.Token(egobee.ScopeSmartWrite)); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+	}
+	trans := &countingTransport{}
+	opts := s.Options()
+	opts.Transport = trans
+	pool := egobee.NewClientPool(s.AppID, registry, opts)
+
+	smith, err := pool.Client("smith")
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if again, err := pool.Client("smith"); err != nil || again != smith {
+		t.Errorf("got client %p, %v, want the cached %p", again, err, smith)
+	}
+	jones, err := pool.Client("jones")
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	for _, c := range []*egobee.Client{smith, jones} {
+		if _, err := c.ThermostatSummary(); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+	}
+	if trans.n != 2 {
+		t.Errorf("got %v requests through the shared transport, want 2", trans.n)
+	}
+	if _, err := pool.Client("brown"); !errors.Is(err, egobee.ErrUnknownAccount) {
+		t.Errorf("got error %v for unknown account, want ErrUnknownAccount", err)
+	}
+
+	// Revoking the tokens makes an account unhealthy once its Client tries to
+	// refresh them.
+	expired := s.Token(egobee.ScopeSmartWrite)
+	expired.ExpiresIn.Duration = 0
+	if _, err := registry.Put("smith", expired); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	s.RevokeTokens()
+	if _, err := smith.ThermostatSummary(); err == nil {
+		t.Fatal("expected error with revoked tokens, got nil")
+	}
+	health, err := pool.Health()
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if len(health) != 2 || health[0].Account != "jones" || health[1].Account != "smith" {
+		t.Fatalf("got health %+v, want jones and smith", health)
+	}
+	if health[0].Err != nil || health[0].ValidFor <= 0 {
+		t.Errorf("got health %+v for jones, which has not refreshed since", health[0])
+	}
+	if !egobee.IsAuthorizationError(health[1].Err, egobee.AuthorizationErrorInvalidGrant) {
+		t.Errorf("got health error %v for smith, want invalid_grant", health[1].Err)
+	}
+
+	// Authorizing again restores it.
+	again, err := pool.Put("smith", s.Token(egobee.ScopeSmartWrite))
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if again != smith {
+		t.Errorf("got client %p from Put, want the existing %p", again, smith)
+	}
+	if health, err = pool.Health(); err != nil || health[1].Err != nil {
+		t.Errorf("got health %+v, %v after authorizing again, want no error", health, err)
+	}
+	if _, err := smith.ThermostatSummary(); err != nil {
+		t.Errorf("got unexpected error from existing client with new tokens: %v", err)
+	}
+	if health, err = pool.Health(); err != nil || health[1].Err != nil {
+		t.Errorf("got health %+v, %v after authorizing again, want no error", health, err)
+	}
+
+	if err := pool.Remove("jones"); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if accounts, err := pool.Accounts(); err != nil || len(accounts) != 1 || accounts[0] != "smith" {
+		t.Errorf("got accounts %v, %v, want only smith", accounts, err)
+	}
+}
@@ -0,0 +1,167 @@
+package egobee
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// ErrUnknownAccount is returned by a TokenStoreRegistry for an account which
+// has no stored tokens.
+var ErrUnknownAccount = errors.New("unknown account")
+
+// accountNameRx matches the names a TokenStoreRegistry accepts, which are safe
+// to use as directory names on every platform.
+var accountNameRx = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@-]*$`)
+
+const (
+	registryDirPermissions = 0700
+	registryTokenFile      = "tokens"
+)
+
+// TokenStoreRegistry persists the tokens of many accounts. Each account's tokens
+// are kept in a file named "tokens", in a directory named for the account
+// under the registry's directory. The files are those of the TokenStorers
+// returned by NewPersistentTokenStore or, if the registry has a key,
+// NewEncryptedTokenStore, and so may be shared with other processes.
+type TokenStoreRegistry struct {
+	dir string
+	key *TokenStoreKey // encrypts every store, if set
+
+	mu     sync.Mutex             // protects the following members
+	stores map[string]TokenStorer // opened so far, by account
+}
+
+// NewTokenStoreRegistry returns a TokenStoreRegistry keeping plaintext tokens
+// in dir, which is created if necessary.
+func NewTokenStoreRegistry(dir string) (*TokenStoreRegistry, error) {
+	return newTokenStoreRegistry(dir, nil)
+}
+
+// NewEncryptedTokenStoreRegistry returns a TokenStoreRegistry keeping tokens in
+// dir encrypted with key. Plaintext stores already in dir are encrypted when
+// they are first opened, as by EncryptTokenStore.
+func NewEncryptedTokenStoreRegistry(dir string, key *TokenStoreKey) (*TokenStoreRegistry, error) {
+	return newTokenStoreRegistry(dir, key)
+}
+
+func newTokenStoreRegistry(dir string, key *TokenStoreKey) (*TokenStoreRegistry, error) {
+	if err := os.MkdirAll(dir, registryDirPermissions); err != nil {
+		return nil, err
+	}
+	return &TokenStoreRegistry{
+		dir:    dir,
+		key:    key,
+		stores: make(map[string]TokenStorer),
+	}, nil
+}
+
+func validateAccount(account string) error {
+	if !accountNameRx.MatchString(account) {
+		return fmt.Errorf("invalid account name %q", account)
+	}
+	return nil
+}
+
+func (r *TokenStoreRegistry) path(account string) string {
+	return filepath.Join(r.dir, account, registryTokenFile)
+}
+
+// Put stores tokens for account, replacing any it already has, such as after
+// the user authorizes the application again. A TokenStorer previously returned
+// for the account is updated, and returned again.
+func (r *TokenStoreRegistry) Put(account string, tokens *TokenRefreshResponse) (TokenStorer, error) {
+	if err := validateAccount(account); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok := r.stores[account]; ok {
+		return s, s.Update(tokens)
+	}
+	if err := os.MkdirAll(filepath.Join(r.dir, account), registryDirPermissions); err != nil {
+		return nil, err
+	}
+	var s TokenStorer
+	var err error
+	if r.key != nil {
+		s, err = NewEncryptedTokenStore(tokens, r.path(account), r.key)
+	} else {
+		s, err = NewPersistentTokenStore(tokens, r.path(account))
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.stores[account] = s
+	return s, nil
+}
+
+// Store returns the TokenStorer for account. The same TokenStorer is returned
+// every time, so that everything using it sees the tokens it refreshes. It
+// fails with ErrUnknownAccount if no tokens have been put for the account.
+func (r *TokenStoreRegistry) Store(account string) (TokenStorer, error) {
+	if err := validateAccount(account); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok := r.stores[account]; ok {
+		return s, nil
+	}
+	path := r.path(account)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAccount, account)
+	}
+	var s TokenStorer
+	var err error
+	if r.key != nil {
+		s, err = EncryptTokenStore(path, r.key)
+	} else {
+		s, err = NewPersistentTokenFromDisk(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.stores[account] = s
+	return s, nil
+}
+
+// Accounts returns the sorted names of the accounts with stored tokens.
+func (r *TokenStoreRegistry) Accounts() ([]string, error) {
+	infos, err := ioutil.ReadDir(r.dir)
+	if err != nil {
+		return nil, err
+	}
+	var accounts []string
+	for _, fi := range infos {
+		if !fi.IsDir() || validateAccount(fi.Name()) != nil {
+			continue
+		}
+		if _, err := os.Stat(r.path(fi.Name())); err == nil {
+			accounts = append(accounts, fi.Name())
+		}
+	}
+	sort.Strings(accounts)
+	return accounts, nil
+}
+
+// Remove the tokens of account. A TokenStorer previously returned for it
+// retains the tokens in memory, but can no longer persist them.
+func (r *TokenStoreRegistry) Remove(account string) error {
+	if err := validateAccount(account); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	dir := filepath.Join(r.dir, account)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return fmt.Errorf("%w: %q", ErrUnknownAccount, account)
+	}
+	delete(r.stores, account)
+	return os.RemoveAll(dir)
+}
@@ -0,0 +1,143 @@
+package egobee
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTokenStoreRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "egobee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewTokenStoreRegistry(filepath.Join(dir, "accounts"))
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if got, err := r.Accounts(); err != nil || len(got) != 0 {
+		t.Errorf("got accounts %v, %v for empty registry, want none", got, err)
+	}
+
+	smith, err := r.Put("smith", &TokenRefreshResponse{AccessToken: "a1", RefreshToken: "r1"})
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if _, err := r.Put("jones@example.com", &TokenRefreshResponse{AccessToken: "a2", RefreshToken: "r2"}); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	// Directories which are not accounts are ignored.
+	if err := os.Mkdir(filepath.Join(dir, "accounts", "empty"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"jones@example.com", "smith"}
+	if got, err := r.Accounts(); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got accounts %v, %v, want %v", got, err, want)
+	}
+
+	if got, err := r.Store("smith"); err != nil || got != smith {
+		t.Errorf("got store %v, %v, want the one returned by Put", got, err)
+	}
+	again, err := r.Put("smith", &TokenRefreshResponse{AccessToken: "a3", RefreshToken: "r3"})
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if again != smith || smith.RefreshToken() != "r3" {
+		t.Errorf("replacing tokens did not update the existing store")
+	}
+
+	// Another registry on the same directory reads the stored tokens.
+	other, err := NewTokenStoreRegistry(filepath.Join(dir, "accounts"))
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if got, err := other.Store("smith"); err != nil || got.RefreshToken() != "r3" {
+		t.Errorf("got store %v, %v from another registry, want refresh token r3", got, err)
+	}
+	if _, err := other.Store("brown"); !errors.Is(err, ErrUnknownAccount) {
+		t.Errorf("got error %v for missing account, want ErrUnknownAccount", err)
+	}
+
+	if err := r.Remove("smith"); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if _, err := r.Store("smith"); !errors.Is(err, ErrUnknownAccount) {
+		t.Errorf("got error %v for removed account, want ErrUnknownAccount", err)
+	}
+	if err := r.Remove("smith"); !errors.Is(err, ErrUnknownAccount) {
+		t.Errorf("got error %v removing account twice, want ErrUnknownAccount", err)
+	}
+	want = []string{"jones@example.com"}
+	if got, err := r.Accounts(); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got accounts %v, %v, want %v", got, err, want)
+	}
+}
+
+func TestTokenStoreRegistryInvalidAccounts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "egobee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	r, err := NewTokenStoreRegistry(dir)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	for _, account := range []string{"", ".", "..", "../escape", "a/b", `a\b`, ".hidden"} {
+		if _, err := r.Put(account, &TokenRefreshResponse{}); err == nil {
+			t.Errorf("%q: expected error from Put, got nil", account)
+		}
+		if _, err := r.Store(account); err == nil {
+			t.Errorf("%q: expected error from Store, got nil", account)
+		}
+		if err := r.Remove(account); err == nil {
+			t.Errorf("%q: expected error from Remove, got nil", account)
+		}
+	}
+}
+
+func TestEncryptedTokenStoreRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "egobee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// An account stored before the registry was encrypted.
+	plain, err := NewTokenStoreRegistry(dir)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if _, err := plain.Put("old", &TokenRefreshResponse{AccessToken: "a1", RefreshToken: "r1"}); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	r, err := NewEncryptedTokenStoreRegistry(dir, mustTokenStoreKey(t, testTokenStoreKey))
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if _, err := r.Put("new", &TokenRefreshResponse{AccessToken: "a2", RefreshToken: "r2"}); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	old, err := r.Store("old")
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if old.RefreshToken() != "r1" {
+		t.Errorf("got refresh token %q, want r1", old.RefreshToken())
+	}
+	for _, account := range []string{"old", "new"} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, account, registryTokenFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isEncryptedStore(b) {
+			t.Errorf("%v: store is not encrypted: %s", account, b)
+		}
+	}
+}
@@ -0,0 +1,517 @@
+package egobee
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits imposed by the runtimeReport API on a single request.
+const (
+	maxRuntimeReportDays        = 31
+	maxRuntimeReportThermostats = 25
+
+	// intervalsPerDay is the number of 5 minute intervals in a day.
+	intervalsPerDay = 288
+)
+
+// Runtime report columns. Equipment columns report the number of seconds the
+// equipment ran during the interval.
+// See https://www.ecobee.com/home/developer/api/documentation/v1/operations/get-runtime-report.shtml
+const (
+	RuntimeColumnAuxHeat1          = "auxHeat1"
+	RuntimeColumnAuxHeat2          = "auxHeat2"
+	RuntimeColumnAuxHeat3          = "auxHeat3"
+	RuntimeColumnCompCool1         = "compCool1"
+	RuntimeColumnCompCool2         = "compCool2"
+	RuntimeColumnCompHeat1         = "compHeat1"
+	RuntimeColumnCompHeat2         = "compHeat2"
+	RuntimeColumnDehumidifier      = "dehumidifier"
+	RuntimeColumnDMOffset          = "dmOffset"
+	RuntimeColumnEconomizer        = "economizer"
+	RuntimeColumnFan               = "fan"
+	RuntimeColumnHumidifier        = "humidifier"
+	RuntimeColumnHVACMode          = "hvacMode"
+	RuntimeColumnOutdoorHumidity   = "outdoorHumidity"
+	RuntimeColumnOutdoorTemp       = "outdoorTemp"
+	RuntimeColumnSky               = "sky"
+	RuntimeColumnVentilator        = "ventilator"
+	RuntimeColumnWind              = "wind"
+	RuntimeColumnZoneAveTemp       = "zoneAveTemp"
+	RuntimeColumnZoneCalendarEvent = "zoneCalendarEvent"
+	RuntimeColumnZoneClimate       = "zoneClimate"
+	RuntimeColumnZoneCoolTemp      = "zoneCoolTemp"
+	RuntimeColumnZoneHeatTemp      = "zoneHeatTemp"
+	RuntimeColumnZoneHumidity      = "zoneHumidity"
+	RuntimeColumnZoneHumidityHigh  = "zoneHumidityHigh"
+	RuntimeColumnZoneHumidityLow   = "zoneHumidityLow"
+	RuntimeColumnZoneHVACMode      = "zoneHvacMode"
+	RuntimeColumnZoneOccupancy     = "zoneOccupancy"
+)
+
+// runtimeColumnKind determines how values in a column are parsed.
+type runtimeColumnKind int
+
+const (
+	runtimeColumnString      runtimeColumnKind = iota // string
+	runtimeColumnInt                                  // int
+	runtimeColumnFloat                                // float64
+	runtimeColumnTemperature                          // Temperature
+)
+
+var runtimeColumnKinds = map[string]runtimeColumnKind{
+	RuntimeColumnAuxHeat1:         runtimeColumnInt,
+	RuntimeColumnAuxHeat2:         runtimeColumnInt,
+	RuntimeColumnAuxHeat3:         runtimeColumnInt,
+	RuntimeColumnCompCool1:        runtimeColumnInt,
+	RuntimeColumnCompCool2:        runtimeColumnInt,
+	RuntimeColumnCompHeat1:        runtimeColumnInt,
+	RuntimeColumnCompHeat2:        runtimeColumnInt,
+	RuntimeColumnDehumidifier:     runtimeColumnInt,
+	RuntimeColumnDMOffset:         runtimeColumnFloat,
+	RuntimeColumnEconomizer:       runtimeColumnInt,
+	RuntimeColumnFan:              runtimeColumnInt,
+	RuntimeColumnHumidifier:       runtimeColumnInt,
+	RuntimeColumnOutdoorHumidity:  runtimeColumnInt,
+	RuntimeColumnOutdoorTemp:      runtimeColumnTemperature,
+	RuntimeColumnSky:              runtimeColumnInt,
+	RuntimeColumnVentilator:       runtimeColumnInt,
+	RuntimeColumnWind:             runtimeColumnInt,
+	RuntimeColumnZoneAveTemp:      runtimeColumnTemperature,
+	RuntimeColumnZoneCoolTemp:     runtimeColumnTemperature,
+	RuntimeColumnZoneHeatTemp:     runtimeColumnTemperature,
+	RuntimeColumnZoneHumidity:     runtimeColumnInt,
+	RuntimeColumnZoneHumidityHigh: runtimeColumnInt,
+	RuntimeColumnZoneHumidityLow:  runtimeColumnInt,
+	RuntimeColumnZoneOccupancy:    runtimeColumnInt,
+}
+
+// sensorColumnKinds maps a sensor's type to the kind of its values in a sensor
+// report.
+var sensorColumnKinds = map[string]runtimeColumnKind{
+	CapabilityTypeTemperature: runtimeColumnTemperature,
+	CapabilityTypeHumidity:    runtimeColumnInt,
+	CapabilityTypeOccupancy:   runtimeColumnInt,
+}
+
+func parseRuntimeValue(kind runtimeColumnKind, v string) (interface{}, error) {
+	switch kind {
+	case runtimeColumnInt:
+		// Some integral columns are reported with a decimal point.
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, err
+		}
+		return int(f), nil
+	case runtimeColumnFloat:
+		return strconv.ParseFloat(v, 64)
+	case runtimeColumnTemperature:
+		// Unlike elsewhere in the API, report temperatures are in degrees
+		// Fahrenheit rather than tenths of a degree.
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, err
+		}
+		return FromFahrenheit(f), nil
+	}
+	return v, nil
+}
+
+// RuntimeReportRequest describes the data requested from Client.RuntimeReport.
+type RuntimeReportRequest struct {
+	// Selection of thermostats for the report. The SelectionType must be
+	// SelectionTypeThermostats.
+	Selection *Selection
+	// StartDate of the report. Only the date is used.
+	StartDate time.Time
+	// StartInterval is the first 5 minute interval of StartDate to include in the
+	// report, from 0 to 287.
+	StartInterval int
+	// EndDate of the report, inclusive. Only the date is used.
+	EndDate time.Time
+	// EndInterval is the last 5 minute interval of EndDate to include in the
+	// report, from 0 to 287. Note that the zero value includes only the first 5
+	// minutes of EndDate; use 287 to include the whole day. If the report
+	// covers a single day, it must not be before StartInterval.
+	EndInterval int
+	// Columns to include in the report, such as RuntimeColumnZoneAveTemp.
+	Columns []string
+	// IncludeSensors adds per-sensor data to the report.
+	IncludeSensors bool
+}
+
+// RuntimeReport is the result of Client.RuntimeReport.
+type RuntimeReport struct {
+	// Columns in the report, in the order requested.
+	Columns []string
+	// Reports for each thermostat in the selection.
+	Reports []*ThermostatRuntimeReport
+	// SensorReports for each thermostat in the selection. Only populated if
+	// sensors were included in the request.
+	SensorReports []*SensorRuntimeReport
+}
+
+// ThermostatRuntimeReport contains the runtime history of one thermostat.
+type ThermostatRuntimeReport struct {
+	ThermostatIdentifier string
+	Rows                 []*RuntimeReportRow
+}
+
+// RuntimeReportRow contains the values from a single 5 minute interval.
+type RuntimeReportRow struct {
+	// Time at which the interval starts, in the thermostat's time zone.
+	Time time.Time
+	// Values keyed by column, or by sensor ID in a sensor report. Temperatures
+	// are Temperature, RuntimeColumnDMOffset is a float64 differential in
+	// degrees Fahrenheit, runtimes and other numeric values are int, and
+	// everything else is a string. Columns without data for the interval are
+	// absent.
+	Values map[string]interface{}
+}
+
+// Float64 returns the value of column, if it is present and a float64.
+func (r *RuntimeReportRow) Float64(column string) (float64, bool) {
+	v, ok := r.Values[column].(float64)
+	return v, ok
+}
+
+// Temperature returns the value of column, if it is present and a Temperature.
+func (r *RuntimeReportRow) Temperature(column string) (Temperature, bool) {
+	v, ok := r.Values[column].(Temperature)
+	return v, ok
+}
+
+// Int returns the value of column, if it is present and an int.
+func (r *RuntimeReportRow) Int(column string) (int, bool) {
+	v, ok := r.Values[column].(int)
+	return v, ok
+}
+
+// String returns the value of column, if it is present and a string.
+func (r *RuntimeReportRow) String(column string) (string, bool) {
+	v, ok := r.Values[column].(string)
+	return v, ok
+}
+
+// RuntimeSensor describes a sensor included in a SensorRuntimeReport.
+type RuntimeSensor struct {
+	SensorID    string `json:"sensorId"`
+	SensorName  string `json:"sensorName"`
+	SensorType  string `json:"sensorType"`
+	SensorUsage string `json:"sensorUsage"`
+}
+
+// SensorRuntimeReport contains the history of every sensor attached to one
+// thermostat. Row Values are keyed by RuntimeSensor.SensorID.
+type SensorRuntimeReport struct {
+	ThermostatIdentifier string
+	Sensors              []RuntimeSensor
+	Rows                 []*RuntimeReportRow
+}
+
+// runtimeReportRequestBody is serialized into the body parameter of a request
+// to the runtimeReport API.
+type runtimeReportRequestBody struct {
+	StartDate      string    `json:"startDate"`
+	StartInterval  int       `json:"startInterval"`
+	EndDate        string    `json:"endDate"`
+	EndInterval    int       `json:"endInterval"`
+	Columns        string    `json:"columns"`
+	IncludeSensors bool      `json:"includeSensors,omitempty"`
+	Selection      Selection `json:"selection"`
+}
+
+// See https://www.ecobee.com/home/developer/api/documentation/v1/operations/get-runtime-report.shtml
+type runtimeReportResponse struct {
+	Columns    string `json:"columns"`
+	ReportList []struct {
+		ThermostatIdentifier string   `json:"thermostatIdentifier"`
+		RowCount             int      `json:"rowCount"`
+		RowList              []string `json:"rowList"`
+	} `json:"reportList"`
+	SensorList []struct {
+		ThermostatIdentifier string          `json:"thermostatIdentifier"`
+		Sensors              []RuntimeSensor `json:"sensors"`
+		Columns              []string        `json:"columns"`
+		Data                 []string        `json:"data"`
+	} `json:"sensorList"`
+	Status Status `json:"status"`
+}
+
+func assembleRuntimeReportRequest(apiURL string, body *runtimeReportRequestBody) (*http.Request, error) {
+	b, err := jsonMarshal(body)
+	if err != nil {
+		return nil, err
+	}
+	u := fmt.Sprintf("%v?format=json&body=%v", apiURL, url.QueryEscape(string(b)))
+	r, err := httpNewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	r.Header.Add("Content-Type", requestContentType)
+	return r, nil
+}
+
+// runtimeReportWindow is a range of intervals small enough to be requested at
+// once.
+type runtimeReportWindow struct {
+	startDate, endDate         time.Time
+	startInterval, endInterval int
+}
+
+// splitRuntimeReportWindows splits the range of the request into windows of
+// at most maxRuntimeReportDays days.
+func splitRuntimeReportWindows(r *RuntimeReportRequest) []runtimeReportWindow {
+	start := truncateToDate(r.StartDate)
+	end := truncateToDate(r.EndDate)
+	var windows []runtimeReportWindow
+	for !start.After(end) {
+		w := runtimeReportWindow{
+			startDate:     start,
+			startInterval: 0,
+			endDate:       start.AddDate(0, 0, maxRuntimeReportDays-1),
+			endInterval:   intervalsPerDay - 1,
+		}
+		if len(windows) == 0 {
+			w.startInterval = r.StartInterval
+		}
+		if !w.endDate.Before(end) {
+			w.endDate = end
+			w.endInterval = r.EndInterval
+		}
+		windows = append(windows, w)
+		start = w.endDate.AddDate(0, 0, 1)
+	}
+	return windows
+}
+
+func truncateToDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// splitSelectionMatch splits the thermostat identifiers in the selection into
+// groups of at most max identifiers.
+func splitSelectionMatch(s *Selection, max int) [][]string {
+	var ids []string
+	for _, id := range strings.Split(s.SelectionMatch, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	var groups [][]string
+	for len(ids) > max {
+		groups = append(groups, ids[:max])
+		ids = ids[max:]
+	}
+	if len(ids) > 0 {
+		groups = append(groups, ids)
+	}
+	return groups
+}
+
+// RuntimeReport retrieves the runtime history of the thermostats selected by
+// req. Requests exceeding the API's limits of 31 days or 25 thermostats are
+// split into several requests, and the results merged.
+// See https://www.ecobee.com/home/developer/api/documentation/v1/operations/get-runtime-report.shtml
+func (c *Client) RuntimeReport(req *RuntimeReportRequest) (*RuntimeReport, error) {
+	return c.RuntimeReportContext(context.Background(), req)
+}
+
+// RuntimeReportContext behaves like RuntimeReport, but every request is bound
+// to ctx.
+func (c *Client) RuntimeReportContext(ctx context.Context, req *RuntimeReportRequest) (*RuntimeReport, error) {
+	if req.Selection == nil || req.Selection.SelectionType != SelectionTypeThermostats {
+		return nil, errors.New("runtime reports require a selection of type thermostats")
+	}
+	if len(req.Columns) == 0 {
+		return nil, errors.New("runtime reports require at least one column")
+	}
+	if req.EndDate.Before(req.StartDate) {
+		return nil, errors.New("runtime report ends before it starts")
+	}
+	for _, i := range []int{req.StartInterval, req.EndInterval} {
+		if i < 0 || i >= intervalsPerDay {
+			return nil, fmt.Errorf("runtime report interval %v is not between 0 and %v", i, intervalsPerDay-1)
+		}
+	}
+	if truncateToDate(req.StartDate).Equal(truncateToDate(req.EndDate)) && req.EndInterval < req.StartInterval {
+		return nil, errors.New("runtime report ends before it starts")
+	}
+	groups := splitSelectionMatch(req.Selection, maxRuntimeReportThermostats)
+	if len(groups) == 0 {
+		return nil, errors.New("runtime report requires thermostat identifiers in SelectionMatch")
+	}
+
+	kinds := make([]runtimeColumnKind, len(req.Columns))
+	for i, col := range req.Columns {
+		kinds[i] = runtimeColumnKinds[col]
+	}
+	report := &RuntimeReport{Columns: req.Columns}
+	thermostatReports := make(map[string]*ThermostatRuntimeReport)
+	sensorReports := make(map[string]*SensorRuntimeReport)
+	for _, ids := range groups {
+		sel := Selection{
+			SelectionType:  SelectionTypeThermostats,
+			SelectionMatch: strings.Join(ids, ","),
+		}
+		locations, err := c.thermostatLocations(ctx, &sel)
+		if err != nil {
+			return nil, err
+		}
+		for _, w := range splitRuntimeReportWindows(req) {
+			rrr, err := c.runtimeReportWindow(ctx, &runtimeReportRequestBody{
+				StartDate:      w.startDate.Format(dateFormat),
+				StartInterval:  w.startInterval,
+				EndDate:        w.endDate.Format(dateFormat),
+				EndInterval:    w.endInterval,
+				Columns:        strings.Join(req.Columns, ","),
+				IncludeSensors: req.IncludeSensors,
+				Selection:      sel,
+			})
+			if err != nil {
+				return nil, err
+			}
+			for _, rl := range rrr.ReportList {
+				tr, ok := thermostatReports[rl.ThermostatIdentifier]
+				if !ok {
+					tr = &ThermostatRuntimeReport{ThermostatIdentifier: rl.ThermostatIdentifier}
+					thermostatReports[rl.ThermostatIdentifier] = tr
+					report.Reports = append(report.Reports, tr)
+				}
+				rows, err := parseRuntimeRows(rl.RowList, req.Columns, kinds, locations[rl.ThermostatIdentifier])
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse runtime report for %v: %v", rl.ThermostatIdentifier, err)
+				}
+				tr.Rows = append(tr.Rows, rows...)
+			}
+			for _, sl := range rrr.SensorList {
+				sr, ok := sensorReports[sl.ThermostatIdentifier]
+				if !ok {
+					sr = &SensorRuntimeReport{
+						ThermostatIdentifier: sl.ThermostatIdentifier,
+						Sensors:              sl.Sensors,
+					}
+					sensorReports[sl.ThermostatIdentifier] = sr
+					report.SensorReports = append(report.SensorReports, sr)
+				}
+				rows, err := parseSensorRows(sl.Data, sl.Columns, sl.Sensors, locations[sl.ThermostatIdentifier])
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse sensor report for %v: %v", sl.ThermostatIdentifier, err)
+				}
+				sr.Rows = append(sr.Rows, rows...)
+			}
+		}
+	}
+	return report, nil
+}
+
+// runtimeReportWindow requests a single window of a runtime report.
+func (c *Client) runtimeReportWindow(ctx context.Context, body *runtimeReportRequestBody) (*runtimeReportResponse, error) {
+	req, err := assembleRuntimeReportRequest(c.api.URL(runtimeReportURL), body)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if err := validateSelectionResponse(res); err != nil {
+		return nil, err
+	}
+
+	rrr := &runtimeReportResponse{}
+	if err := jsonDecode(res.Body, rrr); err != nil {
+		return nil, err
+	}
+	if err := rrr.Status.err(res.StatusCode); err != nil {
+		return nil, err
+	}
+	return rrr, nil
+}
+
+// thermostatLocations returns the time zone of each selected thermostat, keyed
+// by identifier.
+func (c *Client) thermostatLocations(ctx context.Context, selection *Selection) (map[string]*time.Location, error) {
+	sel := *selection
+	sel.IncludeLocation = true
+	thermostats, err := c.ThermostatsContext(ctx, &sel)
+	if err != nil {
+		return nil, err
+	}
+	locations := make(map[string]*time.Location)
+	for _, t := range thermostats {
+		locations[t.Identifier] = t.Location.timeLocation()
+	}
+	return locations, nil
+}
+
+// parseRuntimeRow splits a row of a runtime report into its time and the
+// remaining fields.
+func parseRuntimeRow(row string, loc *time.Location) (time.Time, []string, error) {
+	fields := strings.Split(row, ",")
+	if len(fields) < 2 {
+		return time.Time{}, nil, fmt.Errorf("malformed row %q", row)
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	t, err := time.ParseInLocation(dateTimeFormat, fields[0]+" "+fields[1], loc)
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	return t, fields[2:], nil
+}
+
+func parseRuntimeRows(rows, columns []string, kinds []runtimeColumnKind, loc *time.Location) ([]*RuntimeReportRow, error) {
+	var parsed []*RuntimeReportRow
+	for _, row := range rows {
+		t, fields, err := parseRuntimeRow(row, loc)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) != len(columns) {
+			return nil, fmt.Errorf("row %q has %v values, want %v", row, len(fields), len(columns))
+		}
+		r := &RuntimeReportRow{
+			Time:   t,
+			Values: make(map[string]interface{}),
+		}
+		for i, f := range fields {
+			if f == "" {
+				continue
+			}
+			v, err := parseRuntimeValue(kinds[i], f)
+			if err != nil {
+				return nil, fmt.Errorf("bad value for %v in row %q: %v", columns[i], row, err)
+			}
+			r.Values[columns[i]] = v
+		}
+		parsed = append(parsed, r)
+	}
+	return parsed, nil
+}
+
+func parseSensorRows(rows, columns []string, sensors []RuntimeSensor, loc *time.Location) ([]*RuntimeReportRow, error) {
+	// The first two columns of a sensor report are always date and time.
+	if len(columns) < 2 {
+		return nil, fmt.Errorf("malformed sensor columns %q", columns)
+	}
+	columns = columns[2:]
+	types := make(map[string]string)
+	for _, s := range sensors {
+		types[s.SensorID] = s.SensorType
+	}
+	kinds := make([]runtimeColumnKind, len(columns))
+	for i, col := range columns {
+		kinds[i] = sensorColumnKinds[types[col]]
+	}
+	return parseRuntimeRows(rows, columns, kinds, loc)
+}
@@ -0,0 +1,333 @@
+package egobee
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitRuntimeReportWindows(t *testing.T) {
+	date := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	}
+	for _, tt := range []struct {
+		name string
+		req  *RuntimeReportRequest
+		want []runtimeReportWindow
+	}{
+		{
+			name: "single day",
+			req: &RuntimeReportRequest{
+				StartDate:     date(2019, 1, 1),
+				StartInterval: 12,
+				EndDate:       date(2019, 1, 1),
+				EndInterval:   24,
+			},
+			want: []runtimeReportWindow{
+				{date(2019, 1, 1), date(2019, 1, 1), 12, 24},
+			},
+		},
+		{
+			name: "exactly 31 days",
+			req: &RuntimeReportRequest{
+				StartDate:   date(2019, 1, 1),
+				EndDate:     date(2019, 1, 31),
+				EndInterval: 287,
+			},
+			want: []runtimeReportWindow{
+				{date(2019, 1, 1), date(2019, 1, 31), 0, 287},
+			},
+		},
+		{
+			name: "several windows",
+			req: &RuntimeReportRequest{
+				StartDate:     date(2019, 1, 1),
+				StartInterval: 100,
+				EndDate:       date(2019, 3, 5),
+				EndInterval:   200,
+			},
+			want: []runtimeReportWindow{
+				{date(2019, 1, 1), date(2019, 1, 31), 100, 287},
+				{date(2019, 2, 1), date(2019, 3, 3), 0, 287},
+				{date(2019, 3, 4), date(2019, 3, 5), 0, 200},
+			},
+		},
+	} {
+		if got := splitRuntimeReportWindows(tt.req); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: got: %+v, want: %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSplitSelectionMatch(t *testing.T) {
+	var ids []string
+	for i := 0; i < 60; i++ {
+		ids = append(ids, fmt.Sprintf("%03d", i))
+	}
+	got := splitSelectionMatch(&Selection{SelectionMatch: strings.Join(ids, ",")}, 25)
+	want := [][]string{ids[:25], ids[25:50], ids[50:]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+	if got := splitSelectionMatch(&Selection{SelectionMatch: ""}, 25); got != nil {
+		t.Errorf("got: %v, want: nil", got)
+	}
+}
+
+// runtimeReportTestHandler serves thermostat locations and runtime reports with
+// one row per requested day.
+func runtimeReportTestHandler(t *testing.T, bodies *[]runtimeReportRequestBody) http.HandlerFunc {
+	t.Helper()
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", requestContentType)
+		switch r.URL.Path {
+		case thermostatURL:
+			ss := &summarySelection{}
+			if err := json.Unmarshal([]byte(r.URL.Query().Get("json")), ss); err != nil {
+				t.Errorf("failed to decode selection: %v", err)
+			}
+			if !ss.Selection.IncludeLocation {
+				t.Error("location not included in thermostat selection")
+			}
+			ptr := &pagedThermostatResponse{}
+			for _, id := range strings.Split(ss.Selection.SelectionMatch, ",") {
+				ptr.Thermostats = append(ptr.Thermostats, &Thermostat{
+					Identifier: id,
+					Location:   Location{TimeZone: "America/Toronto", TimeZoneOffsetMinutes: -300},
+				})
+			}
+			json.NewEncoder(w).Encode(ptr)
+		case runtimeReportURL:
+			if got := r.URL.Query().Get("format"); got != "json" {
+				t.Errorf(`invalid format; got: %q, want: "json"`, got)
+			}
+			body := runtimeReportRequestBody{}
+			if err := json.Unmarshal([]byte(r.URL.Query().Get("body")), &body); err != nil {
+				t.Errorf("failed to decode body: %v", err)
+			}
+			*bodies = append(*bodies, body)
+			start, _ := time.Parse(dateFormat, body.StartDate)
+			end, _ := time.Parse(dateFormat, body.EndDate)
+			rrr := &runtimeReportResponse{Columns: body.Columns}
+			for _, id := range strings.Split(body.Selection.SelectionMatch, ",") {
+				var rows, data []string
+				for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+					rows = append(rows, d.Format(dateFormat)+",00:00:00,heat,70.3,,300")
+					data = append(data, d.Format(dateFormat)+",00:00:00,68.5,1")
+				}
+				rrr.ReportList = append(rrr.ReportList, struct {
+					ThermostatIdentifier string   `json:"thermostatIdentifier"`
+					RowCount             int      `json:"rowCount"`
+					RowList              []string `json:"rowList"`
+				}{id, len(rows), rows})
+				if body.IncludeSensors {
+					rrr.SensorList = append(rrr.SensorList, struct {
+						ThermostatIdentifier string          `json:"thermostatIdentifier"`
+						Sensors              []RuntimeSensor `json:"sensors"`
+						Columns              []string        `json:"columns"`
+						Data                 []string        `json:"data"`
+					}{
+						ThermostatIdentifier: id,
+						Sensors: []RuntimeSensor{
+							{SensorID: "rs_100:1", SensorName: "Bedroom", SensorType: "temperature", SensorUsage: "monitor"},
+							{SensorID: "rs_100:2", SensorName: "Bedroom", SensorType: "occupancy", SensorUsage: "monitor"},
+						},
+						Columns: []string{"date", "time", "rs_100:1", "rs_100:2"},
+						Data:    data,
+					})
+				}
+			}
+			json.NewEncoder(w).Encode(rrr)
+		default:
+			t.Errorf("unexpected request for %v", r.URL.Path)
+		}
+	}
+}
+
+func TestClientRuntimeReport(t *testing.T) {
+	var bodies []runtimeReportRequestBody
+	s := httptest.NewServer(runtimeReportTestHandler(t, &bodies))
+	defer s.Close()
+	client := &Client{api: apiBaseURL(s.URL)}
+
+	got, err := client.RuntimeReport(&RuntimeReportRequest{
+		Selection: &Selection{
+			SelectionType:  SelectionTypeThermostats,
+			SelectionMatch: "123",
+		},
+		StartDate:      time.Date(2019, 1, 15, 0, 0, 0, 0, time.UTC),
+		EndDate:        time.Date(2019, 2, 16, 0, 0, 0, 0, time.UTC),
+		EndInterval:    287,
+		Columns:        []string{RuntimeColumnHVACMode, RuntimeColumnZoneAveTemp, RuntimeColumnOutdoorTemp, RuntimeColumnFan},
+		IncludeSensors: true,
+	})
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if len(bodies) != 2 {
+		t.Fatalf("got %v requests, want 2", len(bodies))
+	}
+	if bodies[0].EndDate != "2019-02-14" || bodies[1].StartDate != "2019-02-15" {
+		t.Errorf("unexpected windows requested: %+v", bodies)
+	}
+	if !bodies[0].IncludeSensors || bodies[0].Columns != "hvacMode,zoneAveTemp,outdoorTemp,fan" {
+		t.Errorf("unexpected request body: %+v", bodies[0])
+	}
+
+	if len(got.Reports) != 1 {
+		t.Fatalf("got %v reports, want 1", len(got.Reports))
+	}
+	rows := got.Reports[0].Rows
+	if len(rows) != 33 {
+		t.Fatalf("got %v rows, want 33", len(rows))
+	}
+	toronto, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		t.Fatalf("failed to load time zone: %v", err)
+	}
+	want := &RuntimeReportRow{
+		Time: time.Date(2019, 2, 16, 0, 0, 0, 0, toronto),
+		Values: map[string]interface{}{
+			RuntimeColumnHVACMode:    "heat",
+			RuntimeColumnZoneAveTemp: Temperature(703),
+			RuntimeColumnFan:         300,
+		},
+	}
+	if last := rows[len(rows)-1]; !last.Time.Equal(want.Time) || !reflect.DeepEqual(last.Values, want.Values) {
+		t.Errorf("got last row: %+v, want: %+v", last, want)
+	}
+	if v, ok := rows[0].Temperature(RuntimeColumnZoneAveTemp); !ok || v != 703 {
+		t.Errorf("got zoneAveTemp %v, %v, want 70.3°F, true", v, ok)
+	}
+	if _, ok := rows[0].Temperature(RuntimeColumnOutdoorTemp); ok {
+		t.Error("got outdoorTemp for row without data")
+	}
+
+	if len(got.SensorReports) != 1 {
+		t.Fatalf("got %v sensor reports, want 1", len(got.SensorReports))
+	}
+	sr := got.SensorReports[0]
+	if len(sr.Sensors) != 2 || len(sr.Rows) != 33 {
+		t.Fatalf("got %v sensors and %v rows, want 2 and 33", len(sr.Sensors), len(sr.Rows))
+	}
+	wantValues := map[string]interface{}{"rs_100:1": Temperature(685), "rs_100:2": 1}
+	if !reflect.DeepEqual(sr.Rows[0].Values, wantValues) {
+		t.Errorf("got sensor values %v, want %v", sr.Rows[0].Values, wantValues)
+	}
+}
+
+func TestClientRuntimeReportManyThermostats(t *testing.T) {
+	var bodies []runtimeReportRequestBody
+	s := httptest.NewServer(runtimeReportTestHandler(t, &bodies))
+	defer s.Close()
+	client := &Client{api: apiBaseURL(s.URL)}
+
+	var ids []string
+	for i := 0; i < 30; i++ {
+		ids = append(ids, fmt.Sprintf("%v", 1000+i))
+	}
+	day := time.Date(2019, 1, 15, 0, 0, 0, 0, time.UTC)
+	got, err := client.RuntimeReport(&RuntimeReportRequest{
+		Selection: &Selection{
+			SelectionType:  SelectionTypeThermostats,
+			SelectionMatch: strings.Join(ids, ","),
+		},
+		StartDate:   day,
+		EndDate:     day,
+		EndInterval: 287,
+		Columns:     []string{RuntimeColumnHVACMode, RuntimeColumnZoneAveTemp, RuntimeColumnOutdoorTemp, RuntimeColumnFan},
+	})
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if len(bodies) != 2 {
+		t.Fatalf("got %v requests, want 2", len(bodies))
+	}
+	if n := len(strings.Split(bodies[0].Selection.SelectionMatch, ",")); n != 25 {
+		t.Errorf("got %v thermostats in first request, want 25", n)
+	}
+	if len(got.Reports) != 30 {
+		t.Errorf("got %v reports, want 30", len(got.Reports))
+	}
+	if len(got.SensorReports) != 0 {
+		t.Errorf("got %v sensor reports, want 0", len(got.SensorReports))
+	}
+}
+
+func TestClientRuntimeReportInvalidRequests(t *testing.T) {
+	client := &Client{}
+	day := time.Date(2019, 1, 15, 0, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		name string
+		req  *RuntimeReportRequest
+	}{
+		{"no selection", &RuntimeReportRequest{Columns: []string{"fan"}}},
+		{"registered selection", &RuntimeReportRequest{Selection: &Selection{SelectionType: SelectionTypeRegistered}, Columns: []string{"fan"}}},
+		{"no columns", &RuntimeReportRequest{Selection: &Selection{SelectionType: SelectionTypeThermostats}}},
+		{"backwards", &RuntimeReportRequest{Selection: &Selection{SelectionType: SelectionTypeThermostats}, Columns: []string{"fan"}, StartDate: day, EndDate: day.AddDate(0, 0, -1)}},
+		{"no identifiers", &RuntimeReportRequest{Selection: &Selection{SelectionType: SelectionTypeThermostats}, Columns: []string{"fan"}, StartDate: day, EndDate: day}},
+		{"blank identifiers", &RuntimeReportRequest{Selection: &Selection{SelectionType: SelectionTypeThermostats, SelectionMatch: " , "}, Columns: []string{"fan"}, StartDate: day, EndDate: day}},
+	} {
+		if _, err := client.RuntimeReport(tt.req); err == nil {
+			t.Errorf("%v: expected error, got nil", tt.name)
+		}
+	}
+}
+
+func TestClientRuntimeReportInvalidIntervals(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("got unexpected request for %v", r.URL.Path)
+		http.Error(w, "nope", http.StatusInternalServerError)
+	}))
+	defer s.Close()
+	client := &Client{api: apiBaseURL(s.URL)}
+	day := time.Date(2019, 1, 15, 0, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		name                       string
+		startInterval, endInterval int
+		days                       int
+	}{
+		{"negative start", -1, 287, 0},
+		{"start too large", 288, 287, 1},
+		{"negative end", 0, -1, 1},
+		{"end too large", 0, 288, 1},
+		{"backwards on one day", 100, 99, 0},
+	} {
+		_, err := client.RuntimeReport(&RuntimeReportRequest{
+			Selection:     &Selection{SelectionType: SelectionTypeThermostats, SelectionMatch: "1"},
+			Columns:       []string{"fan"},
+			StartDate:     day,
+			StartInterval: tt.startInterval,
+			EndDate:       day.AddDate(0, 0, tt.days),
+			EndInterval:   tt.endInterval,
+		})
+		if err == nil {
+			t.Errorf("%v: expected error, got nil", tt.name)
+		}
+	}
+}
+
+func TestLocationTimeLocation(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		loc        Location
+		wantName   string
+		wantOffset int
+	}{
+		{"named zone", Location{TimeZone: "America/Toronto", TimeZoneOffsetMinutes: -300}, "America/Toronto", -5 * 3600},
+		{"unknown zone", Location{TimeZone: "Nowhere/Special", TimeZoneOffsetMinutes: 90}, "Nowhere/Special", 90 * 60},
+	} {
+		got := tt.loc.timeLocation()
+		if got.String() != tt.wantName {
+			t.Errorf("%v: got zone %q, want %q", tt.name, got, tt.wantName)
+		}
+		if _, offset := time.Date(2019, 1, 15, 0, 0, 0, 0, got).Zone(); offset != tt.wantOffset {
+			t.Errorf("%v: got offset %v, want %v", tt.name, offset, tt.wantOffset)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package egobee
+
+import (
+	"fmt"
+	"time"
+)
+
+// Dimensions of a Program's Schedule.
+const (
+	// SlotsPerDay is the number of slots in each day of a Schedule.
+	SlotsPerDay = 48
+	// SlotDuration is the length of each slot in a Schedule.
+	SlotDuration = 24 * time.Hour / SlotsPerDay
+
+	daysPerWeek = 7
+)
+
+// Commonly scheduled sets of days.
+var (
+	Weekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	Weekend  = []time.Weekday{time.Saturday, time.Sunday}
+	EveryDay = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday}
+)
+
+// scheduleDay returns the index of w in a Program's Schedule, whose weeks start
+// on Monday.
+func scheduleDay(w time.Weekday) int {
+	return (int(w) + 6) % daysPerWeek
+}
+
+// Schedule is an editable view of a Program, which resolves each half hour slot
+// of the week to the Climate which is active during it. Times are in the
+// thermostat's local time; see Thermostat.TimeZone.
+type Schedule struct {
+	slots             [daysPerWeek][SlotsPerDay]string // climateRefs, Monday first
+	climates          []Climate
+	currentClimateRef string
+}
+
+// NewSchedule from a Program, as returned for a Thermostat when the Selection
+// includes the program. The Program is copied, so editing the Schedule does not
+// modify it.
+func NewSchedule(p *Program) (*Schedule, error) {
+	if len(p.Schedule) != daysPerWeek {
+		return nil, fmt.Errorf("schedule has %v days, want %v", len(p.Schedule), daysPerWeek)
+	}
+	s := &Schedule{
+		climates:          append([]Climate(nil), p.Climates...),
+		currentClimateRef: p.CurrentClimateRef,
+	}
+	for d, day := range p.Schedule {
+		if len(day) != SlotsPerDay {
+			return nil, fmt.Errorf("schedule day %v has %v slots, want %v", d, len(day), SlotsPerDay)
+		}
+		copy(s.slots[d][:], day)
+	}
+	return s, nil
+}
+
+// Climate with the climateRef ref, or nil if there is none.
+func (s *Schedule) Climate(ref string) *Climate {
+	for i := range s.climates {
+		if s.climates[i].ClimateRef == ref {
+			return &s.climates[i]
+		}
+	}
+	return nil
+}
+
+// Slot returns the Climate scheduled for the half hour slot of day, from 0 at
+// midnight to SlotsPerDay-1. It is nil if the slot is out of range or refers to
+// an unknown climate.
+func (s *Schedule) Slot(day time.Weekday, slot int) *Climate {
+	if day < time.Sunday || day > time.Saturday || slot < 0 || slot >= SlotsPerDay {
+		return nil
+	}
+	return s.Climate(s.slots[scheduleDay(day)][slot])
+}
+
+// slotOf returns the day and slot containing t.
+func slotOf(t time.Time) (time.Weekday, int) {
+	return t.Weekday(), t.Hour()*2 + t.Minute()/30
+}
+
+// ClimateAt returns the Climate scheduled at t. t must be in the thermostat's
+// time zone. Holds and other Events, which override the schedule, are not
+// considered.
+func (s *Schedule) ClimateAt(t time.Time) *Climate {
+	return s.Slot(slotOf(t))
+}
+
+// NextTransition returns the first time after t at which the scheduled climate
+// changes, and the Climate which becomes active then. t must be in the
+// thermostat's time zone. If the same climate is scheduled for the entire week,
+// ok is false.
+func (s *Schedule) NextTransition(t time.Time) (at time.Time, c *Climate, ok bool) {
+	day, slot := slotOf(t)
+	current := s.slots[scheduleDay(day)][slot]
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	for i := 1; i <= daysPerWeek*SlotsPerDay; i++ {
+		n := slot + i
+		d := time.Weekday((int(day) + n/SlotsPerDay) % daysPerWeek)
+		ref := s.slots[scheduleDay(d)][n%SlotsPerDay]
+		if ref == current {
+			continue
+		}
+		// Compute the wall clock time of the slot, rather than adding durations,
+		// so that daylight saving changes are handled.
+		date := midnight.AddDate(0, 0, n/SlotsPerDay)
+		minutes := (n % SlotsPerDay) * 30
+		at = time.Date(date.Year(), date.Month(), date.Day(), minutes/60, minutes%60, 0, 0, t.Location())
+		return at, s.Climate(ref), true
+	}
+	return time.Time{}, nil, false
+}
+
+// Set the climate with climateRef ref for the slots of each of days from start
+// until end, which are offsets from midnight. For example, to be at home on
+// weekday mornings:
+//
+//	s.Set(egobee.Weekdays, 7*time.Hour, 9*time.Hour, "home")
+//
+// start and end must be multiples of SlotDuration, and end may be 24 hours to
+// set the remainder of the day.
+func (s *Schedule) Set(days []time.Weekday, start, end time.Duration, ref string) error {
+	if start%SlotDuration != 0 || end%SlotDuration != 0 {
+		return fmt.Errorf("schedule times %v and %v must be multiples of %v", start, end, SlotDuration)
+	}
+	if start < 0 || end > 24*time.Hour || start >= end {
+		return fmt.Errorf("invalid schedule range %v to %v", start, end)
+	}
+	if s.Climate(ref) == nil {
+		return fmt.Errorf("unknown climate %q", ref)
+	}
+	for _, day := range days {
+		if day < time.Sunday || day > time.Saturday {
+			return fmt.Errorf("invalid day %v", day)
+		}
+	}
+	for _, day := range days {
+		for slot := int(start / SlotDuration); slot < int(end/SlotDuration); slot++ {
+			s.slots[scheduleDay(day)][slot] = ref
+		}
+	}
+	return nil
+}
+
+// Validate that every slot refers to a Climate of the Schedule.
+func (s *Schedule) Validate() error {
+	for d := range s.slots {
+		for slot, ref := range s.slots[d] {
+			if s.Climate(ref) == nil {
+				day := time.Weekday((d + 1) % daysPerWeek)
+				return fmt.Errorf("%v %02d:%02d refers to unknown climate %q", day, slot/2, slot%2*30, ref)
+			}
+		}
+	}
+	return nil
+}
+
+// Program returns the Schedule as a Program, suitable for updating the
+// thermostat. It returns an error if the Schedule is not valid.
+func (s *Schedule) Program() (*Program, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	p := &Program{
+		Schedule:          make([][]string, daysPerWeek),
+		Climates:          append([]Climate(nil), s.climates...),
+		CurrentClimateRef: s.currentClimateRef,
+	}
+	for d := range s.slots {
+		p.Schedule[d] = append([]string(nil), s.slots[d][:]...)
+	}
+	return p, nil
+}
@@ -0,0 +1,219 @@
+package egobee
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testProgram returns a Program in which every day is "sleep" until 06:30,
+// "home" until 08:00, "away" until 17:30, "home" until 22:00, and "sleep"
+// after, except on weekends which are "home" from 06:30 until 22:00.
+func testProgram() *Program {
+	p := &Program{
+		Climates: []Climate{
+			{Name: "Home", ClimateRef: "home", HeatTemp: 700},
+			{Name: "Away", ClimateRef: "away", HeatTemp: 620},
+			{Name: "Sleep", ClimateRef: "sleep", HeatTemp: 660},
+		},
+		CurrentClimateRef: "home",
+	}
+	for d := 0; d < 7; d++ {
+		var day []string
+		for slot := 0; slot < SlotsPerDay; slot++ {
+			ref := "home"
+			switch {
+			case slot < 13 || slot >= 44:
+				ref = "sleep"
+			case d < 5 && slot >= 16 && slot < 35:
+				ref = "away"
+			}
+			day = append(day, ref)
+		}
+		p.Schedule = append(p.Schedule, day)
+	}
+	return p
+}
+
+func TestNewSchedule(t *testing.T) {
+	if _, err := NewSchedule(testProgram()); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	p := testProgram()
+	p.Schedule = p.Schedule[:6]
+	if _, err := NewSchedule(p); err == nil {
+		t.Error("expected error for 6 day schedule, got nil")
+	}
+	p = testProgram()
+	p.Schedule[3] = p.Schedule[3][:47]
+	if _, err := NewSchedule(p); err == nil {
+		t.Error("expected error for short day, got nil")
+	}
+}
+
+func TestScheduleClimateAt(t *testing.T) {
+	s, err := NewSchedule(testProgram())
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	for _, tt := range []struct {
+		at   time.Time
+		want string
+	}{
+		// 2019-07-01 is a Monday.
+		{time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC), "sleep"},
+		{time.Date(2019, 7, 1, 6, 29, 59, 0, time.UTC), "sleep"},
+		{time.Date(2019, 7, 1, 6, 30, 0, 0, time.UTC), "home"},
+		{time.Date(2019, 7, 1, 12, 0, 0, 0, time.UTC), "away"},
+		{time.Date(2019, 7, 5, 17, 29, 0, 0, time.UTC), "away"},
+		{time.Date(2019, 7, 5, 17, 30, 0, 0, time.UTC), "home"},
+		{time.Date(2019, 7, 6, 12, 0, 0, 0, time.UTC), "home"},
+		{time.Date(2019, 7, 7, 23, 59, 59, 0, time.UTC), "sleep"},
+	} {
+		if got := s.ClimateAt(tt.at); got == nil || got.ClimateRef != tt.want {
+			t.Errorf("ClimateAt(%v): got %+v, want %q", tt.at, got, tt.want)
+		}
+	}
+	if got := s.Slot(time.Monday, SlotsPerDay); got != nil {
+		t.Errorf("got %+v for out of range slot, want nil", got)
+	}
+}
+
+func TestScheduleNextTransition(t *testing.T) {
+	s, err := NewSchedule(testProgram())
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	toronto, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		t.Fatalf("failed to load time zone: %v", err)
+	}
+	for _, tt := range []struct {
+		from    time.Time
+		wantAt  time.Time
+		wantRef string
+	}{
+		{
+			from:    time.Date(2019, 7, 1, 7, 0, 0, 0, toronto),
+			wantAt:  time.Date(2019, 7, 1, 8, 0, 0, 0, toronto),
+			wantRef: "away",
+		},
+		{
+			from:    time.Date(2019, 7, 1, 22, 10, 0, 0, toronto),
+			wantAt:  time.Date(2019, 7, 2, 6, 30, 0, 0, toronto),
+			wantRef: "home",
+		},
+		{
+			// Saturday 06:30 wakes into home, not away, so the next change is
+			// at bedtime.
+			from:    time.Date(2019, 7, 6, 7, 0, 0, 0, toronto),
+			wantAt:  time.Date(2019, 7, 6, 22, 0, 0, 0, toronto),
+			wantRef: "sleep",
+		},
+		{
+			// Daylight saving time began during the night.
+			from:    time.Date(2019, 3, 9, 23, 0, 0, 0, toronto),
+			wantAt:  time.Date(2019, 3, 10, 6, 30, 0, 0, toronto),
+			wantRef: "home",
+		},
+	} {
+		at, c, ok := s.NextTransition(tt.from)
+		if !ok || !at.Equal(tt.wantAt) || c == nil || c.ClimateRef != tt.wantRef {
+			t.Errorf("NextTransition(%v): got %v, %+v, %v; want %v, %q", tt.from, at, c, ok, tt.wantAt, tt.wantRef)
+		}
+	}
+
+	if err := s.Set(EveryDay, 0, 24*time.Hour, "home"); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if _, _, ok := s.NextTransition(time.Date(2019, 7, 1, 7, 0, 0, 0, toronto)); ok {
+		t.Error("got a transition for a constant schedule")
+	}
+}
+
+func TestScheduleSet(t *testing.T) {
+	s, err := NewSchedule(testProgram())
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if err := s.Set(Weekdays, 7*time.Hour, 9*time.Hour, "home"); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	for _, tt := range []struct {
+		day  time.Weekday
+		slot int
+		want string
+	}{
+		{time.Monday, 13, "home"},
+		{time.Monday, 17, "home"},
+		{time.Monday, 18, "away"},
+		{time.Friday, 17, "home"},
+		{time.Friday, 18, "away"},
+	} {
+		if got := s.Slot(tt.day, tt.slot); got.ClimateRef != tt.want {
+			t.Errorf("Slot(%v, %v): got %q, want %q", tt.day, tt.slot, got.ClimateRef, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		name       string
+		days       []time.Weekday
+		start, end time.Duration
+		ref        string
+	}{
+		{"unknown climate", Weekend, 0, time.Hour, "vacation"},
+		{"unaligned", Weekend, 0, 45 * time.Minute, "home"},
+		{"backwards", Weekend, 2 * time.Hour, time.Hour, "home"},
+		{"past midnight", Weekend, 23 * time.Hour, 25 * time.Hour, "home"},
+		{"bad day", []time.Weekday{7}, 0, time.Hour, "home"},
+	} {
+		if err := s.Set(tt.days, tt.start, tt.end, tt.ref); err == nil {
+			t.Errorf("%v: expected error, got nil", tt.name)
+		}
+	}
+}
+
+func TestScheduleProgram(t *testing.T) {
+	orig := testProgram()
+	s, err := NewSchedule(orig)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	p, err := s.Program()
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(p, orig) {
+		t.Errorf("unedited schedule changed;\ngot: %+v\nwant: %+v", p, orig)
+	}
+
+	if err := s.Set([]time.Weekday{time.Sunday}, 22*time.Hour, 24*time.Hour, "home"); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	p, err = s.Program()
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	// Sunday is the last day of the serialized schedule.
+	if got := p.Schedule[6][47]; got != "home" {
+		t.Errorf("got Sunday 23:30 %q, want home", got)
+	}
+	if got := orig.Schedule[6][47]; got != "sleep" {
+		t.Errorf("editing the schedule modified the original program")
+	}
+	if _, err := json.Marshal(p); err != nil {
+		t.Errorf("failed to marshal program: %v", err)
+	}
+
+	bad := testProgram()
+	bad.Schedule[2][10] = "vacation"
+	s, err = NewSchedule(bad)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if _, err := s.Program(); err == nil || err.Error() != `Wednesday 05:00 refers to unknown climate "vacation"` {
+		t.Errorf("got error %v for unknown climate", err)
+	}
+}
@@ -0,0 +1,138 @@
+package egobee
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ThermostatRevision is a parsed entry of ThermostatSummary.RevisionList. Each
+// revision changes when the corresponding part of the thermostat's data does,
+// so comparing revisions between polls tells whether a full request is needed.
+// See https://www.ecobee.com/home/developer/api/documentation/v1/operations/get-thermostat-summary.shtml
+type ThermostatRevision struct {
+	Identifier string
+	Name       string
+	Connected  bool
+	// ThermostatRev changes when the program, settings or other configuration
+	// change.
+	ThermostatRev string
+	// AlertsRev changes when alerts are added or acknowledged.
+	AlertsRev string
+	// RuntimeRev changes when the thermostat reports new runtime data, about
+	// every 3 minutes while it is connected.
+	RuntimeRev string
+	// IntervalRev changes when the thermostat reports a new 15 minute runtime
+	// interval.
+	IntervalRev string
+}
+
+// ParseThermostatRevision parses an entry of ThermostatSummary.RevisionList, of
+// the form identifier:name:connected:thermostatRev:alertsRev:runtimeRev:intervalRev.
+func ParseThermostatRevision(s string) (*ThermostatRevision, error) {
+	fields := strings.Split(s, ":")
+	if len(fields) < 7 {
+		return nil, fmt.Errorf("malformed thermostat revision %q", s)
+	}
+	// The name is the only field which may itself contain a colon.
+	n := len(fields)
+	connected, err := strconv.ParseBool(fields[n-5])
+	if err != nil {
+		return nil, fmt.Errorf("malformed thermostat revision %q: %v", s, err)
+	}
+	return &ThermostatRevision{
+		Identifier:    fields[0],
+		Name:          strings.Join(fields[1:n-5], ":"),
+		Connected:     connected,
+		ThermostatRev: fields[n-4],
+		AlertsRev:     fields[n-3],
+		RuntimeRev:    fields[n-2],
+		IntervalRev:   fields[n-1],
+	}, nil
+}
+
+// Equipment which may be controlled by a thermostat.
+type Equipment string
+
+// Possible Equipment, as reported in equipment status.
+var (
+	EquipmentHeatPump     Equipment = "heatPump"
+	EquipmentHeatPump2    Equipment = "heatPump2"
+	EquipmentHeatPump3    Equipment = "heatPump3"
+	EquipmentCompCool1    Equipment = "compCool1"
+	EquipmentCompCool2    Equipment = "compCool2"
+	EquipmentAuxHeat1     Equipment = "auxHeat1"
+	EquipmentAuxHeat2     Equipment = "auxHeat2"
+	EquipmentAuxHeat3     Equipment = "auxHeat3"
+	EquipmentFan          Equipment = "fan"
+	EquipmentHumidifier   Equipment = "humidifier"
+	EquipmentDehumidifier Equipment = "dehumidifier"
+	EquipmentVentilator   Equipment = "ventilator"
+	EquipmentEconomizer   Equipment = "economizer"
+	EquipmentCompHotWater Equipment = "compHotWater"
+	EquipmentAuxHotWater  Equipment = "auxHotWater"
+)
+
+// ParseEquipment parses a comma separated list of running equipment, such as
+// Thermostat.EquipmentStatus, into a set.
+func ParseEquipment(s string) map[Equipment]bool {
+	running := make(map[Equipment]bool)
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			running[Equipment(e)] = true
+		}
+	}
+	return running
+}
+
+// EquipmentStatus is a parsed entry of ThermostatSummary.StatusList.
+type EquipmentStatus struct {
+	Identifier string
+	// Running is the set of equipment which is currently running.
+	Running map[Equipment]bool
+}
+
+// IsRunning reports whether the equipment is currently running.
+func (s *EquipmentStatus) IsRunning(e Equipment) bool {
+	return s.Running[e]
+}
+
+// ParseEquipmentStatus parses an entry of ThermostatSummary.StatusList, of the
+// form identifier:equipment,equipment,...
+func ParseEquipmentStatus(s string) (*EquipmentStatus, error) {
+	i := strings.Index(s, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("malformed equipment status %q", s)
+	}
+	return &EquipmentStatus{
+		Identifier: s[:i],
+		Running:    ParseEquipment(s[i+1:]),
+	}, nil
+}
+
+// Revisions parses the RevisionList of the ThermostatSummary.
+func (s *ThermostatSummary) Revisions() ([]*ThermostatRevision, error) {
+	revisions := make([]*ThermostatRevision, 0, len(s.RevisionList))
+	for _, r := range s.RevisionList {
+		rev, err := ParseThermostatRevision(r)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, nil
+}
+
+// EquipmentStatuses parses the StatusList of the ThermostatSummary. It is only
+// populated if the summary was requested with IncludeEquipmentStatus.
+func (s *ThermostatSummary) EquipmentStatuses() ([]*EquipmentStatus, error) {
+	statuses := make([]*EquipmentStatus, 0, len(s.StatusList))
+	for _, e := range s.StatusList {
+		status, err := ParseEquipmentStatus(e)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
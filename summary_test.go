@@ -0,0 +1,171 @@
+package egobee
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseThermostatRevision(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		in      string
+		want    *ThermostatRevision
+		wantErr bool
+	}{
+		{
+			name: "from the documentation",
+			in:   "123456789101:MyStat:true:071223012334:080102000000:080102000000:080102000000",
+			want: &ThermostatRevision{
+				Identifier:    "123456789101",
+				Name:          "MyStat",
+				Connected:     true,
+				ThermostatRev: "071223012334",
+				AlertsRev:     "080102000000",
+				RuntimeRev:    "080102000000",
+				IntervalRev:   "080102000000",
+			},
+		},
+		{
+			name: "name with a colon",
+			in:   "123456789101:Upstairs: Hall:false:1:2:3:4",
+			want: &ThermostatRevision{
+				Identifier:    "123456789101",
+				Name:          "Upstairs: Hall",
+				Connected:     false,
+				ThermostatRev: "1",
+				AlertsRev:     "2",
+				RuntimeRev:    "3",
+				IntervalRev:   "4",
+			},
+		},
+		{
+			name:    "too few fields",
+			in:      "123456789101:MyStat:true:1:2:3",
+			wantErr: true,
+		},
+		{
+			name:    "bad connected",
+			in:      "123456789101:MyStat:maybe:1:2:3:4",
+			wantErr: true,
+		},
+	} {
+		got, err := ParseThermostatRevision(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: got error %v, want error: %v", tt.name, err, tt.wantErr)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: got: %+v, want: %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseEquipmentStatus(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		in      string
+		want    *EquipmentStatus
+		wantErr bool
+	}{
+		{
+			name: "running equipment",
+			in:   "123456789101:heatPump,fan",
+			want: &EquipmentStatus{
+				Identifier: "123456789101",
+				Running:    map[Equipment]bool{EquipmentHeatPump: true, EquipmentFan: true},
+			},
+		},
+		{
+			name: "idle",
+			in:   "123456789101:",
+			want: &EquipmentStatus{
+				Identifier: "123456789101",
+				Running:    map[Equipment]bool{},
+			},
+		},
+		{
+			name:    "no separator",
+			in:      "123456789101",
+			wantErr: true,
+		},
+	} {
+		got, err := ParseEquipmentStatus(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: got error %v, want error: %v", tt.name, err, tt.wantErr)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: got: %+v, want: %+v", tt.name, got, tt.want)
+		}
+	}
+	s, _ := ParseEquipmentStatus("123456789101:compCool1")
+	if !s.IsRunning(EquipmentCompCool1) || s.IsRunning(EquipmentAuxHeat1) {
+		t.Errorf("IsRunning reported wrong equipment for %+v", s)
+	}
+}
+
+func TestThermostatSummaryParsing(t *testing.T) {
+	ts := &ThermostatSummary{
+		RevisionList: []string{
+			"1:One:true:a:b:c:d",
+			"2:Two:false:e:f:g:h",
+		},
+		StatusList: []string{
+			"1:fan",
+			"2:",
+		},
+	}
+	revs, err := ts.Revisions()
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if len(revs) != 2 || revs[0].Name != "One" || revs[1].RuntimeRev != "g" {
+		t.Errorf("got unexpected revisions: %+v", revs)
+	}
+	statuses, err := ts.EquipmentStatuses()
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if len(statuses) != 2 || !statuses[0].IsRunning(EquipmentFan) || len(statuses[1].Running) != 0 {
+		t.Errorf("got unexpected statuses: %+v", statuses)
+	}
+
+	ts.RevisionList = append(ts.RevisionList, "garbage")
+	if _, err := ts.Revisions(); err == nil {
+		t.Error("expected error for malformed revision, got nil")
+	}
+	ts.StatusList = append(ts.StatusList, "garbage")
+	if _, err := ts.EquipmentStatuses(); err == nil {
+		t.Error("expected error for malformed status, got nil")
+	}
+}
+
+func TestClientThermostatSummaryWithSelection(t *testing.T) {
+	var got Selection
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ss := &summarySelection{}
+		if err := json.Unmarshal([]byte(r.URL.Query().Get("json")), ss); err != nil {
+			t.Errorf("failed to decode selection: %v", err)
+		}
+		got = ss.Selection
+		w.Write([]byte(`{"revisionList":["1:One:true:a:b:c:d"],"thermostatCount":1,"status":{"code":0}}`))
+	}))
+	defer s.Close()
+	client := &Client{api: apiBaseURL(s.URL)}
+
+	want := Selection{
+		SelectionType:  SelectionTypeThermostats,
+		SelectionMatch: "1",
+	}
+	ts, err := client.ThermostatSummaryWithSelection(&want)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got selection %+v, want %+v", got, want)
+	}
+	if ts.ThermostatCount != 1 {
+		t.Errorf("got ThermostatCount %v, want 1", ts.ThermostatCount)
+	}
+}
@@ -0,0 +1,77 @@
+package egobee
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Temperature as encoded by the ecobee API, in tenths of a degree Fahrenheit.
+// A Temperature of 715 is 71.5°F. Use FromFahrenheit and FromCelsius to
+// construct one from a conventional reading, and Fahrenheit and Celsius to
+// convert it back.
+//
+// Temperature is only suitable for absolute temperatures. Differentials, such
+// as Settings.HeatCoolMinDelta, remain plain ints in tenths of a degree.
+type Temperature int
+
+// FromFahrenheit returns the Temperature f degrees Fahrenheit, rounded to the
+// nearest tenth of a degree.
+func FromFahrenheit(f float64) Temperature {
+	return Temperature(math.Round(f * 10))
+}
+
+// FromCelsius returns the Temperature c degrees Celsius, rounded to the nearest
+// tenth of a degree Fahrenheit.
+func FromCelsius(c float64) Temperature {
+	return FromFahrenheit(c*9/5 + 32)
+}
+
+// Fahrenheit returns t in degrees Fahrenheit.
+func (t Temperature) Fahrenheit() float64 {
+	return float64(t) / 10
+}
+
+// Celsius returns t in degrees Celsius.
+func (t Temperature) Celsius() float64 {
+	return (t.Fahrenheit() - 32) * 5 / 9
+}
+
+// String returns t in degrees Fahrenheit, for example "71.5°F".
+func (t Temperature) String() string {
+	return strconv.FormatFloat(t.Fahrenheit(), 'f', -1, 64) + "°F"
+}
+
+// MarshalJSON encodes t in tenths of a degree Fahrenheit, as expected by the
+// API.
+func (t Temperature) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Itoa(int(t))), nil
+}
+
+// UnmarshalJSON decodes a Temperature in tenths of a degree Fahrenheit. The API
+// is inconsistent about quoting numbers, so both 715 and "715" are accepted.
+func (t *Temperature) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("malformed temperature %s: %v", b, err)
+	}
+	v, err := parseTemperature(string(n))
+	if err != nil {
+		return err
+	}
+	*t = v
+	return nil
+}
+
+// parseTemperature parses a temperature in tenths of a degree Fahrenheit.
+func parseTemperature(s string) (Temperature, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("malformed temperature %q: %v", s, err)
+	}
+	return Temperature(math.Round(v)), nil
+}
@@ -0,0 +1,110 @@
+package egobee
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestTemperatureConversions(t *testing.T) {
+	for _, tt := range []struct {
+		temp       Temperature
+		fahrenheit float64
+		celsius    float64
+		str        string
+	}{
+		{720, 72, 22.2222, "72°F"},
+		{715, 71.5, 21.9444, "71.5°F"},
+		{320, 32, 0, "32°F"},
+		{0, 0, -17.7778, "0°F"},
+		{-400, -40, -40, "-40°F"},
+	} {
+		if got := tt.temp.Fahrenheit(); got != tt.fahrenheit {
+			t.Errorf("Temperature(%d).Fahrenheit(): got %v, want %v", tt.temp, got, tt.fahrenheit)
+		}
+		if got := tt.temp.Celsius(); math.Abs(got-tt.celsius) > 0.0001 {
+			t.Errorf("Temperature(%d).Celsius(): got %v, want %v", tt.temp, got, tt.celsius)
+		}
+		if got := tt.temp.String(); got != tt.str {
+			t.Errorf("Temperature(%d).String(): got %q, want %q", tt.temp, got, tt.str)
+		}
+	}
+}
+
+func TestTemperatureConstructors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		got  Temperature
+		want Temperature
+	}{
+		{"FromFahrenheit(72)", FromFahrenheit(72), 720},
+		{"FromFahrenheit(71.55)", FromFahrenheit(71.55), 716},
+		{"FromFahrenheit(-40)", FromFahrenheit(-40), -400},
+		{"FromCelsius(21)", FromCelsius(21), 698},
+		{"FromCelsius(0)", FromCelsius(0), 320},
+		{"FromCelsius(-40)", FromCelsius(-40), -400},
+		{"FromCelsius(22.5)", FromCelsius(22.5), 725},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%v: got %d, want %d", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestTemperatureJSON(t *testing.T) {
+	for _, tt := range []struct {
+		in      string
+		want    Temperature
+		wantErr bool
+	}{
+		{in: `715`, want: 715},
+		{in: `"715"`, want: 715},
+		{in: `-50`, want: -50},
+		{in: `null`, want: 0},
+		{in: `"unknown"`, wantErr: true},
+		{in: `true`, wantErr: true},
+	} {
+		var got Temperature
+		err := json.Unmarshal([]byte(tt.in), &got)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Unmarshal(%v): got error %v, want error: %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Unmarshal(%v): got %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	b, err := json.Marshal(&Runtime{ActualTemperature: FromCelsius(21)})
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	r := &Runtime{}
+	if err := json.Unmarshal(b, r); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if r.ActualTemperature != 698 {
+		t.Errorf("round trip: got %d, want 698", r.ActualTemperature)
+	}
+}
+
+func TestRemoteSensorTemperature(t *testing.T) {
+	s := &RemoteSensor{
+		Name: "Bedroom",
+		Capability: []RemoteSensorCapability{
+			{Type: CapabilityTypeTemperature, Value: "689"},
+		},
+	}
+	got, err := s.Temperature()
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if got != 689 {
+		t.Errorf("got %d, want 689", got)
+	}
+
+	s.Capability[0].Value = "unknown"
+	if _, err := s.Temperature(); err == nil {
+		t.Error("expected error for unknown temperature, got nil")
+	}
+}
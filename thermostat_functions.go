@@ -0,0 +1,229 @@
+package egobee
+
+// This file contains the thermostat Functions defined by the ecobee v1 API.
+// Functions are sent to the API with Client.UpdateThermostats.
+// See https://www.ecobee.com/home/developer/api/documentation/v1/functions/using-functions.shtml
+
+// Function to be performed on the thermostats matching a Selection. Functions
+// should be created using the constructors in this file, such as SetHold.
+type Function struct {
+	Type   string      `json:"type"`
+	Params interface{} `json:"params,omitempty"`
+}
+
+// HoldType determines how long a hold remains in effect.
+type HoldType string
+
+// Possible HoldTypes.
+var (
+	HoldTypeDateTime       HoldType = "dateTime"
+	HoldTypeNextTransition HoldType = "nextTransition"
+	HoldTypeIndefinite     HoldType = "indefinite"
+	HoldTypeHoldHours      HoldType = "holdHours"
+)
+
+// SetHoldParams are the parameters for the setHold function. Dates are
+// formatted as YYYY-MM-DD and times as HH:MM:SS, in thermostat local time.
+// See https://www.ecobee.com/home/developer/api/documentation/v1/functions/SetHold.shtml
+type SetHoldParams struct {
+	CoolHoldTemp   Temperature `json:"coolHoldTemp,omitempty"`
+	HeatHoldTemp   Temperature `json:"heatHoldTemp,omitempty"`
+	HoldClimateRef string      `json:"holdClimateRef,omitempty"`
+	StartDate      string      `json:"startDate,omitempty"`
+	StartTime      string      `json:"startTime,omitempty"`
+	EndDate        string      `json:"endDate,omitempty"`
+	EndTime        string      `json:"endTime,omitempty"`
+	HoldType       HoldType    `json:"holdType,omitempty"`
+	HoldHours      int         `json:"holdHours,omitempty"`
+	Fan            string      `json:"fan,omitempty"`
+}
+
+// SetHold creates a setHold Function, which sets the thermostat into a
+// temperature or climate hold.
+func SetHold(p SetHoldParams) Function {
+	return Function{Type: "setHold", Params: &p}
+}
+
+// ResumeProgramParams are the parameters for the resumeProgram function.
+// See https://www.ecobee.com/home/developer/api/documentation/v1/functions/ResumeProgram.shtml
+type ResumeProgramParams struct {
+	ResumeAll bool `json:"resumeAll"`
+}
+
+// ResumeProgram creates a resumeProgram Function, which removes the currently
+// running event. If resumeAll is true, all events are removed and the
+// thermostat returns to its program.
+func ResumeProgram(resumeAll bool) Function {
+	return Function{Type: "resumeProgram", Params: &ResumeProgramParams{ResumeAll: resumeAll}}
+}
+
+// SendMessageParams are the parameters for the sendMessage function.
+// See https://www.ecobee.com/home/developer/api/documentation/v1/functions/SendMessage.shtml
+type SendMessageParams struct {
+	Text string `json:"text"`
+}
+
+// SendMessage creates a sendMessage Function, which displays an alert with text
+// on the thermostat. The text may be at most 500 characters.
+func SendMessage(text string) Function {
+	return Function{Type: "sendMessage", Params: &SendMessageParams{Text: text}}
+}
+
+// AcknowledgeType is the response to an Alert.
+type AcknowledgeType string
+
+// Possible AcknowledgeTypes.
+var (
+	AcknowledgeTypeAccept         AcknowledgeType = "accept"
+	AcknowledgeTypeDecline        AcknowledgeType = "decline"
+	AcknowledgeTypeDefer          AcknowledgeType = "defer"
+	AcknowledgeTypeUnacknowledged AcknowledgeType = "unacknowledged"
+)
+
+// AcknowledgeParams are the parameters for the acknowledge function.
+// See https://www.ecobee.com/home/developer/api/documentation/v1/functions/Acknowledge.shtml
+type AcknowledgeParams struct {
+	ThermostatIdentifier string          `json:"thermostatIdentifier"`
+	AckRef               string          `json:"ackRef"`
+	AckType              AcknowledgeType `json:"ackType"`
+	RemindMeLater        bool            `json:"remindMeLater,omitempty"`
+}
+
+// Acknowledge creates an acknowledge Function, which responds to the Alert
+// with the acknowledgeRef ackRef on the thermostat identified by thermostatID.
+func Acknowledge(thermostatID, ackRef string, ackType AcknowledgeType, remindMeLater bool) Function {
+	return Function{Type: "acknowledge", Params: &AcknowledgeParams{
+		ThermostatIdentifier: thermostatID,
+		AckRef:               ackRef,
+		AckType:              ackType,
+		RemindMeLater:        remindMeLater,
+	}}
+}
+
+// CreateVacationParams are the parameters for the createVacation function.
+// Dates are formatted as YYYY-MM-DD and times as HH:MM:SS, in thermostat local
+// time.
+// See https://www.ecobee.com/home/developer/api/documentation/v1/functions/CreateVacation.shtml
+type CreateVacationParams struct {
+	Name         string      `json:"name"`
+	CoolHoldTemp Temperature `json:"coolHoldTemp"`
+	HeatHoldTemp Temperature `json:"heatHoldTemp"`
+	StartDate    string      `json:"startDate,omitempty"`
+	StartTime    string      `json:"startTime,omitempty"`
+	EndDate      string      `json:"endDate,omitempty"`
+	EndTime      string      `json:"endTime,omitempty"`
+	Fan          string      `json:"fan,omitempty"`
+	FanMinOnTime string      `json:"fanMinOnTime,omitempty"`
+}
+
+// CreateVacation creates a createVacation Function, which adds a vacation
+// event to the thermostat.
+func CreateVacation(p CreateVacationParams) Function {
+	return Function{Type: "createVacation", Params: &p}
+}
+
+// DeleteVacationParams are the parameters for the deleteVacation function.
+// See https://www.ecobee.com/home/developer/api/documentation/v1/functions/DeleteVacation.shtml
+type DeleteVacationParams struct {
+	Name string `json:"name"`
+}
+
+// DeleteVacation creates a deleteVacation Function, which removes the vacation
+// event with the given name from the thermostat.
+func DeleteVacation(name string) Function {
+	return Function{Type: "deleteVacation", Params: &DeleteVacationParams{Name: name}}
+}
+
+// ResetPreferences creates a resetPreferences Function, which sets all of the
+// user configurable settings back to the factory default values. This function
+// call will not only reset the top level thermostat settings such as hvacMode,
+// but will also reset the user configurable settings in every other object.
+// See https://www.ecobee.com/home/developer/api/documentation/v1/functions/ResetPreferences.shtml
+func ResetPreferences() Function {
+	return Function{Type: "resetPreferences"}
+}
+
+// SetOccupiedParams are the parameters for the setOccupied function. This
+// function is only available to EMS thermostats.
+// See https://www.ecobee.com/home/developer/api/documentation/v1/functions/SetOccupied.shtml
+type SetOccupiedParams struct {
+	Occupied  bool     `json:"occupied"`
+	StartDate string   `json:"startDate,omitempty"`
+	StartTime string   `json:"startTime,omitempty"`
+	EndDate   string   `json:"endDate,omitempty"`
+	EndTime   string   `json:"endTime,omitempty"`
+	HoldType  HoldType `json:"holdType,omitempty"`
+	HoldHours int      `json:"holdHours,omitempty"`
+}
+
+// SetOccupied creates a setOccupied Function, which switches an EMS thermostat
+// between occupied and unoccupied modes.
+func SetOccupied(p SetOccupiedParams) Function {
+	return Function{Type: "setOccupied", Params: &p}
+}
+
+// UpdateSensorParams are the parameters for the updateSensor function.
+// See https://www.ecobee.com/home/developer/api/documentation/v1/functions/UpdateSensor.shtml
+type UpdateSensorParams struct {
+	Name     string `json:"name"`
+	DeviceID string `json:"deviceId"`
+	SensorID string `json:"sensorId"`
+}
+
+// UpdateSensor creates an updateSensor Function, which renames the remote
+// sensor identified by deviceID and sensorID. A RemoteSensor's ID has the form
+// "deviceID:sensorID".
+func UpdateSensor(name, deviceID, sensorID string) Function {
+	return Function{Type: "updateSensor", Params: &UpdateSensorParams{
+		Name:     name,
+		DeviceID: deviceID,
+		SensorID: sensorID,
+	}}
+}
+
+// PlugState is the desired state of a smart plug.
+type PlugState string
+
+// Possible PlugStates.
+var (
+	PlugStateOn     PlugState = "on"
+	PlugStateOff    PlugState = "off"
+	PlugStateResume PlugState = "resume"
+)
+
+// ControlPlugParams are the parameters for the controlPlug function.
+// See https://www.ecobee.com/home/developer/api/documentation/v1/functions/ControlPlug.shtml
+type ControlPlugParams struct {
+	PlugName  string    `json:"plugName"`
+	PlugState PlugState `json:"plugState"`
+	StartDate string    `json:"startDate,omitempty"`
+	StartTime string    `json:"startTime,omitempty"`
+	EndDate   string    `json:"endDate,omitempty"`
+	EndTime   string    `json:"endTime,omitempty"`
+	HoldType  HoldType  `json:"holdType,omitempty"`
+	HoldHours int       `json:"holdHours,omitempty"`
+}
+
+// ControlPlug creates a controlPlug Function, which controls the on/off state
+// of a smart plug attached to the thermostat.
+func ControlPlug(p ControlPlugParams) Function {
+	return Function{Type: "controlPlug", Params: &p}
+}
+
+// UpdateClimateParams are the parameters for the updateClimate function, which
+// is not documented by ecobee. Only the non-empty fields are changed on the
+// Climate identified by ClimateRef.
+type UpdateClimateParams struct {
+	ClimateRef string      `json:"climateRef"`
+	Name       string      `json:"name,omitempty"`
+	CoolTemp   Temperature `json:"coolTemp,omitempty"`
+	HeatTemp   Temperature `json:"heatTemp,omitempty"`
+	CoolFan    string      `json:"coolFan,omitempty"`
+	HeatFan    string      `json:"heatFan,omitempty"`
+}
+
+// UpdateClimate creates an updateClimate Function, which modifies a Climate in
+// the thermostat's Program.
+func UpdateClimate(p UpdateClimateParams) Function {
+	return Function{Type: "updateClimate", Params: &p}
+}
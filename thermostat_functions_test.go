@@ -0,0 +1,100 @@
+package egobee
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFunctionsMarshalJSON(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		fn   Function
+		want string
+	}{
+		{
+			name: "setHold",
+			fn: SetHold(SetHoldParams{
+				CoolHoldTemp: 760,
+				HeatHoldTemp: 680,
+				HoldType:     HoldTypeNextTransition,
+			}),
+			want: `{"type":"setHold","params":{"coolHoldTemp":760,"heatHoldTemp":680,"holdType":"nextTransition"}}`,
+		},
+		{
+			name: "setHold with climate",
+			fn: SetHold(SetHoldParams{
+				HoldClimateRef: "away",
+				HoldType:       HoldTypeHoldHours,
+				HoldHours:      2,
+			}),
+			want: `{"type":"setHold","params":{"holdClimateRef":"away","holdType":"holdHours","holdHours":2}}`,
+		},
+		{
+			name: "resumeProgram",
+			fn:   ResumeProgram(false),
+			want: `{"type":"resumeProgram","params":{"resumeAll":false}}`,
+		},
+		{
+			name: "sendMessage",
+			fn:   SendMessage("Hello, World!"),
+			want: `{"type":"sendMessage","params":{"text":"Hello, World!"}}`,
+		},
+		{
+			name: "acknowledge",
+			fn:   Acknowledge("123456789012", "abc", AcknowledgeTypeAccept, false),
+			want: `{"type":"acknowledge","params":{"thermostatIdentifier":"123456789012","ackRef":"abc","ackType":"accept"}}`,
+		},
+		{
+			name: "createVacation",
+			fn: CreateVacation(CreateVacationParams{
+				Name:         "Skiing",
+				CoolHoldTemp: 800,
+				HeatHoldTemp: 600,
+				StartDate:    "2019-03-01",
+				StartTime:    "08:00:00",
+				EndDate:      "2019-03-08",
+				EndTime:      "17:00:00",
+			}),
+			want: `{"type":"createVacation","params":{"name":"Skiing","coolHoldTemp":800,"heatHoldTemp":600,"startDate":"2019-03-01","startTime":"08:00:00","endDate":"2019-03-08","endTime":"17:00:00"}}`,
+		},
+		{
+			name: "deleteVacation",
+			fn:   DeleteVacation("Skiing"),
+			want: `{"type":"deleteVacation","params":{"name":"Skiing"}}`,
+		},
+		{
+			name: "resetPreferences",
+			fn:   ResetPreferences(),
+			want: `{"type":"resetPreferences"}`,
+		},
+		{
+			name: "setOccupied",
+			fn:   SetOccupied(SetOccupiedParams{Occupied: true, HoldType: HoldTypeIndefinite}),
+			want: `{"type":"setOccupied","params":{"occupied":true,"holdType":"indefinite"}}`,
+		},
+		{
+			name: "updateSensor",
+			fn:   UpdateSensor("Bedroom", "rs:100", "1"),
+			want: `{"type":"updateSensor","params":{"name":"Bedroom","deviceId":"rs:100","sensorId":"1"}}`,
+		},
+		{
+			name: "controlPlug",
+			fn:   ControlPlug(ControlPlugParams{PlugName: "Lamp", PlugState: PlugStateOn}),
+			want: `{"type":"controlPlug","params":{"plugName":"Lamp","plugState":"on"}}`,
+		},
+		{
+			name: "updateClimate",
+			fn:   UpdateClimate(UpdateClimateParams{ClimateRef: "home", HeatTemp: 700}),
+			want: `{"type":"updateClimate","params":{"climateRef":"home","heatTemp":700}}`,
+		},
+	} {
+		got, err := json.Marshal(tt.fn)
+		if err != nil {
+			t.Errorf("case %q: got unexpected error: %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("case %q: got: %s, want: %s", tt.name, got, tt.want)
+		}
+	}
+}
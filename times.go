@@ -0,0 +1,161 @@
+package egobee
+
+import (
+	"fmt"
+	"time"
+)
+
+// Formats of dates and times in the ecobee API. Whether a value is in UTC or
+// thermostat local time depends on the field.
+const (
+	dateFormat     = "2006-01-02"
+	timeFormat     = "15:04:05"
+	dateTimeFormat = dateFormat + " " + timeFormat
+)
+
+// parseTime parses value, formatted according to layout, in loc. The API uses
+// empty strings for times which are unset, so those parse as the zero Time.
+func parseTime(layout, value string, loc *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation(layout, value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("malformed time %q: %v", value, err)
+	}
+	return t, nil
+}
+
+// parseDateAndTime parses a date and time of day given separately, as they are
+// in Events and Alerts, in loc.
+func parseDateAndTime(date, timeOfDay string, loc *time.Location) (time.Time, error) {
+	if date == "" {
+		return time.Time{}, nil
+	}
+	if timeOfDay == "" {
+		return parseTime(dateFormat, date, loc)
+	}
+	return parseTime(dateTimeFormat, date+" "+timeOfDay, loc)
+}
+
+// TimeZone in which the thermostat is located, used to interpret its local
+// times. It requires the Location to have been included in the Selection; if
+// it was not, UTC is returned.
+func (t *Thermostat) TimeZone() *time.Location {
+	if t.Location.TimeZone == "" && t.Location.TimeZoneOffsetMinutes == 0 {
+		return time.UTC
+	}
+	return t.Location.timeLocation()
+}
+
+// LocalTime returns the thermostat's ThermostatTime, in its TimeZone.
+func (t *Thermostat) LocalTime() (time.Time, error) {
+	return parseTime(dateTimeFormat, t.ThermostatTime, t.TimeZone())
+}
+
+// UTC returns the thermostat's UTCTime.
+func (t *Thermostat) UTC() (time.Time, error) {
+	return parseTime(dateTimeFormat, t.UTCTime, time.UTC)
+}
+
+// LastModifiedTime returns the time, in UTC, at which the thermostat's
+// configuration was last modified.
+func (t *Thermostat) LastModifiedTime() (time.Time, error) {
+	return parseTime(dateTimeFormat, t.LastModified, time.UTC)
+}
+
+// FirstConnectedTime returns the time, in UTC, at which the thermostat first
+// connected to the ecobee servers.
+func (r *Runtime) FirstConnectedTime() (time.Time, error) {
+	return parseTime(dateTimeFormat, r.FirstConnected, time.UTC)
+}
+
+// ConnectTime returns the time, in UTC, of the thermostat's last connection.
+func (r *Runtime) ConnectTime() (time.Time, error) {
+	return parseTime(dateTimeFormat, r.ConnectDateTime, time.UTC)
+}
+
+// DisconnectTime returns the time, in UTC, at which the thermostat last
+// disconnected.
+func (r *Runtime) DisconnectTime() (time.Time, error) {
+	return parseTime(dateTimeFormat, r.DisconnectDateTime, time.UTC)
+}
+
+// LastModifiedTime returns the time, in UTC, at which the runtime was last
+// updated.
+func (r *Runtime) LastModifiedTime() (time.Time, error) {
+	return parseTime(dateTimeFormat, r.LastModified, time.UTC)
+}
+
+// LastStatusModifiedTime returns the time, in UTC, at which the equipment
+// status last changed.
+func (r *Runtime) LastStatusModifiedTime() (time.Time, error) {
+	return parseTime(dateTimeFormat, r.LastStatusModified, time.UTC)
+}
+
+// IntervalStart returns the start, in UTC, of the last 5 minute interval
+// reported by the thermostat, from RuntimeDate and RuntimeInterval.
+func (r *Runtime) IntervalStart() (time.Time, error) {
+	d, err := parseTime(dateFormat, r.RuntimeDate, time.UTC)
+	if err != nil || d.IsZero() {
+		return d, err
+	}
+	return d.Add(time.Duration(r.RuntimeInterval) * 5 * time.Minute), nil
+}
+
+// Start of the event, which is in thermostat local time. loc is usually the
+// Thermostat's TimeZone, as used by Thermostat.EventStart.
+func (e *Event) Start(loc *time.Location) (time.Time, error) {
+	return parseDateAndTime(e.StartDate, e.StartTime, loc)
+}
+
+// End of the event, which is in thermostat local time. loc is usually the
+// Thermostat's TimeZone, as used by Thermostat.EventEnd.
+func (e *Event) End(loc *time.Location) (time.Time, error) {
+	return parseDateAndTime(e.EndDate, e.EndTime, loc)
+}
+
+// ActiveAt reports whether t falls within the event's window, which is in the
+// time zone loc. An event is active from its Start up to, but not including,
+// its End. Thermostat.EventActiveAt uses the Thermostat's TimeZone.
+func (e *Event) ActiveAt(t time.Time, loc *time.Location) (bool, error) {
+	start, err := e.Start(loc)
+	if err != nil {
+		return false, err
+	}
+	end, err := e.End(loc)
+	if err != nil {
+		return false, err
+	}
+	return !t.Before(start) && t.Before(end), nil
+}
+
+// DateTime at which the alert was raised, which is in thermostat local time.
+// loc is usually the Thermostat's TimeZone, as used by Thermostat.AlertDateTime.
+func (a *Alert) DateTime(loc *time.Location) (time.Time, error) {
+	return parseDateAndTime(a.Date, a.Time, loc)
+}
+
+// EventStart returns the Start of e, one of the thermostat's Events, in the
+// thermostat's TimeZone.
+func (t *Thermostat) EventStart(e *Event) (time.Time, error) {
+	return e.Start(t.TimeZone())
+}
+
+// EventEnd returns the End of e, one of the thermostat's Events, in the
+// thermostat's TimeZone.
+func (t *Thermostat) EventEnd(e *Event) (time.Time, error) {
+	return e.End(t.TimeZone())
+}
+
+// EventActiveAt reports whether e, one of the thermostat's Events, is active at
+// the instant at, interpreting the event's window in the thermostat's TimeZone.
+func (t *Thermostat) EventActiveAt(e *Event, at time.Time) (bool, error) {
+	return e.ActiveAt(at, t.TimeZone())
+}
+
+// AlertDateTime returns the DateTime at which a, one of the thermostat's Alerts,
+// was raised, in the thermostat's TimeZone.
+func (t *Thermostat) AlertDateTime(a *Alert) (time.Time, error) {
+	return a.DateTime(t.TimeZone())
+}
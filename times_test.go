@@ -0,0 +1,203 @@
+package egobee
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThermostatTimeZone(t *testing.T) {
+	toronto, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		t.Fatalf("failed to load time zone: %v", err)
+	}
+	for _, tt := range []struct {
+		name     string
+		location Location
+		want     string
+		offset   int
+	}{
+		{"unset", Location{}, "UTC", 0},
+		{"named", Location{TimeZone: "America/Toronto", TimeZoneOffsetMinutes: -300}, "America/Toronto", -5 * 3600},
+		{"unknown name", Location{TimeZone: "Mars/Olympus_Mons", TimeZoneOffsetMinutes: -300}, "Mars/Olympus_Mons", -5 * 3600},
+		{"offset only", Location{TimeZoneOffsetMinutes: 60}, "", 3600},
+	} {
+		th := &Thermostat{Location: tt.location}
+		loc := th.TimeZone()
+		if loc.String() != tt.want {
+			t.Errorf("%v: got time zone %q, want %q", tt.name, loc, tt.want)
+		}
+		// January, so that Toronto is on standard time.
+		if _, offset := time.Date(2019, 1, 1, 0, 0, 0, 0, loc).Zone(); offset != tt.offset {
+			t.Errorf("%v: got offset %v, want %v", tt.name, offset, tt.offset)
+		}
+	}
+
+	th := &Thermostat{
+		Location:       Location{TimeZone: "America/Toronto"},
+		ThermostatTime: "2019-07-01 09:30:00",
+		UTCTime:        "2019-07-01 13:30:00",
+		LastModified:   "2019-06-30 22:15:10",
+	}
+	local, err := th.LocalTime()
+	if err != nil {
+		t.Fatalf("LocalTime: got unexpected error: %v", err)
+	}
+	if want := time.Date(2019, 7, 1, 9, 30, 0, 0, toronto); !local.Equal(want) || local.Location().String() != "America/Toronto" {
+		t.Errorf("LocalTime: got %v, want %v", local, want)
+	}
+	utc, err := th.UTC()
+	if err != nil {
+		t.Fatalf("UTC: got unexpected error: %v", err)
+	}
+	if !utc.Equal(local) {
+		t.Errorf("UTC: got %v, want the same instant as %v", utc, local)
+	}
+	if got, err := th.LastModifiedTime(); err != nil || !got.Equal(time.Date(2019, 6, 30, 22, 15, 10, 0, time.UTC)) {
+		t.Errorf("LastModifiedTime: got %v, %v", got, err)
+	}
+}
+
+func TestRuntimeTimes(t *testing.T) {
+	r := &Runtime{
+		FirstConnected:     "2017-03-04 15:16:17",
+		ConnectDateTime:    "2019-07-01 10:00:00",
+		LastModified:       "2019-07-01 13:31:02",
+		LastStatusModified: "2019-07-01 13:25:00",
+		RuntimeDate:        "2019-07-01",
+		RuntimeInterval:    162,
+	}
+	for _, tt := range []struct {
+		name string
+		fn   func() (time.Time, error)
+		want time.Time
+	}{
+		{"FirstConnectedTime", r.FirstConnectedTime, time.Date(2017, 3, 4, 15, 16, 17, 0, time.UTC)},
+		{"ConnectTime", r.ConnectTime, time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)},
+		{"DisconnectTime", r.DisconnectTime, time.Time{}},
+		{"LastModifiedTime", r.LastModifiedTime, time.Date(2019, 7, 1, 13, 31, 2, 0, time.UTC)},
+		{"LastStatusModifiedTime", r.LastStatusModifiedTime, time.Date(2019, 7, 1, 13, 25, 0, 0, time.UTC)},
+		{"IntervalStart", r.IntervalStart, time.Date(2019, 7, 1, 13, 30, 0, 0, time.UTC)},
+	} {
+		got, err := tt.fn()
+		if err != nil {
+			t.Errorf("%v: got unexpected error: %v", tt.name, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	r.ConnectDateTime = "yesterday"
+	if _, err := r.ConnectTime(); err == nil {
+		t.Error("expected error for malformed time, got nil")
+	}
+}
+
+func TestEventWindow(t *testing.T) {
+	toronto, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		t.Fatalf("failed to load time zone: %v", err)
+	}
+	e := &Event{
+		StartDate: "2019-03-10",
+		StartTime: "00:00:00",
+		EndDate:   "2019-03-10",
+		EndTime:   "06:00:00",
+	}
+	start, err := e.Start(toronto)
+	if err != nil {
+		t.Fatalf("Start: got unexpected error: %v", err)
+	}
+	end, err := e.End(toronto)
+	if err != nil {
+		t.Fatalf("End: got unexpected error: %v", err)
+	}
+	// Daylight saving time begins during the event, so it lasts five hours.
+	if got := end.Sub(start); got != 5*time.Hour {
+		t.Errorf("got event duration %v, want 5h", got)
+	}
+
+	for _, tt := range []struct {
+		at   time.Time
+		want bool
+	}{
+		{time.Date(2019, 3, 10, 4, 59, 59, 0, time.UTC), false},
+		{time.Date(2019, 3, 10, 5, 0, 0, 0, time.UTC), true},
+		{time.Date(2019, 3, 10, 9, 59, 59, 0, time.UTC), true},
+		{time.Date(2019, 3, 10, 10, 0, 0, 0, time.UTC), false},
+	} {
+		got, err := e.ActiveAt(tt.at, toronto)
+		if err != nil {
+			t.Fatalf("ActiveAt: got unexpected error: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("ActiveAt(%v): got %v, want %v", tt.at, got, tt.want)
+		}
+	}
+
+	e.EndTime = "6pm"
+	if _, err := e.ActiveAt(start, toronto); err == nil {
+		t.Error("expected error for malformed end time, got nil")
+	}
+}
+
+func TestAlertDateTime(t *testing.T) {
+	loc := time.FixedZone("", -7*3600)
+	a := &Alert{Date: "2019-01-02", Time: "03:04:05"}
+	got, err := a.DateTime(loc)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if want := time.Date(2019, 1, 2, 10, 4, 5, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	a = &Alert{Date: "2019-01-02"}
+	if got, err := a.DateTime(loc); err != nil || !got.Equal(time.Date(2019, 1, 2, 0, 0, 0, 0, loc)) {
+		t.Errorf("date only: got %v, %v", got, err)
+	}
+	if got, err := (&Alert{}).DateTime(loc); err != nil || !got.IsZero() {
+		t.Errorf("unset: got %v, %v, want zero time", got, err)
+	}
+}
+
+func TestThermostatEventAndAlertTimes(t *testing.T) {
+	toronto, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		t.Fatalf("failed to load time zone: %v", err)
+	}
+	th := &Thermostat{
+		Location: Location{TimeZone: "America/Toronto"},
+		Events: []Event{{
+			StartDate: "2019-07-01",
+			StartTime: "09:00:00",
+			EndDate:   "2019-07-01",
+			EndTime:   "17:00:00",
+		}},
+		Alerts: []Alert{{Date: "2019-07-01", Time: "12:30:00"}},
+	}
+	e := &th.Events[0]
+	if got, err := th.EventStart(e); err != nil || !got.Equal(time.Date(2019, 7, 1, 9, 0, 0, 0, toronto)) {
+		t.Errorf("EventStart: got %v, %v", got, err)
+	}
+	if got, err := th.EventEnd(e); err != nil || !got.Equal(time.Date(2019, 7, 1, 17, 0, 0, 0, toronto)) {
+		t.Errorf("EventEnd: got %v, %v", got, err)
+	}
+	for _, tt := range []struct {
+		at   time.Time
+		want bool
+	}{
+		// Toronto is 4 hours behind UTC in July.
+		{time.Date(2019, 7, 1, 12, 59, 59, 0, time.UTC), false},
+		{time.Date(2019, 7, 1, 13, 0, 0, 0, time.UTC), true},
+		{time.Date(2019, 7, 1, 21, 0, 0, 0, time.UTC), false},
+	} {
+		if got, err := th.EventActiveAt(e, tt.at); err != nil || got != tt.want {
+			t.Errorf("EventActiveAt(%v): got %v, %v, want %v", tt.at, got, err, tt.want)
+		}
+	}
+	if got, err := th.AlertDateTime(&th.Alerts[0]); err != nil || !got.Equal(time.Date(2019, 7, 1, 16, 30, 0, 0, time.UTC)) {
+		t.Errorf("AlertDateTime: got %v, %v", got, err)
+	}
+}
@@ -1,10 +1,14 @@
 package egobee
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"regexp"
 	"sync"
 	"time"
@@ -34,11 +38,17 @@ var (
 
 // PinAuthenticationChallenge is the initial response from the Ecobee API for
 // pin-based application authentication.
+// See https://www.ecobee.com/home/developer/api/documentation/v1/auth/pin-api-authorization.shtml
 type PinAuthenticationChallenge struct {
 	Pin               string `json:"ecobeePin"`
 	AuthorizationCode string `json:"code"`
 	Scope             Scope  `json:"scope"`
-	// expires_in and interval are ignored for now.
+	// ExpiresIn is the number of minutes for which the PIN is valid.
+	ExpiresIn int `json:"expires_in"`
+	// Interval is the minimum number of seconds between polls for tokens.
+	Interval int `json:"interval"`
+
+	issued time.Time // when the challenge was received
 }
 
 // TokenDuration wraps time.Duration to add JSON (un)marshalling
@@ -214,6 +224,17 @@ func NewMemoryTokenStore(r *TokenRefreshResponse) TokenStorer {
 
 const persistentStorePermissions = 0640
 
+// RefreshLocker is implemented by TokenStorers which may be shared with other
+// processes, such as those returned by NewPersistentTokenStore. A Client holds
+// the lock while refreshing tokens and updating the store with the result, so
+// that a refresh token rotated by one process is never used by another.
+type RefreshLocker interface {
+	// LockRefresh blocks until the caller holds the exclusive right to refresh
+	// the tokens, or ctx is done. Before it returns, the store reflects any
+	// refresh made by another process. The returned function releases the lock.
+	LockRefresh(ctx context.Context) (unlock func(), err error)
+}
+
 // persistentStoreData stores the data in memory matching the data stored to disk
 type persistentStoreData struct {
 	AccessTokenData  string    `json:"accessToken"`
@@ -221,10 +242,14 @@ type persistentStoreData struct {
 	ValidUntilData   time.Time `json:"validUntil"`
 }
 
-// persistentStore implements tokenStore backed by disk.
+// persistentStore implements tokenStore backed by disk. The file is replaced
+// atomically on every update, and may be shared by several processes using
+// the advisory lock on the file at path+".lock".
 type persistentStore struct {
-	mu   sync.RWMutex // protects the following members
-	path string       // path to store file
+	mu     sync.RWMutex     // protects the following members
+	path   string           // path to store file
+	synced os.FileInfo      // of the file when last read or written
+	enc    *storeEncryption // encrypts the file, if set
 	persistentStoreData
 }
 
@@ -246,37 +271,192 @@ func (s *persistentStore) ValidFor() time.Duration {
 	return s.ValidUntilData.Sub(now())
 }
 
+// Update the tokens, and replace the file with them. The file is written to a
+// temporary file, synced, and renamed over the original, so that it always
+// contains either the old or the new tokens.
 func (s *persistentStore) Update(r *TokenRefreshResponse) error {
-	// Update in-memory data
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.AccessTokenData = r.AccessToken
-	s.RefreshTokenData = r.RefreshToken
-	s.ValidUntilData = generateValidUntil(r)
+	data := persistentStoreData{
+		AccessTokenData:  r.AccessToken,
+		RefreshTokenData: r.RefreshToken,
+		ValidUntilData:   generateValidUntil(r),
+	}
+	b, err := s.encode(&data)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path, b, persistentStorePermissions); err != nil {
+		return err
+	}
+	s.persistentStoreData = data
+	// A failure to stat only means that the file will be read again before the
+	// next refresh.
+	s.synced, _ = os.Stat(s.path)
+	return nil
+}
 
-	f, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, persistentStorePermissions)
+// encode data as the contents of the store's file.
+func (s *persistentStore) encode(data *persistentStoreData) ([]byte, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	if s.enc != nil {
+		return s.enc.seal(b)
+	}
+	return append(b, '\n'), nil
+}
+
+// writeFileAtomic replaces the file at path with b.
+func writeFileAtomic(path string, b []byte, perm os.FileMode) error {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := ioutil.TempFile(dir, "."+base+".tmp")
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	tmp := f.Name()
+	defer os.Remove(tmp) // Fails harmlessly once renamed.
 
-	// Write token data to file to be accessed later
-	return json.NewEncoder(f).Encode(&s.persistentStoreData)
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	// Persist the rename itself. Not every platform supports syncing a
+	// directory, and the data is safe either way, so errors are ignored.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
 }
 
 // load the data from local file into memory.
 func (s *persistentStore) load() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.loadLocked()
+}
 
+func (s *persistentStore) loadLocked() error {
 	f, err := os.Open(s.path)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	return json.NewDecoder(f).Decode(&s.persistentStoreData)
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	plaintext := true
+	if s.enc != nil {
+		if b, plaintext, err = s.enc.open(b); err != nil {
+			return fmt.Errorf("failed to load %v: %w", s.path, err)
+		}
+	} else if isEncryptedStore(b) {
+		return fmt.Errorf("failed to load %v: token store is encrypted", s.path)
+	}
+	var data persistentStoreData
+	if err := json.Unmarshal(b, &data); err != nil {
+		return err
+	}
+	s.persistentStoreData = data
+	s.synced = fi
+	if s.enc != nil && plaintext {
+		return s.migrateLocked()
+	}
+	return nil
+}
+
+// migrateLocked replaces a plaintext file read by an encrypted store with its
+// encrypted equivalent.
+func (s *persistentStore) migrateLocked() error {
+	b, err := s.encode(&s.persistentStoreData)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path, b, persistentStorePermissions); err != nil {
+		return fmt.Errorf("failed to encrypt %v: %v", s.path, err)
+	}
+	s.synced, _ = os.Stat(s.path)
+	return nil
+}
+
+// reloadIfChanged reads the file again if it has been replaced or modified
+// since it was last read or written.
+func (s *persistentStore) reloadIfChanged() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	if s.synced != nil && os.SameFile(s.synced, fi) && fi.ModTime().Equal(s.synced.ModTime()) && fi.Size() == s.synced.Size() {
+		return nil
+	}
+	return s.loadLocked()
+}
+
+// lockRetryInterval is how often LockRefresh tries to take a lock held by
+// another process.
+const lockRetryInterval = 50 * time.Millisecond
+
+// LockRefresh takes the advisory lock on the file at the store's path plus
+// ".lock", and reads the store's file again if another process has changed it.
+func (s *persistentStore) LockRefresh(ctx context.Context) (func(), error) {
+	f, err := os.OpenFile(s.path+".lock", os.O_RDWR|os.O_CREATE, persistentStorePermissions)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock %v: %v", f.Name(), err)
+		}
+		if locked {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+	unlock := func() {
+		unlockFile(f)
+		f.Close()
+	}
+	if err := s.reloadIfChanged(); err != nil {
+		unlock()
+		return nil, fmt.Errorf("failed to reload %v: %w", s.path, err)
+	}
+	return unlock, nil
 }
 
 // NewPersistentTokenStore is a TokenStorer with persistence to disk
@@ -300,8 +480,9 @@ func NewPersistentTokenFromDisk(path string) (TokenStorer, error) {
 	return s, s.load()
 }
 
-// generateValidUntil returns the time the token expires with an added buffer
+// generateValidUntil returns the time the token expires. Clients account for
+// network and processing delays by refreshing ahead of this time, according to
+// Options.RefreshLeadTime.
 func generateValidUntil(r *TokenRefreshResponse) time.Time {
-	// Subtract a few seconds to allow for network and processing delays.
-	return now().Add(r.ExpiresIn.Duration - (15 * time.Second))
+	return now().Add(r.ExpiresIn.Duration)
 }
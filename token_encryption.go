@@ -0,0 +1,330 @@
+package egobee
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	// ErrTokenStoreTampered is returned when an encrypted token store fails
+	// authentication. Either the file was modified by something other than a
+	// TokenStorer, or it is being read with the wrong key.
+	ErrTokenStoreTampered = errors.New("token store failed authentication: modified or wrong key")
+
+	// ErrTokenStoreNotEncrypted is returned by NewEncryptedTokenStoreFromDisk
+	// when the file holds plaintext tokens. Use EncryptTokenStore to migrate it.
+	ErrTokenStoreNotEncrypted = errors.New("token store is not encrypted")
+
+	// scryptN is the scrypt cost parameter for newly encrypted stores,
+	// overrideable for testing.
+	scryptN = 1 << 15
+)
+
+const (
+	encryptedStoreVersion = 1
+	tokenStoreKeySize     = 32 // AES-256
+	kdfScrypt             = "scrypt"
+	scryptSaltSize        = 16
+	scryptR               = 8
+	scryptP               = 1
+)
+
+// TokenStoreKey is the secret protecting an encrypted token store. It is either
+// an AES-256 key, or a passphrase from which a key is derived using scrypt and
+// a random salt kept in the store's file.
+type TokenStoreKey struct {
+	key        []byte
+	passphrase []byte
+}
+
+// NewTokenStoreKey returns a TokenStoreKey for a 32 byte AES-256 key.
+func NewTokenStoreKey(key []byte) (*TokenStoreKey, error) {
+	if len(key) != tokenStoreKeySize {
+		return nil, fmt.Errorf("token store key is %v bytes, want %v", len(key), tokenStoreKeySize)
+	}
+	return &TokenStoreKey{key: append([]byte(nil), key...)}, nil
+}
+
+// TokenStoreKeyFromPassphrase returns a TokenStoreKey which derives the key from
+// passphrase. Deriving the key is deliberately slow, which makes guessing the
+// passphrase expensive, so prefer a random key where one can be kept safely.
+func TokenStoreKeyFromPassphrase(passphrase string) (*TokenStoreKey, error) {
+	if passphrase == "" {
+		return nil, errors.New("empty token store passphrase")
+	}
+	return &TokenStoreKey{passphrase: []byte(passphrase)}, nil
+}
+
+// TokenStoreKeyFromFile reads a key from the file at path. The file holds the
+// 32 byte key itself, or its hex or standard base64 encoding, such as the output
+// of `head -c 32 /dev/urandom | base64`.
+func TokenStoreKeyFromFile(path string) (*TokenStoreKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == tokenStoreKeySize {
+		return NewTokenStoreKey(b)
+	}
+	key, err := decodeTokenStoreKey(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key in %v: %v", path, err)
+	}
+	return NewTokenStoreKey(key)
+}
+
+// TokenStoreKeyFromEnv reads the hex or standard base64 encoding of a 32 byte
+// key from the environment variable name.
+func TokenStoreKeyFromEnv(name string) (*TokenStoreKey, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return nil, fmt.Errorf("%v is not set", name)
+	}
+	key, err := decodeTokenStoreKey(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key in %v: %v", name, err)
+	}
+	return NewTokenStoreKey(key)
+}
+
+// decodeTokenStoreKey decodes the hex or base64 encoding of a key.
+func decodeTokenStoreKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == hex.EncodedLen(tokenStoreKeySize) {
+		return hex.DecodeString(s)
+	}
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("not hex or base64")
+	}
+	return key, nil
+}
+
+// encryptedStoreHeader describes how an encrypted store's file was encrypted.
+// It is authenticated along with the ciphertext, so it cannot be altered
+// without detection.
+type encryptedStoreHeader struct {
+	Version int `json:"version"`
+	// KDF is the function deriving the key from a passphrase, or empty if the
+	// file is encrypted with a key directly. The remaining fields are its
+	// parameters.
+	KDF  string `json:"kdf,omitempty"`
+	Salt []byte `json:"salt,omitempty"`
+	N    int    `json:"n,omitempty"`
+	R    int    `json:"r,omitempty"`
+	P    int    `json:"p,omitempty"`
+}
+
+func (h *encryptedStoreHeader) equal(o *encryptedStoreHeader) bool {
+	return h.Version == o.Version && h.KDF == o.KDF && bytes.Equal(h.Salt, o.Salt) &&
+		h.N == o.N && h.R == o.R && h.P == o.P
+}
+
+// encryptedStoreFile is the content of an encrypted store's file. The
+// ciphertext is the AES-GCM encryption of the JSON persistentStoreData.
+type encryptedStoreFile struct {
+	encryptedStoreHeader
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// storeEncryption encrypts and decrypts a persistentStore's file.
+type storeEncryption struct {
+	key *TokenStoreKey
+	// migrate permits reading a plaintext file, which is then replaced with
+	// an encrypted one.
+	migrate bool
+
+	// header and aead for the file last read or written, which are reused to
+	// avoid deriving the key from a passphrase every time.
+	header *encryptedStoreHeader
+	aead   cipher.AEAD
+}
+
+// aeadFor returns the cipher for a file with header h.
+func (e *storeEncryption) aeadFor(h *encryptedStoreHeader) (cipher.AEAD, error) {
+	if e.header != nil && e.header.equal(h) {
+		return e.aead, nil
+	}
+	var key []byte
+	switch h.KDF {
+	case "":
+		if e.key.key == nil {
+			return nil, errors.New("token store is encrypted with a key, not a passphrase")
+		}
+		key = e.key.key
+	case kdfScrypt:
+		if e.key.passphrase == nil {
+			return nil, errors.New("token store is encrypted with a passphrase, not a key")
+		}
+		// Bound the work a modified header can demand before failing to
+		// authenticate.
+		if h.N > 1<<20 || h.R > 32 || h.P > 16 {
+			return nil, ErrTokenStoreTampered
+		}
+		var err error
+		if key, err = scrypt.Key(e.key.passphrase, h.Salt, h.N, h.R, h.P, tokenStoreKeySize); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key derivation function %q", h.KDF)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	e.header, e.aead = h, aead
+	return aead, nil
+}
+
+// newHeader returns the header for a newly encrypted file.
+func (e *storeEncryption) newHeader() (*encryptedStoreHeader, error) {
+	h := &encryptedStoreHeader{Version: encryptedStoreVersion}
+	if e.key.passphrase != nil {
+		h.KDF, h.N, h.R, h.P = kdfScrypt, scryptN, scryptR, scryptP
+		h.Salt = make([]byte, scryptSaltSize)
+		if _, err := io.ReadFull(rand.Reader, h.Salt); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// seal plaintext, returning the contents of the file. Files are encrypted with
+// the same header, and so the same salt, as the file last read or written.
+func (e *storeEncryption) seal(plaintext []byte) ([]byte, error) {
+	h := e.header
+	if h == nil {
+		var err error
+		if h, err = e.newHeader(); err != nil {
+			return nil, err
+		}
+	}
+	aead, err := e.aeadFor(h)
+	if err != nil {
+		return nil, err
+	}
+	aad, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	f := &encryptedStoreFile{
+		encryptedStoreHeader: *h,
+		Nonce:                make([]byte, aead.NonceSize()),
+	}
+	if _, err := io.ReadFull(rand.Reader, f.Nonce); err != nil {
+		return nil, err
+	}
+	f.Ciphertext = aead.Seal(nil, f.Nonce, plaintext, aad)
+	b, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// open the contents of a file, returning the plaintext. If the file is not
+// encrypted and e permits migration, it is returned as is, and isPlaintext is
+// true.
+func (e *storeEncryption) open(b []byte) (plaintext []byte, isPlaintext bool, err error) {
+	var f encryptedStoreFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, false, err
+	}
+	if f.Version == 0 {
+		if !e.migrate {
+			return nil, false, ErrTokenStoreNotEncrypted
+		}
+		return b, true, nil
+	}
+	if f.Version != encryptedStoreVersion {
+		return nil, false, fmt.Errorf("unsupported token store version %v", f.Version)
+	}
+	aead, err := e.aeadFor(&f.encryptedStoreHeader)
+	if err != nil {
+		return nil, false, err
+	}
+	aad, err := json.Marshal(&f.encryptedStoreHeader)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(f.Nonce) != aead.NonceSize() {
+		return nil, false, ErrTokenStoreTampered
+	}
+	plaintext, err = aead.Open(nil, f.Nonce, f.Ciphertext, aad)
+	if err != nil {
+		return nil, false, ErrTokenStoreTampered
+	}
+	return plaintext, false, nil
+}
+
+// isEncryptedStore reports whether b is the content of an encrypted store's
+// file.
+func isEncryptedStore(b []byte) bool {
+	var h encryptedStoreHeader
+	return json.Unmarshal(b, &h) == nil && h.Version != 0
+}
+
+// NewEncryptedTokenStore is a TokenStorer with persistence to disk, like
+// NewPersistentTokenStore, except that the file is encrypted with AES-GCM using
+// key. Loading a file which has been modified fails with ErrTokenStoreTampered.
+func NewEncryptedTokenStore(r *TokenRefreshResponse, path string, key *TokenStoreKey) (TokenStorer, error) {
+	s := &persistentStore{
+		path: path,
+		enc:  &storeEncryption{key: key},
+	}
+	if err := s.Update(r); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewEncryptedTokenStoreFromDisk returns a TokenStorer based on a file written
+// by an encrypted TokenStorer. It fails with ErrTokenStoreNotEncrypted if the
+// file holds plaintext tokens.
+func NewEncryptedTokenStoreFromDisk(path string, key *TokenStoreKey) (TokenStorer, error) {
+	s := &persistentStore{
+		path: path,
+		enc:  &storeEncryption{key: key},
+	}
+	return s, s.load()
+}
+
+// EncryptTokenStore returns a TokenStorer based on the file at path, which may
+// have been written by an encrypted TokenStorer or by NewPersistentTokenStore.
+// A plaintext file is replaced with an encrypted one while holding the store's
+// refresh lock, so that tokens refreshed concurrently by another process are
+// not lost. It is safe to call every time the store is opened.
+func EncryptTokenStore(path string, key *TokenStoreKey) (TokenStorer, error) {
+	s := &persistentStore{
+		path: path,
+		enc:  &storeEncryption{key: key, migrate: true},
+	}
+	unlock, err := s.LockRefresh(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enc.migrate = false
+	return s, nil
+}
@@ -0,0 +1,353 @@
+package egobee
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testTokenStoreKey is a fixed key for testing.
+var testTokenStoreKey = bytes.Repeat([]byte{0x42}, tokenStoreKeySize)
+
+func mustTokenStoreKey(t *testing.T, key []byte) *TokenStoreKey {
+	t.Helper()
+	k, err := NewTokenStoreKey(key)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	return k
+}
+
+// Distinctive tokens, which contain characters that base64 never produces, so
+// cannot appear in a ciphertext by chance.
+const (
+	plainAccessToken  = "plaintext_access_token"
+	plainRefreshToken = "plaintext_refresh_token"
+)
+
+// checkEncrypted fails the test unless b is the content of an encrypted store
+// which does not contain the plaintext tokens.
+func checkEncrypted(t *testing.T, name string, b []byte) {
+	t.Helper()
+	var f encryptedStoreFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		t.Errorf("%v: failed to decode store file: %v", name, err)
+		return
+	}
+	if f.Version == 0 || len(f.Ciphertext) == 0 {
+		t.Errorf("%v: store file is not encrypted: %s", name, b)
+	}
+	for _, token := range []string{plainAccessToken, plainRefreshToken} {
+		if bytes.Contains(b, []byte(token)) {
+			t.Errorf("%v: store file contains plaintext %q: %s", name, token, b)
+		}
+	}
+}
+
+// cheapScrypt makes deriving keys from passphrases fast for the duration of a
+// test.
+func cheapScrypt(t *testing.T) func() {
+	t.Helper()
+	orig := scryptN
+	scryptN = 1 << 4
+	return func() { scryptN = orig }
+}
+
+func TestEncryptedTokenStore(t *testing.T) {
+	defer cheapScrypt(t)()
+	passphrase, err := TokenStoreKeyFromPassphrase("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	for _, tt := range []struct {
+		name string
+		key  *TokenStoreKey
+	}{
+		{"key", mustTokenStoreKey(t, testTokenStoreKey)},
+		{"passphrase", passphrase},
+	} {
+		dir, err := ioutil.TempDir("", "egobee")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "store")
+
+		s, err := NewEncryptedTokenStore(&TokenRefreshResponse{AccessToken: "a1", RefreshToken: "r1"}, path, tt.key)
+		if err != nil {
+			t.Fatalf("%v: got unexpected error: %v", tt.name, err)
+		}
+		first, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Update(&TokenRefreshResponse{AccessToken: plainAccessToken, RefreshToken: plainRefreshToken}); err != nil {
+			t.Fatalf("%v: got unexpected error: %v", tt.name, err)
+		}
+		second, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkEncrypted(t, tt.name, second)
+
+		var f1, f2 encryptedStoreFile
+		if err := json.Unmarshal(first, &f1); err != nil {
+			t.Fatalf("%v: got unexpected error: %v", tt.name, err)
+		}
+		if err := json.Unmarshal(second, &f2); err != nil {
+			t.Fatalf("%v: got unexpected error: %v", tt.name, err)
+		}
+		if !f1.encryptedStoreHeader.equal(&f2.encryptedStoreHeader) {
+			t.Errorf("%v: header changed on update from %+v to %+v", tt.name, f1.encryptedStoreHeader, f2.encryptedStoreHeader)
+		}
+		if bytes.Equal(f1.Nonce, f2.Nonce) {
+			t.Errorf("%v: nonce reused on update", tt.name)
+		}
+
+		got, err := NewEncryptedTokenStoreFromDisk(path, tt.key)
+		if err != nil {
+			t.Fatalf("%v: got unexpected error: %v", tt.name, err)
+		}
+		if got.AccessToken() != plainAccessToken || got.RefreshToken() != plainRefreshToken {
+			t.Errorf("%v: got tokens %q and %q, want %q and %q", tt.name, got.AccessToken(), got.RefreshToken(), plainAccessToken, plainRefreshToken)
+		}
+	}
+}
+
+func TestEncryptedTokenStoreWrongKey(t *testing.T) {
+	defer cheapScrypt(t)()
+	dir, err := ioutil.TempDir("", "egobee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "key")
+	passPath := filepath.Join(dir, "pass")
+
+	key := mustTokenStoreKey(t, testTokenStoreKey)
+	if _, err := NewEncryptedTokenStore(&TokenRefreshResponse{AccessToken: "a1", RefreshToken: "r1"}, keyPath, key); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	pass, _ := TokenStoreKeyFromPassphrase("right")
+	if _, err := NewEncryptedTokenStore(&TokenRefreshResponse{AccessToken: "a1", RefreshToken: "r1"}, passPath, pass); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	otherKey := mustTokenStoreKey(t, bytes.Repeat([]byte{0x24}, tokenStoreKeySize))
+	otherPass, _ := TokenStoreKeyFromPassphrase("wrong")
+	for _, tt := range []struct {
+		name         string
+		path         string
+		key          *TokenStoreKey
+		wantTampered bool
+	}{
+		{"other key", keyPath, otherKey, true},
+		{"other passphrase", passPath, otherPass, true},
+		{"passphrase for key", keyPath, pass, false},
+		{"key for passphrase", passPath, key, false},
+	} {
+		_, err := NewEncryptedTokenStoreFromDisk(tt.path, tt.key)
+		if err == nil {
+			t.Errorf("%v: expected error, got nil", tt.name)
+			continue
+		}
+		if got := errors.Is(err, ErrTokenStoreTampered); got != tt.wantTampered {
+			t.Errorf("%v: got error %v, want ErrTokenStoreTampered: %v", tt.name, err, tt.wantTampered)
+		}
+	}
+}
+
+func TestEncryptedTokenStoreDetectsTampering(t *testing.T) {
+	defer cheapScrypt(t)()
+	key, _ := TokenStoreKeyFromPassphrase("correct horse battery staple")
+	for _, tt := range []struct {
+		name   string
+		tamper func(f *encryptedStoreFile)
+	}{
+		{"ciphertext", func(f *encryptedStoreFile) { f.Ciphertext[0] ^= 1 }},
+		{"truncated", func(f *encryptedStoreFile) { f.Ciphertext = f.Ciphertext[:len(f.Ciphertext)-1] }},
+		{"nonce", func(f *encryptedStoreFile) { f.Nonce[0] ^= 1 }},
+		{"short nonce", func(f *encryptedStoreFile) { f.Nonce = f.Nonce[1:] }},
+		{"salt", func(f *encryptedStoreFile) { f.Salt[0] ^= 1 }},
+		{"cost", func(f *encryptedStoreFile) { f.N *= 2 }},
+		{"huge cost", func(f *encryptedStoreFile) { f.N = 1 << 30 }},
+	} {
+		dir, err := ioutil.TempDir("", "egobee")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "store")
+		if _, err := NewEncryptedTokenStore(&TokenRefreshResponse{AccessToken: "a1", RefreshToken: "r1"}, path, key); err != nil {
+			t.Fatalf("%v: got unexpected error: %v", tt.name, err)
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var f encryptedStoreFile
+		if err := json.Unmarshal(b, &f); err != nil {
+			t.Fatalf("%v: got unexpected error: %v", tt.name, err)
+		}
+		tt.tamper(&f)
+		if b, err = json.Marshal(&f); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, b, persistentStorePermissions); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := NewEncryptedTokenStoreFromDisk(path, key); !errors.Is(err, ErrTokenStoreTampered) {
+			t.Errorf("%v: got error %v, want ErrTokenStoreTampered", tt.name, err)
+		}
+	}
+}
+
+func TestEncryptTokenStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "egobee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "store")
+	key := mustTokenStoreKey(t, testTokenStoreKey)
+
+	if _, err := NewPersistentTokenStore(&TokenRefreshResponse{AccessToken: plainAccessToken, RefreshToken: plainRefreshToken}, path); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if _, err := NewEncryptedTokenStoreFromDisk(path, key); !errors.Is(err, ErrTokenStoreNotEncrypted) {
+		t.Errorf("got error %v opening plaintext store, want ErrTokenStoreNotEncrypted", err)
+	}
+
+	s, err := EncryptTokenStore(path, key)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if s.AccessToken() != plainAccessToken || s.RefreshToken() != plainRefreshToken {
+		t.Errorf("got tokens %q and %q, want %q and %q", s.AccessToken(), s.RefreshToken(), plainAccessToken, plainRefreshToken)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEncrypted(t, "migrated", b)
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != persistentStorePermissions {
+		t.Errorf("got %v, %v for migrated store, want permissions %v", fi, err, os.FileMode(persistentStorePermissions))
+	}
+	if _, err := NewPersistentTokenFromDisk(path); err == nil {
+		t.Error("plaintext store read the encrypted file")
+	}
+
+	// Opening it again, now encrypted, is harmless.
+	again, err := EncryptTokenStore(path, key)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if again.RefreshToken() != plainRefreshToken {
+		t.Errorf("got refresh token %q, want %q", again.RefreshToken(), plainRefreshToken)
+	}
+
+	// Once migrated, the store refuses plaintext written behind its back.
+	if _, err := NewPersistentTokenStore(&TokenRefreshResponse{AccessToken: "a2", RefreshToken: "r2"}, path); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if _, err := s.(RefreshLocker).LockRefresh(context.Background()); !errors.Is(err, ErrTokenStoreNotEncrypted) {
+		t.Errorf("got error %v reloading plaintext, want ErrTokenStoreNotEncrypted", err)
+	}
+}
+
+func TestEncryptedTokenStoreLockRefresh(t *testing.T) {
+	dir, err := ioutil.TempDir("", "egobee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "store")
+	key := mustTokenStoreKey(t, testTokenStoreKey)
+
+	// Each store stands in for a different process sharing the file.
+	first, err := NewEncryptedTokenStore(&TokenRefreshResponse{AccessToken: "a1", RefreshToken: "r1"}, path, key)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	second, err := NewEncryptedTokenStoreFromDisk(path, key)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if err := first.Update(&TokenRefreshResponse{AccessToken: "a2", RefreshToken: "r2"}); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	unlock, err := second.(RefreshLocker).LockRefresh(context.Background())
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	defer unlock()
+	if got := second.RefreshToken(); got != "r2" {
+		t.Errorf("got refresh token %q after locking, want the other process's r2", got)
+	}
+}
+
+func TestTokenStoreKeyFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "egobee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, tt := range []struct {
+		name    string
+		content []byte
+		wantErr bool
+	}{
+		{"raw", testTokenStoreKey, false},
+		{"hex", []byte(hex.EncodeToString(testTokenStoreKey) + "\n"), false},
+		{"base64", []byte(base64.StdEncoding.EncodeToString(testTokenStoreKey) + "\n"), false},
+		{"short", testTokenStoreKey[1:], true},
+		{"short base64", []byte(base64.StdEncoding.EncodeToString(testTokenStoreKey[1:])), true},
+		{"garbage", []byte(strings.Repeat("?", 44)), true},
+	} {
+		path := filepath.Join(dir, strings.Replace(tt.name, " ", "_", -1))
+		if err := ioutil.WriteFile(path, tt.content, 0600); err != nil {
+			t.Fatal(err)
+		}
+		got, err := TokenStoreKeyFromFile(path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: got error %v, want error: %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && !bytes.Equal(got.key, testTokenStoreKey) {
+			t.Errorf("%v: got key %x, want %x", tt.name, got.key, testTokenStoreKey)
+		}
+	}
+	if _, err := TokenStoreKeyFromFile(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected error reading missing key file, got nil")
+	}
+}
+
+func TestTokenStoreKeyFromEnv(t *testing.T) {
+	const name = "EGOBEE_TEST_TOKEN_STORE_KEY"
+	defer os.Unsetenv(name)
+
+	if _, err := TokenStoreKeyFromEnv(name); err == nil {
+		t.Error("expected error for unset variable, got nil")
+	}
+	os.Setenv(name, base64.StdEncoding.EncodeToString(testTokenStoreKey))
+	got, err := TokenStoreKeyFromEnv(name)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if !bytes.Equal(got.key, testTokenStoreKey) {
+		t.Errorf("got key %x, want %x", got.key, testTokenStoreKey)
+	}
+	os.Setenv(name, "not a key")
+	if _, err := TokenStoreKeyFromEnv(name); err == nil {
+		t.Error("expected error for invalid key, got nil")
+	}
+}
@@ -1,9 +1,11 @@
 package egobee
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
@@ -247,7 +249,7 @@ func TestPersistentStoreUpdateLeavesOnlyASingleEntryInFile(t *testing.T) {
 		t.Errorf("Failed to read %q", testStorePath)
 	}
 
-	want := `{"accessToken":"anotherAccessToken","refreshToken":"aRefreshToken","validUntil":"2015-02-23T15:50:44-04:00"}
+	want := `{"accessToken":"anotherAccessToken","refreshToken":"aRefreshToken","validUntil":"2015-02-23T15:50:59-04:00"}
 `
 	if got := string(b); want != got {
 		t.Errorf("incorrect store file contents; got: %q, want: %q", got, want)
@@ -258,3 +260,97 @@ func TestPersistentStoreUpdateLeavesOnlyASingleEntryInFile(t *testing.T) {
 	}
 
 }
+
+func TestPersistentStoreUpdateReplacesFileAtomically(t *testing.T) {
+	dir, err := ioutil.TempDir("", "egobee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "store")
+
+	s, err := NewPersistentTokenStore(&TokenRefreshResponse{AccessToken: "a1", RefreshToken: "r1"}, path)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(&TokenRefreshResponse{AccessToken: "a2", RefreshToken: "r2"}); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.SameFile(before, after) {
+		t.Error("file was written in place, rather than replaced")
+	}
+	if perm := after.Mode().Perm(); perm != persistentStorePermissions {
+		t.Errorf("got permissions %v, want %v", perm, os.FileMode(persistentStorePermissions))
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Name())
+		}
+		t.Errorf("got files %v, want only the store", names)
+	}
+
+	// A failed write leaves the store as it was.
+	s.(*persistentStore).path = filepath.Join(dir, "missing", "store")
+	if err := s.Update(&TokenRefreshResponse{AccessToken: "a3", RefreshToken: "r3"}); err == nil {
+		t.Error("expected error writing to a missing directory, got nil")
+	}
+	if got := s.RefreshToken(); got != "r2" {
+		t.Errorf("got refresh token %q after failed update, want r2", got)
+	}
+}
+
+func TestPersistentStoreLockRefresh(t *testing.T) {
+	dir, err := ioutil.TempDir("", "egobee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "store")
+
+	// Each store stands in for a different process sharing the file.
+	first, err := NewPersistentTokenStore(&TokenRefreshResponse{AccessToken: "a1", RefreshToken: "r1"}, path)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	second, err := NewPersistentTokenFromDisk(path)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	unlock, err := first.(RefreshLocker).LockRefresh(context.Background())
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*lockRetryInterval)
+	defer cancel()
+	if _, err := second.(RefreshLocker).LockRefresh(ctx); err != context.DeadlineExceeded {
+		t.Errorf("got error %v while the lock was held, want %v", err, context.DeadlineExceeded)
+	}
+
+	if err := first.Update(&TokenRefreshResponse{AccessToken: "a2", RefreshToken: "r2"}); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	unlock()
+
+	unlock, err = second.(RefreshLocker).LockRefresh(context.Background())
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	defer unlock()
+	if got := second.RefreshToken(); got != "r2" {
+		t.Errorf("got refresh token %q after locking, want the other process's r2", got)
+	}
+}
@@ -3,6 +3,7 @@ package egobee
 import (
 	"fmt"
 	"strconv"
+	"time"
 )
 
 // This file contains types for the ecobee v1 API as defined in the ecobee
@@ -74,8 +75,8 @@ type Climate struct {
 	Owner               string         `json:"owner"`
 	Type                string         `json:"type"`
 	Colour              int            `json:"colour"`
-	CoolTemp            int            `json:"coolTemp"`
-	HeatTemp            int            `json:"heatTemp"`
+	CoolTemp            Temperature    `json:"coolTemp"`
+	HeatTemp            Temperature    `json:"heatTemp"`
 	Sensors             []RemoteSensor `json:"sensors"`
 }
 
@@ -148,34 +149,34 @@ type EquipmentSetting struct {
 // is used, events are removed in the order they are listed here.
 // See https://www.ecobee.com/home/developer/api/documentation/v1/objects/Event.shtml
 type Event struct {
-	Type                   string `json:"type"`
-	Name                   string `json:"name"`
-	Running                bool   `json:"running"`
-	StartDate              string `json:"startDate"`
-	StartTime              string `json:"startTime"`
-	EndDate                string `json:"endDate"`
-	EndTime                string `json:"endTime"`
-	IsOccupied             bool   `json:"isOccupied"`
-	IsCoolOff              bool   `json:"isCoolOff"`
-	IsHeatOff              bool   `json:"isHeatOff"`
-	CoolHoldTemp           int    `json:"coolHoldTemp"`
-	HeatHoldTemp           int    `json:"heatHoldTemp"`
-	Fan                    string `json:"fan"`
-	Vent                   string `json:"vent"`
-	VentilatorMinOnTime    int    `json:"ventilatorMinOnTime"`
-	IsOptional             bool   `json:"isOptional"`
-	IsTemperatureRelative  bool   `json:"isTemperatureRelative"`
-	CoolRelativeTemp       int    `json:"coolRelativeTemp"`
-	HeatRelativeTemp       int    `json:"heatRelativeTemp"`
-	IsTemperatureAbsolute  bool   `json:"isTemperatureAbsolute"`
-	DutyCyclePercentage    int    `json:"dutyCyclePercentage"`
-	FanMinOnTime           int    `json:"fanMinOnTime"`
-	OccupiedSensorActive   bool   `json:"occupiedSensorActive"`
-	UnoccupiedSensorActive bool   `json:"unoccupiedSensorActive"`
-	DRRampUpTemp           int    `json:"drRampUpTemp"`
-	DRRampUpTime           int    `json:"drRampUpTime"`
-	LinkRef                string `json:"linkRef"`
-	HoldClimateRef         string `json:"holdClimateRef"`
+	Type                   string      `json:"type"`
+	Name                   string      `json:"name"`
+	Running                bool        `json:"running"`
+	StartDate              string      `json:"startDate"`
+	StartTime              string      `json:"startTime"`
+	EndDate                string      `json:"endDate"`
+	EndTime                string      `json:"endTime"`
+	IsOccupied             bool        `json:"isOccupied"`
+	IsCoolOff              bool        `json:"isCoolOff"`
+	IsHeatOff              bool        `json:"isHeatOff"`
+	CoolHoldTemp           Temperature `json:"coolHoldTemp"`
+	HeatHoldTemp           Temperature `json:"heatHoldTemp"`
+	Fan                    string      `json:"fan"`
+	Vent                   string      `json:"vent"`
+	VentilatorMinOnTime    int         `json:"ventilatorMinOnTime"`
+	IsOptional             bool        `json:"isOptional"`
+	IsTemperatureRelative  bool        `json:"isTemperatureRelative"`
+	CoolRelativeTemp       int         `json:"coolRelativeTemp"`
+	HeatRelativeTemp       int         `json:"heatRelativeTemp"`
+	IsTemperatureAbsolute  bool        `json:"isTemperatureAbsolute"`
+	DutyCyclePercentage    int         `json:"dutyCyclePercentage"`
+	FanMinOnTime           int         `json:"fanMinOnTime"`
+	OccupiedSensorActive   bool        `json:"occupiedSensorActive"`
+	UnoccupiedSensorActive bool        `json:"unoccupiedSensorActive"`
+	DRRampUpTemp           int         `json:"drRampUpTemp"`
+	DRRampUpTime           int         `json:"drRampUpTime"`
+	LinkRef                string      `json:"linkRef"`
+	HoldClimateRef         string      `json:"holdClimateRef"`
 }
 
 // ExtendedRuntime contains the last three 5 minute interval values sent by the
@@ -185,31 +186,31 @@ type Event struct {
 // minute value from the Runtime Object.
 // See https://www.ecobee.com/home/developer/api/documentation/v1/objects/ExtendedRuntime.shtml
 type ExtendedRuntime struct {
-	LastReadingTimestamp     string `json:"lastReadingTimestamp"`
-	RuntimeDate              string `json:"runtimeDate"`
-	RuntimeInterval          int    `json:"runtimeInterval"`
-	ActualTemperature        int    `json:"actualTemperature"`
-	ActualHumidity           int    `json:"actualHumidity"`
-	DesiredHeat              int    `json:"desiredHeat"`
-	DesiredCool              int    `json:"desiredCool"`
-	DesiredHumidity          int    `json:"desiredHumidity"`
-	DesiredDehumidity        int    `json:"desiredDehumidity"`
-	DMOffset                 int    `json:"dmOffset"`
-	HVACMode                 string `json:"hvacMode"`
-	HeatPump1                int    `json:"heatPump1"`
-	HeatPump2                int    `json:"heatPump2"`
-	AuxHeat1                 int    `json:"auxHeat1"`
-	AuxHeat2                 int    `json:"auxHeat2"`
-	AuxHeat3                 int    `json:"auxHeat3"`
-	Cool1                    int    `json:"cool1"`
-	Cool2                    int    `json:"cool2"`
-	Fan                      int    `json:"fan"`
-	Humidifier               int    `json:"humidifier"`
-	Dehumidifier             int    `json:"dehumidifier"`
-	Economizer               int    `json:"economizer"`
-	Ventilator               int    `json:"ventilator"`
-	CurrentElectricityBill   int    `json:"currentElectricityBill"`
-	ProjectedElectricityBill int    `json:"projectedElectricityBill"`
+	LastReadingTimestamp     string      `json:"lastReadingTimestamp"`
+	RuntimeDate              string      `json:"runtimeDate"`
+	RuntimeInterval          int         `json:"runtimeInterval"`
+	ActualTemperature        Temperature `json:"actualTemperature"`
+	ActualHumidity           int         `json:"actualHumidity"`
+	DesiredHeat              Temperature `json:"desiredHeat"`
+	DesiredCool              Temperature `json:"desiredCool"`
+	DesiredHumidity          int         `json:"desiredHumidity"`
+	DesiredDehumidity        int         `json:"desiredDehumidity"`
+	DMOffset                 int         `json:"dmOffset"`
+	HVACMode                 string      `json:"hvacMode"`
+	HeatPump1                int         `json:"heatPump1"`
+	HeatPump2                int         `json:"heatPump2"`
+	AuxHeat1                 int         `json:"auxHeat1"`
+	AuxHeat2                 int         `json:"auxHeat2"`
+	AuxHeat3                 int         `json:"auxHeat3"`
+	Cool1                    int         `json:"cool1"`
+	Cool2                    int         `json:"cool2"`
+	Fan                      int         `json:"fan"`
+	Humidifier               int         `json:"humidifier"`
+	Dehumidifier             int         `json:"dehumidifier"`
+	Economizer               int         `json:"economizer"`
+	Ventilator               int         `json:"ventilator"`
+	CurrentElectricityBill   int         `json:"currentElectricityBill"`
+	ProjectedElectricityBill int         `json:"projectedElectricityBill"`
 }
 
 // GeneralSetting represent the General alert/reminder type. It is used when
@@ -262,6 +263,17 @@ type Location struct {
 	MapCoordinates        string `json:"mapCoordinates"`
 }
 
+// timeLocation returns the time zone of the Location. If the named time zone is
+// unknown, a fixed zone at the Location's offset from UTC is used instead.
+func (l *Location) timeLocation() *time.Location {
+	if l.TimeZone != "" {
+		if loc, err := time.LoadLocation(l.TimeZone); err == nil {
+			return loc
+		}
+	}
+	return time.FixedZone(l.TimeZone, l.TimeZoneOffsetMinutes*60)
+}
+
 // Management contains information about the management company the thermostat
 // belongs to. The Management object is read-only, it may be modified in the web
 // portal.
@@ -301,7 +313,8 @@ type Output struct {
 	DeactivationTime int    `json:"deactivationTime"`
 }
 
-// Program is a container for the Schedule and its Climates.
+// Program is a container for the Schedule and its Climates. Use NewSchedule to
+// interpret or edit the Schedule.
 // See https://www.ecobee.com/home/developer/api/documentation/v1/objects/Program.shtml
 type Program struct {
 	Schedule          [][]string `json:"schedule"`
@@ -328,19 +341,15 @@ type RemoteSensor struct {
 }
 
 // Temperature gets the temperature for the sensor if it exists.
-func (s *RemoteSensor) Temperature() (float64, error) {
+func (s *RemoteSensor) Temperature() (Temperature, error) {
 	if s != nil && len(s.Capability) > 0 {
 		for _, c := range s.Capability {
 			if c.Type == CapabilityTypeTemperature {
-				v, err := strconv.ParseFloat(c.Value, 64)
-				if err != nil {
-					return 0.0, err
-				}
-				return float64(v / 10), nil
+				return parseTemperature(c.Value)
 			}
 		}
 	}
-	return 0.0, fmt.Errorf("remote sensor %v does not have a temperature capability", s.Name)
+	return 0, fmt.Errorf("remote sensor %v does not have a temperature capability", s.Name)
 }
 
 // Humidity gets the humidity for the sensor if it exists.
@@ -386,24 +395,24 @@ type RemoteSensorCapability struct {
 // the server.
 // See https://www.ecobee.com/home/developer/api/documentation/v1/objects/Runtime.shtml
 type Runtime struct {
-	RuntimeRev         string `json:"runtimeRev"`
-	Connected          bool   `json:"connected"`
-	FirstConnected     string `json:"firstConnected"`
-	ConnectDateTime    string `json:"connectDateTime"`
-	DisconnectDateTime string `json:"disconnectDateTime"`
-	LastModified       string `json:"lastModified"`
-	LastStatusModified string `json:"lastStatusModified"`
-	RuntimeDate        string `json:"runtimeDate"`
-	RuntimeInterval    int    `json:"runtimeInterval"`
-	ActualTemperature  int    `json:"actualTemperature"`
-	ActualHumidity     int    `json:"actualHumidity"`
-	DesiredHeat        int    `json:"desiredHeat"`
-	DesiredCool        int    `json:"desiredCool"`
-	DesiredHumidity    int    `json:"desiredHumidity"`
-	DesiredDehumidity  int    `json:"desiredDehumidity"`
-	DesiredFanMode     string `json:"desiredFanMode"`
-	DesiredHeatRange   []int  `json:"desiredHeatRange"`
-	DesiredCoolRange   []int  `json:"desiredCoolRange"`
+	RuntimeRev         string        `json:"runtimeRev"`
+	Connected          bool          `json:"connected"`
+	FirstConnected     string        `json:"firstConnected"`
+	ConnectDateTime    string        `json:"connectDateTime"`
+	DisconnectDateTime string        `json:"disconnectDateTime"`
+	LastModified       string        `json:"lastModified"`
+	LastStatusModified string        `json:"lastStatusModified"`
+	RuntimeDate        string        `json:"runtimeDate"`
+	RuntimeInterval    int           `json:"runtimeInterval"`
+	ActualTemperature  Temperature   `json:"actualTemperature"`
+	ActualHumidity     int           `json:"actualHumidity"`
+	DesiredHeat        Temperature   `json:"desiredHeat"`
+	DesiredCool        Temperature   `json:"desiredCool"`
+	DesiredHumidity    int           `json:"desiredHumidity"`
+	DesiredDehumidity  int           `json:"desiredDehumidity"`
+	DesiredFanMode     string        `json:"desiredFanMode"`
+	DesiredHeatRange   []Temperature `json:"desiredHeatRange"`
+	DesiredCoolRange   []Temperature `json:"desiredCoolRange"`
 }
 
 // SecuritySettings defines the security settings which a thermostat may have.
@@ -497,119 +506,119 @@ type Sensor struct {
 // Settings contains all the configuration properties of a Thermostat.
 // See https://www.ecobee.com/home/developer/api/documentation/v1/objects/Settings.shtml
 type Settings struct {
-	HVACMode                            string `json:"hvacMode"`
-	LastServiceDate                     string `json:"lastServiceDate"`
-	ServiceRemindMe                     bool   `json:"serviceRemindMe"`
-	MonthsBetweenService                int    `json:"monthsBetweenService"`
-	RemindMeDate                        string `json:"remindMeDate"`
-	Vent                                string `json:"vent"`
-	VentilatorMinOnTime                 int    `json:"ventilatorMinOnTime"`
-	ServiceRemindTechnician             bool   `json:"serviceRemindTechnician"`
-	EILocation                          string `json:"eiLocation"`
-	ColdTempAlert                       int    `json:"coldTempAlert"`
-	ColdTempAlertEnabled                bool   `json:"coldTempAlertEnabled"`
-	HotTempAlert                        int    `json:"hotTempAlert"`
-	HotTempAlertEnabled                 bool   `json:"hotTempAlertEnabled"`
-	CoolStages                          int    `json:"coolStages"`
-	HeatStages                          int    `json:"heatStages"`
-	MaxSetBack                          int    `json:"maxSetBack"`
-	MaxSetForward                       int    `json:"maxSetForward"`
-	QuickSaveSetBack                    int    `json:"quickSaveSetBack"`
-	QuickSaveSetForward                 int    `json:"quickSaveSetForward"`
-	HasHeatPump                         bool   `json:"hasHeatPump"`
-	HasForcedAir                        bool   `json:"hasForcedAir"`
-	HasBoiler                           bool   `json:"hasBoiler"`
-	HasHumidifier                       bool   `json:"hasHumidifier"`
-	HasERV                              bool   `json:"hasErv"`
-	HasHRV                              bool   `json:"hasHrv"`
-	CondensationAvoid                   bool   `json:"condensationAvoid"`
-	UseCelsius                          bool   `json:"useCelsius"`
-	UseTimeFormat12                     bool   `json:"useTimeFormat12"`
-	Locale                              string `json:"locale"`
-	Humidity                            string `json:"humidity"`
-	HumidifierMode                      string `json:"humidifierMode"`
-	BacklightOnIntensity                int    `json:"backlightOnIntensity"`
-	BacklightSleepIntensity             int    `json:"backlightSleepIntensity"`
-	BacklightOffTime                    int    `json:"backlightOffTime"`
-	SoundTickVolume                     int    `json:"soundTickVolume"`
-	SoundAlertVolume                    int    `json:"soundAlertVolume"`
-	CompressorProtectionMinTime         int    `json:"compressorProtectionMinTime"`
-	CompressorProtectionMinTemp         int    `json:"compressorProtectionMinTemp"`
-	Stage1HeatingDifferentialTemp       int    `json:"stage1HeatingDifferentialTemp"`
-	Stage1CoolingDifferentialTemp       int    `json:"stage1CoolingDifferentialTemp"`
-	Stage1HeatingDissipationTime        int    `json:"stage1HeatingDissipationTime"`
-	Stage1CoolingDissipationTime        int    `json:"stage1CoolingDissipationTime"`
-	HeatPumpReversalOnCool              bool   `json:"heatPumpReversalOnCool"`
-	FanControlRequired                  bool   `json:"fanControlRequired"`
-	FanMinOnTime                        int    `json:"fanMinOnTime"`
-	HeatCoolMinDelta                    int    `json:"heatCoolMinDelta"`
-	TempCorrection                      int    `json:"tempCorrection"`
-	HoldAction                          string `json:"holdAction"`
-	HeatPumpGroundWater                 bool   `json:"heatPumpGroundWater"`
-	HasElectric                         bool   `json:"hasElectric"`
-	HasDehumidifier                     bool   `json:"hasDehumidifier"`
-	DehumidifierMode                    string `json:"dehumidifierMode"`
-	DehumidifierLevel                   int    `json:"dehumidifierLevel"`
-	DehumidifyWithAC                    bool   `json:"dehumidifyWithAC"`
-	DehumidifyOvercoolOffset            int    `json:"dehumidifyOvercoolOffset"`
-	AutoHeatCoolFeatureEnabled          bool   `json:"autoHeatCoolFeatureEnabled"`
-	WifiOfflineAlert                    bool   `json:"wifiOfflineAlert"`
-	HeatMinTemp                         int    `json:"heatMinTemp"`
-	HeatMaxTemp                         int    `json:"heatMaxTemp"`
-	CoolMinTemp                         int    `json:"coolMinTemp"`
-	CoolMaxTemp                         int    `json:"coolMaxTemp"`
-	HeatRangeHigh                       int    `json:"heatRangeHigh"`
-	HeatRangeLow                        int    `json:"heatRangeLow"`
-	CoolRangeHigh                       int    `json:"coolRangeHigh"`
-	CoolRangeLow                        int    `json:"coolRangeLow"`
-	UserAccessCode                      string `json:"userAccessCode"`
-	UserAccessSetting                   int    `json:"userAccessSetting"`
-	AuxRuntimeAlert                     int    `json:"auxRuntimeAlert"`
-	AuxOutdoorTempAlert                 int    `json:"auxOutdoorTempAlert"`
-	AuxMaxOutdoorTemp                   int    `json:"auxMaxOutdoorTemp"`
-	AuxRuntimeAlertNotify               bool   `json:"auxRuntimeAlertNotify"`
-	AuxOutdoorTempAlertNotify           bool   `json:"auxOutdoorTempAlertNotify"`
-	AuxRuntimeAlertNotifyTechnician     bool   `json:"auxRuntimeAlertNotifyTechnician"`
-	AuxOutdoorTempAlertNotifyTechnician bool   `json:"auxOutdoorTempAlertNotifyTechnician"`
-	DisablePreHeating                   bool   `json:"disablePreHeating"`
-	DisablePreCooling                   bool   `json:"disablePreCooling"`
-	InstallerCodeRequired               bool   `json:"installerCodeRequired"`
-	DRAccept                            string `json:"drAccept"`
-	IsRentalProperty                    bool   `json:"isRentalProperty"`
-	UseZoneController                   bool   `json:"useZoneController"`
-	RandomStartDelayCool                int    `json:"randomStartDelayCool"`
-	RandomStartDelayHeat                int    `json:"randomStartDelayHeat"`
-	HumidityHighAlert                   int    `json:"humidityHighAlert"`
-	HumidityLowAlert                    int    `json:"humidityLowAlert"`
-	DisableHeatPumpAlerts               bool   `json:"disableHeatPumpAlerts"`
-	DisableAlertsOnIdt                  bool   `json:"disableAlertsOnIdt"`
-	HumidityAlertNotify                 bool   `json:"humidityAlertNotify"`
-	HumidityAlertNotifyTechnician       bool   `json:"humidityAlertNotifyTechnician"`
-	TempAlertNotify                     bool   `json:"tempAlertNotify"`
-	TempAlertNotifyTechnician           bool   `json:"tempAlertNotifyTechnician"`
-	MonthlyElectricityBillLimit         int    `json:"monthlyElectricityBillLimit"`
-	EnableElectricityBillAlert          bool   `json:"enableElectricityBillAlert"`
-	EnableProjectedElectricityBillAlert bool   `json:"enableProjectedElectricityBillAlert"`
-	ElectricityBillingDayOfMonth        int    `json:"electricityBillingDayOfMonth"`
-	ElectricityBillCycleMonths          int    `json:"electricityBillCycleMonths"`
-	ElectricityBillStartMonth           int    `json:"electricityBillStartMonth"`
-	VentilatorMinOnTimeHome             int    `json:"ventilatorMinOnTimeHome"`
-	VentilatorMinOnTimeAway             int    `json:"ventilatorMinOnTimeAway"`
-	BacklightOffDuringSleep             bool   `json:"backlightOffDuringSleep"`
-	AutoAway                            bool   `json:"autoAway"`
-	SmartCirculation                    bool   `json:"smartCirculation"`
-	FollowMeComfort                     bool   `json:"followMeComfort"`
-	VentilatorType                      string `json:"ventilatorType"`
-	IsVentilatorTimerOn                 bool   `json:"isVentilatorTimerOn"`
-	VentilatorOffDateTime               string `json:"ventilatorOffDateTime"`
-	HasUVFilter                         bool   `json:"hasUVFilter"`
-	CoolingLockout                      bool   `json:"coolingLockout"`
-	VentilatorFreeCooling               bool   `json:"ventilatorFreeCooling"`
-	DehumidifyWhenHeating               bool   `json:"dehumidifyWhenHeating"`
-	VentilatorDehumidify                bool   `json:"ventilatorDehumidify"`
-	GroupRef                            string `json:"groupRef"`
-	GroupName                           string `json:"groupName"`
-	GroupSetting                        int    `json:"groupSetting"`
+	HVACMode                            string      `json:"hvacMode"`
+	LastServiceDate                     string      `json:"lastServiceDate"`
+	ServiceRemindMe                     bool        `json:"serviceRemindMe"`
+	MonthsBetweenService                int         `json:"monthsBetweenService"`
+	RemindMeDate                        string      `json:"remindMeDate"`
+	Vent                                string      `json:"vent"`
+	VentilatorMinOnTime                 int         `json:"ventilatorMinOnTime"`
+	ServiceRemindTechnician             bool        `json:"serviceRemindTechnician"`
+	EILocation                          string      `json:"eiLocation"`
+	ColdTempAlert                       Temperature `json:"coldTempAlert"`
+	ColdTempAlertEnabled                bool        `json:"coldTempAlertEnabled"`
+	HotTempAlert                        Temperature `json:"hotTempAlert"`
+	HotTempAlertEnabled                 bool        `json:"hotTempAlertEnabled"`
+	CoolStages                          int         `json:"coolStages"`
+	HeatStages                          int         `json:"heatStages"`
+	MaxSetBack                          int         `json:"maxSetBack"`
+	MaxSetForward                       int         `json:"maxSetForward"`
+	QuickSaveSetBack                    int         `json:"quickSaveSetBack"`
+	QuickSaveSetForward                 int         `json:"quickSaveSetForward"`
+	HasHeatPump                         bool        `json:"hasHeatPump"`
+	HasForcedAir                        bool        `json:"hasForcedAir"`
+	HasBoiler                           bool        `json:"hasBoiler"`
+	HasHumidifier                       bool        `json:"hasHumidifier"`
+	HasERV                              bool        `json:"hasErv"`
+	HasHRV                              bool        `json:"hasHrv"`
+	CondensationAvoid                   bool        `json:"condensationAvoid"`
+	UseCelsius                          bool        `json:"useCelsius"`
+	UseTimeFormat12                     bool        `json:"useTimeFormat12"`
+	Locale                              string      `json:"locale"`
+	Humidity                            string      `json:"humidity"`
+	HumidifierMode                      string      `json:"humidifierMode"`
+	BacklightOnIntensity                int         `json:"backlightOnIntensity"`
+	BacklightSleepIntensity             int         `json:"backlightSleepIntensity"`
+	BacklightOffTime                    int         `json:"backlightOffTime"`
+	SoundTickVolume                     int         `json:"soundTickVolume"`
+	SoundAlertVolume                    int         `json:"soundAlertVolume"`
+	CompressorProtectionMinTime         int         `json:"compressorProtectionMinTime"`
+	CompressorProtectionMinTemp         Temperature `json:"compressorProtectionMinTemp"`
+	Stage1HeatingDifferentialTemp       int         `json:"stage1HeatingDifferentialTemp"`
+	Stage1CoolingDifferentialTemp       int         `json:"stage1CoolingDifferentialTemp"`
+	Stage1HeatingDissipationTime        int         `json:"stage1HeatingDissipationTime"`
+	Stage1CoolingDissipationTime        int         `json:"stage1CoolingDissipationTime"`
+	HeatPumpReversalOnCool              bool        `json:"heatPumpReversalOnCool"`
+	FanControlRequired                  bool        `json:"fanControlRequired"`
+	FanMinOnTime                        int         `json:"fanMinOnTime"`
+	HeatCoolMinDelta                    int         `json:"heatCoolMinDelta"`
+	TempCorrection                      int         `json:"tempCorrection"`
+	HoldAction                          string      `json:"holdAction"`
+	HeatPumpGroundWater                 bool        `json:"heatPumpGroundWater"`
+	HasElectric                         bool        `json:"hasElectric"`
+	HasDehumidifier                     bool        `json:"hasDehumidifier"`
+	DehumidifierMode                    string      `json:"dehumidifierMode"`
+	DehumidifierLevel                   int         `json:"dehumidifierLevel"`
+	DehumidifyWithAC                    bool        `json:"dehumidifyWithAC"`
+	DehumidifyOvercoolOffset            int         `json:"dehumidifyOvercoolOffset"`
+	AutoHeatCoolFeatureEnabled          bool        `json:"autoHeatCoolFeatureEnabled"`
+	WifiOfflineAlert                    bool        `json:"wifiOfflineAlert"`
+	HeatMinTemp                         Temperature `json:"heatMinTemp"`
+	HeatMaxTemp                         Temperature `json:"heatMaxTemp"`
+	CoolMinTemp                         Temperature `json:"coolMinTemp"`
+	CoolMaxTemp                         Temperature `json:"coolMaxTemp"`
+	HeatRangeHigh                       Temperature `json:"heatRangeHigh"`
+	HeatRangeLow                        Temperature `json:"heatRangeLow"`
+	CoolRangeHigh                       Temperature `json:"coolRangeHigh"`
+	CoolRangeLow                        Temperature `json:"coolRangeLow"`
+	UserAccessCode                      string      `json:"userAccessCode"`
+	UserAccessSetting                   int         `json:"userAccessSetting"`
+	AuxRuntimeAlert                     int         `json:"auxRuntimeAlert"`
+	AuxOutdoorTempAlert                 Temperature `json:"auxOutdoorTempAlert"`
+	AuxMaxOutdoorTemp                   Temperature `json:"auxMaxOutdoorTemp"`
+	AuxRuntimeAlertNotify               bool        `json:"auxRuntimeAlertNotify"`
+	AuxOutdoorTempAlertNotify           bool        `json:"auxOutdoorTempAlertNotify"`
+	AuxRuntimeAlertNotifyTechnician     bool        `json:"auxRuntimeAlertNotifyTechnician"`
+	AuxOutdoorTempAlertNotifyTechnician bool        `json:"auxOutdoorTempAlertNotifyTechnician"`
+	DisablePreHeating                   bool        `json:"disablePreHeating"`
+	DisablePreCooling                   bool        `json:"disablePreCooling"`
+	InstallerCodeRequired               bool        `json:"installerCodeRequired"`
+	DRAccept                            string      `json:"drAccept"`
+	IsRentalProperty                    bool        `json:"isRentalProperty"`
+	UseZoneController                   bool        `json:"useZoneController"`
+	RandomStartDelayCool                int         `json:"randomStartDelayCool"`
+	RandomStartDelayHeat                int         `json:"randomStartDelayHeat"`
+	HumidityHighAlert                   int         `json:"humidityHighAlert"`
+	HumidityLowAlert                    int         `json:"humidityLowAlert"`
+	DisableHeatPumpAlerts               bool        `json:"disableHeatPumpAlerts"`
+	DisableAlertsOnIdt                  bool        `json:"disableAlertsOnIdt"`
+	HumidityAlertNotify                 bool        `json:"humidityAlertNotify"`
+	HumidityAlertNotifyTechnician       bool        `json:"humidityAlertNotifyTechnician"`
+	TempAlertNotify                     bool        `json:"tempAlertNotify"`
+	TempAlertNotifyTechnician           bool        `json:"tempAlertNotifyTechnician"`
+	MonthlyElectricityBillLimit         int         `json:"monthlyElectricityBillLimit"`
+	EnableElectricityBillAlert          bool        `json:"enableElectricityBillAlert"`
+	EnableProjectedElectricityBillAlert bool        `json:"enableProjectedElectricityBillAlert"`
+	ElectricityBillingDayOfMonth        int         `json:"electricityBillingDayOfMonth"`
+	ElectricityBillCycleMonths          int         `json:"electricityBillCycleMonths"`
+	ElectricityBillStartMonth           int         `json:"electricityBillStartMonth"`
+	VentilatorMinOnTimeHome             int         `json:"ventilatorMinOnTimeHome"`
+	VentilatorMinOnTimeAway             int         `json:"ventilatorMinOnTimeAway"`
+	BacklightOffDuringSleep             bool        `json:"backlightOffDuringSleep"`
+	AutoAway                            bool        `json:"autoAway"`
+	SmartCirculation                    bool        `json:"smartCirculation"`
+	FollowMeComfort                     bool        `json:"followMeComfort"`
+	VentilatorType                      string      `json:"ventilatorType"`
+	IsVentilatorTimerOn                 bool        `json:"isVentilatorTimerOn"`
+	VentilatorOffDateTime               string      `json:"ventilatorOffDateTime"`
+	HasUVFilter                         bool        `json:"hasUVFilter"`
+	CoolingLockout                      bool        `json:"coolingLockout"`
+	VentilatorFreeCooling               bool        `json:"ventilatorFreeCooling"`
+	DehumidifyWhenHeating               bool        `json:"dehumidifyWhenHeating"`
+	VentilatorDehumidify                bool        `json:"ventilatorDehumidify"`
+	GroupRef                            string      `json:"groupRef"`
+	GroupName                           string      `json:"groupName"`
+	GroupSetting                        int         `json:"groupSetting"`
 }
 
 // State is a configurable trigger for a number of SensorActions.
@@ -678,10 +687,7 @@ type ThermostatSummary struct {
 	RevisionList    []string `json:"revisionList,omitempty"`
 	ThermostatCount int      `json:"thermostatCount,omitempty"`
 	StatusList      []string `json:"statusList,omitempty"`
-	Status          struct {
-		Code    int    `json:"code,omitempty"`
-		Message string `json:"message,omitempty"`
-	} `json:"status,omitempty"`
+	Status          Status   `json:"status,omitempty"`
 }
 
 // Utility the Thermostat belongs to. May not be modified.
@@ -752,17 +758,17 @@ type WeatherForecast struct {
 	WeatherSymbol    WeatherSymbol `json:"weatherSymbol"`
 	DateTime         string        `json:"dateTime"`
 	Condition        string        `json:"condition"`
-	Temperature      int           `json:"temperature"`
+	Temperature      Temperature   `json:"temperature"`
 	Pressure         int           `json:"pressure"`
 	RelativeHumidity int           `json:"relativeHumidity"`
-	Dewpoint         int           `json:"dewpoint"`
+	Dewpoint         Temperature   `json:"dewpoint"`
 	Visibility       int           `json:"visibility"`
 	WindSpeed        int           `json:"windSpeed"`
 	WindGust         int           `json:"windGust"`
 	WindDirection    string        `json:"windDirection"`
 	WindBearing      int           `json:"windBearing"`
 	Pop              int           `json:"pop"`
-	TempHigh         int           `json:"tempHigh"`
-	TempLow          int           `json:"tempLow"`
+	TempHigh         Temperature   `json:"tempHigh"`
+	TempLow          Temperature   `json:"tempLow"`
 	Sky              int           `json:"sky"`
 }
@@ -0,0 +1,231 @@
+package egobee
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MinWatchInterval is the shortest interval at which a Watcher polls. ecobee
+// asks that the summary be polled no more often than every 3 minutes.
+const MinWatchInterval = 3 * time.Minute
+
+// minWatchInterval overrideable for testing.
+var minWatchInterval = MinWatchInterval
+
+// Change is a set of flags describing which parts of a thermostat changed.
+type Change uint
+
+// Possible Changes, corresponding to the revisions in a ThermostatRevision.
+const (
+	// ChangeThermostat indicates a change to the program, settings or other
+	// configuration of the thermostat.
+	ChangeThermostat Change = 1 << iota
+	// ChangeAlerts indicates that alerts were added or acknowledged.
+	ChangeAlerts
+	// ChangeRuntime indicates that the thermostat reported new runtime data.
+	ChangeRuntime
+	// ChangeConnected indicates that the thermostat connected or disconnected.
+	ChangeConnected
+	// ChangeRemoved indicates that the thermostat is no longer in the summary,
+	// such as because it was unregistered. No further events are sent for it
+	// unless it returns.
+	ChangeRemoved
+)
+
+// Has reports whether all of the flags in o are set.
+func (c Change) Has(o Change) bool {
+	return c&o == o
+}
+
+// diffRevisions returns the Changes between two revisions of a thermostat. If
+// from is nil, every flag other than ChangeRemoved is set.
+func diffRevisions(from, to *ThermostatRevision) Change {
+	if from == nil {
+		return ChangeThermostat | ChangeAlerts | ChangeRuntime | ChangeConnected
+	}
+	var c Change
+	if from.ThermostatRev != to.ThermostatRev {
+		c |= ChangeThermostat
+	}
+	if from.AlertsRev != to.AlertsRev {
+		c |= ChangeAlerts
+	}
+	if from.RuntimeRev != to.RuntimeRev {
+		c |= ChangeRuntime
+	}
+	if from.Connected != to.Connected {
+		c |= ChangeConnected
+	}
+	return c
+}
+
+// ThermostatEvent is sent by a Watcher when a thermostat changes.
+type ThermostatEvent struct {
+	// Changes since the previous event for this thermostat. The first event for
+	// each thermostat has every flag other than ChangeRemoved set. An event for
+	// a removed thermostat has only ChangeRemoved set.
+	Changes Change
+	// Revision of the thermostat which produced this event. For a removed
+	// thermostat, it is the last revision seen.
+	Revision *ThermostatRevision
+	// Thermostat as retrieved after the change, or nil if it was removed.
+	Thermostat *Thermostat
+}
+
+// WatcherOptions configure a Watcher.
+type WatcherOptions struct {
+	// Interval between polls of the thermostat summary. Intervals shorter than
+	// MinWatchInterval are raised to it.
+	Interval time.Duration
+	// Selection of thermostats to watch, and of the data to retrieve when they
+	// change. The SelectionType and SelectionMatch determine which thermostats
+	// are watched, defaulting to all registered thermostats. The Include fields
+	// determine which parts of each Thermostat are populated in events.
+	Selection *Selection
+	// OnError, if set, is called with errors encountered while polling. The
+	// Watcher continues polling regardless.
+	OnError func(error)
+}
+
+// Watcher polls the thermostat summary, and retrieves only those thermostats
+// whose revisions have changed since the previous poll.
+type Watcher struct {
+	c         *Client
+	interval  time.Duration
+	selection Selection
+	onError   func(error)
+
+	events    chan *ThermostatEvent
+	revisions map[string]*ThermostatRevision // last seen, by identifier
+}
+
+// NewWatcher of the thermostats accessible to c. Call Run to start polling.
+func NewWatcher(c *Client, opts *WatcherOptions) *Watcher {
+	w := &Watcher{
+		c:         c,
+		interval:  minWatchInterval,
+		selection: Selection{SelectionType: SelectionTypeRegistered},
+		events:    make(chan *ThermostatEvent),
+		revisions: make(map[string]*ThermostatRevision),
+	}
+	if opts != nil {
+		if opts.Interval > w.interval {
+			w.interval = opts.Interval
+		}
+		if opts.Selection != nil {
+			w.selection = *opts.Selection
+		}
+		w.onError = opts.OnError
+	}
+	return w
+}
+
+// Events on which changes are delivered. The channel is closed when Run
+// returns.
+func (w *Watcher) Events() <-chan *ThermostatEvent {
+	return w.events
+}
+
+// Run polls immediately, and then at the configured interval, until ctx is
+// done. It returns ctx.Err().
+func (w *Watcher) Run(ctx context.Context) error {
+	defer close(w.events)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		if err := w.poll(ctx); err != nil && ctx.Err() == nil && w.onError != nil {
+			w.onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll the summary once, and send events for any changed or removed
+// thermostats.
+func (w *Watcher) poll(ctx context.Context) error {
+	summary, err := w.c.ThermostatSummaryWithSelectionContext(ctx, &Selection{
+		SelectionType:  w.selection.SelectionType,
+		SelectionMatch: w.selection.SelectionMatch,
+	})
+	if err != nil {
+		return err
+	}
+	revisions, err := summary.Revisions()
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]*ThermostatRevision)
+	changes := make(map[string]Change)
+	var changed []string
+	for _, rev := range revisions {
+		current[rev.Identifier] = rev
+		if c := diffRevisions(w.revisions[rev.Identifier], rev); c != 0 {
+			changes[rev.Identifier] = c
+			changed = append(changed, rev.Identifier)
+		}
+	}
+	if err := w.removeMissing(ctx, current); err != nil {
+		return err
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	sel := w.selection
+	sel.SelectionType = SelectionTypeThermostats
+	sel.SelectionMatch = strings.Join(changed, ",")
+	thermostats, err := w.c.ThermostatsContext(ctx, &sel)
+	if err != nil {
+		return err
+	}
+	for _, t := range thermostats {
+		rev, ok := current[t.Identifier]
+		if !ok {
+			continue
+		}
+		select {
+		case w.events <- &ThermostatEvent{
+			Changes:    changes[t.Identifier],
+			Revision:   rev,
+			Thermostat: t,
+		}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		// Only remember the revision once the event has been delivered, so that
+		// the thermostat is retrieved again if the poll fails part way.
+		w.revisions[t.Identifier] = rev
+	}
+	return nil
+}
+
+// removeMissing sends a removal event for each thermostat seen before which is
+// not in current, and forgets it.
+func (w *Watcher) removeMissing(ctx context.Context, current map[string]*ThermostatRevision) error {
+	var removed []string
+	for id := range w.revisions {
+		if _, ok := current[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	sort.Strings(removed)
+	for _, id := range removed {
+		select {
+		case w.events <- &ThermostatEvent{
+			Changes:  ChangeRemoved,
+			Revision: w.revisions[id],
+		}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delete(w.revisions, id)
+	}
+	return nil
+}
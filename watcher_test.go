@@ -0,0 +1,230 @@
+package egobee
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestChangeHas(t *testing.T) {
+	c := ChangeThermostat | ChangeRuntime
+	if !c.Has(ChangeThermostat) || !c.Has(ChangeRuntime) || !c.Has(ChangeThermostat|ChangeRuntime) {
+		t.Errorf("%v should have ChangeThermostat and ChangeRuntime", c)
+	}
+	if c.Has(ChangeAlerts) || c.Has(ChangeThermostat|ChangeAlerts) {
+		t.Errorf("%v should not have ChangeAlerts", c)
+	}
+}
+
+func TestDiffRevisions(t *testing.T) {
+	base := ThermostatRevision{
+		Identifier:    "1",
+		Connected:     true,
+		ThermostatRev: "t1",
+		AlertsRev:     "a1",
+		RuntimeRev:    "r1",
+		IntervalRev:   "i1",
+	}
+	for _, tt := range []struct {
+		name   string
+		modify func(*ThermostatRevision)
+		want   Change
+	}{
+		{"unchanged", func(*ThermostatRevision) {}, 0},
+		{"interval only", func(r *ThermostatRevision) { r.IntervalRev = "i2" }, 0},
+		{"thermostat", func(r *ThermostatRevision) { r.ThermostatRev = "t2" }, ChangeThermostat},
+		{"alerts", func(r *ThermostatRevision) { r.AlertsRev = "a2" }, ChangeAlerts},
+		{"runtime", func(r *ThermostatRevision) { r.RuntimeRev = "r2" }, ChangeRuntime},
+		{"disconnected", func(r *ThermostatRevision) { r.Connected = false }, ChangeConnected},
+		{"several", func(r *ThermostatRevision) {
+			r.ThermostatRev = "t2"
+			r.RuntimeRev = "r2"
+		}, ChangeThermostat | ChangeRuntime},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to := base, base
+			tt.modify(&to)
+			if got := diffRevisions(&from, &to); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+	all := ChangeThermostat | ChangeAlerts | ChangeRuntime | ChangeConnected
+	if got := diffRevisions(nil, &base); got != all {
+		t.Errorf("first revision: got %v, want %v", got, all)
+	}
+}
+
+func TestNewWatcherInterval(t *testing.T) {
+	for _, tt := range []struct {
+		opts *WatcherOptions
+		want time.Duration
+	}{
+		{nil, MinWatchInterval},
+		{&WatcherOptions{}, MinWatchInterval},
+		{&WatcherOptions{Interval: time.Minute}, MinWatchInterval},
+		{&WatcherOptions{Interval: 5 * time.Minute}, 5 * time.Minute},
+	} {
+		if got := NewWatcher(&Client{}, tt.opts).interval; got != tt.want {
+			t.Errorf("NewWatcher(%+v): got interval %v, want %v", tt.opts, got, tt.want)
+		}
+	}
+}
+
+// watcherTestServer serves successive revision lists from the summary
+// endpoint, repeating the last once exhausted, and records the selections
+// requested from the thermostat endpoint.
+type watcherTestServer struct {
+	t         *testing.T
+	mu        sync.Mutex
+	summaries [][]string
+	requested []Selection
+}
+
+func (s *watcherTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ss := &summarySelection{}
+	if err := json.Unmarshal([]byte(r.URL.Query().Get("json")), ss); err != nil {
+		s.t.Errorf("failed to decode selection: %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", requestContentType)
+	switch r.URL.Path {
+	case thermostatSummaryURL:
+		revs := s.summaries[0]
+		if len(s.summaries) > 1 {
+			s.summaries = s.summaries[1:]
+		}
+		json.NewEncoder(w).Encode(&ThermostatSummary{
+			RevisionList:    revs,
+			ThermostatCount: len(revs),
+		})
+	case thermostatURL:
+		s.requested = append(s.requested, ss.Selection)
+		ptr := &pagedThermostatResponse{Page: page{Page: 1, TotalPages: 1}}
+		for _, id := range strings.Split(ss.Selection.SelectionMatch, ",") {
+			ptr.Thermostats = append(ptr.Thermostats, &Thermostat{Identifier: id})
+		}
+		json.NewEncoder(w).Encode(ptr)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	defer func(d time.Duration) { minWatchInterval = d }(minWatchInterval)
+	minWatchInterval = time.Millisecond
+
+	ts := &watcherTestServer{
+		t: t,
+		summaries: [][]string{
+			{"1:One:true:t1:a1:r1:i1", "2:Two:true:t1:a1:r1:i1"},
+			{"1:One:true:t1:a1:r1:i2", "2:Two:true:t1:a1:r2:i1"},
+			{"1:One:true:t1:a2:r1:i2", "2:Two:true:t1:a1:r2:i1"},
+			{"1:One:true:t1:a2:r1:i2"},
+			{"1:One:true:t1:a2:r1:i2", "2:Two:true:t1:a1:r2:i1"},
+		},
+	}
+	s := httptest.NewServer(ts)
+	defer s.Close()
+	client := &Client{api: apiBaseURL(s.URL)}
+
+	var errs []error
+	w := NewWatcher(client, &WatcherOptions{
+		Selection: &Selection{
+			SelectionType: SelectionTypeRegistered,
+			IncludeAlerts: true,
+		},
+		OnError: func(err error) { errs = append(errs, err) },
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+
+	all := ChangeThermostat | ChangeAlerts | ChangeRuntime | ChangeConnected
+	var got []string
+	for e := range w.Events() {
+		got = append(got, fmt.Sprintf("%v:%v", e.Revision.Identifier, e.Changes))
+		if e.Changes.Has(ChangeRemoved) {
+			if e.Thermostat != nil {
+				t.Errorf("got thermostat %v in removal event", e.Thermostat.Identifier)
+			}
+		} else if e.Thermostat == nil || e.Revision.Identifier != e.Thermostat.Identifier {
+			t.Errorf("event revision %v for thermostat %+v", e.Revision.Identifier, e.Thermostat)
+		}
+		if len(got) == 6 {
+			cancel()
+		}
+	}
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run returned %v, want %v", err, context.Canceled)
+	}
+	if len(errs) != 0 {
+		t.Errorf("got unexpected errors: %v", errs)
+	}
+
+	want := []string{
+		fmt.Sprintf("1:%v", all),
+		fmt.Sprintf("2:%v", all),
+		fmt.Sprintf("2:%v", ChangeRuntime),
+		fmt.Sprintf("1:%v", ChangeAlerts),
+		fmt.Sprintf("2:%v", ChangeRemoved),
+		fmt.Sprintf("2:%v", all),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got events %v, want %v", got, want)
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	var matches []string
+	for _, sel := range ts.requested {
+		if sel.SelectionType != SelectionTypeThermostats || !sel.IncludeAlerts {
+			t.Errorf("got thermostat selection %+v", sel)
+		}
+		matches = append(matches, sel.SelectionMatch)
+	}
+	if wantMatches := []string{"1,2", "2", "1", "2"}; !reflect.DeepEqual(matches, wantMatches) {
+		t.Errorf("requested thermostats %v, want %v", matches, wantMatches)
+	}
+}
+
+func TestWatcherReportsErrors(t *testing.T) {
+	defer func(d time.Duration) { minWatchInterval = d }(minWatchInterval)
+	minWatchInterval = time.Millisecond
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusInternalServerError)
+	}))
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 1)
+	w := NewWatcher(&Client{api: apiBaseURL(s.URL)}, &WatcherOptions{
+		OnError: func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+			cancel()
+		},
+	})
+	if err := w.Run(ctx); err != context.Canceled {
+		t.Errorf("Run returned %v, want %v", err, context.Canceled)
+	}
+	if err := <-errs; err == nil {
+		t.Error("expected a polling error, got nil")
+	}
+	if _, ok := <-w.Events(); ok {
+		t.Error("Events not closed after Run returned")
+	}
+}